@@ -0,0 +1,120 @@
+package main
+
+// adminctl manages admin console accounts from the shell, e.g. to create the
+// first super-admin or to recover a locked-out one.
+//
+//	go run ./cmd/adminctl list
+//	go run ./cmd/adminctl -username alice -wecom zhangsan -role operator create
+//	ADMINCTL_PASSWORD=... go run ./cmd/adminctl -username bob -role super-admin create
+//	go run ./cmd/adminctl -username bob -role viewer update
+//
+// Passwords come from the ADMINCTL_PASSWORD environment variable so they stay
+// out of shell history.
+
+import (
+	"flag"
+	"fmt"
+	"happynewyear/internal/config"
+	"happynewyear/internal/logic"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"log"
+	"os"
+)
+
+var (
+	configFile = flag.String("f", "deploy/config/config.yaml", "the config file")
+	username   = flag.String("username", "", "account username")
+	name       = flag.String("name", "", "display name")
+	wecom      = flag.String("wecom", "", "WeCom user id that may use the console")
+	role       = flag.String("role", "", "viewer, prize-fulfiller, operator, super-admin or auditor; update keeps the current one if empty")
+	disabled   = flag.Bool("disabled", false, "disable the account; update re-enables it without this flag")
+)
+
+func main() {
+	flag.Parse()
+
+	c, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	ctx := svc.NewServiceContext(c)
+	l := logic.NewAdminAccountLogic(ctx)
+
+	req := logic.AdminAccountRequest{
+		Username:    *username,
+		Name:        *name,
+		WeComUserID: *wecom,
+		Password:    os.Getenv("ADMINCTL_PASSWORD"),
+		Role:        *role,
+		Disabled:    *disabled,
+	}
+
+	switch flag.Arg(0) {
+	case "list", "":
+		list, err := l.List()
+		if err != nil {
+			log.Fatalf("List failed: %v", err)
+		}
+		for _, a := range list {
+			printAccount(&a)
+		}
+	case "create":
+		account, err := l.Create(req)
+		recordAudit(ctx, "accounts.create", req, err)
+		if err != nil {
+			log.Fatalf("Create failed: %v", err)
+		}
+		printAccount(account)
+	case "update":
+		var existing model.AdminAccount
+		if err := ctx.DB.Where("username = ?", *username).First(&existing).Error; err != nil {
+			log.Fatalf("No account %q", *username)
+		}
+		if req.Name == "" {
+			req.Name = existing.Name
+		}
+		if req.WeComUserID == "" {
+			req.WeComUserID = existing.WeComUserID
+		}
+		if req.Role == "" {
+			req.Role = existing.Role
+		}
+		// actor 0: the shell may change any account, including the last super-admin
+		account, err := l.Update(existing.ID, 0, req)
+		recordAudit(ctx, "accounts.update", req, err)
+		if err != nil {
+			log.Fatalf("Update failed: %v", err)
+		}
+		printAccount(account)
+	default:
+		log.Fatalf("Unknown command %q (list, create or update)", flag.Arg(0))
+	}
+}
+
+// recordAudit logs shell changes to the admin audit log like console ones
+func recordAudit(ctx *svc.ServiceContext, action string, req logic.AdminAccountRequest, err error) {
+	logic.NewAdminAuditLogic(ctx).RecordCommand("adminctl", action, map[string]interface{}{"body": map[string]interface{}{
+		"username":      req.Username,
+		"name":          req.Name,
+		"wecom_user_id": req.WeComUserID,
+		"role":          req.Role,
+		"disabled":      req.Disabled,
+		"password_set":  req.Password != "",
+	}}, err)
+}
+
+func printAccount(a *model.AdminAccount) {
+	status := "active"
+	if a.Disabled {
+		status = "disabled"
+	}
+	login := "wecom"
+	switch {
+	case a.PasswordHash != "" && a.WeComUserID != "":
+		login = "wecom+password"
+	case a.PasswordHash != "":
+		login = "password"
+	}
+	fmt.Printf("%4d  %-20s %-16s %-15s %-8s %s\n", a.ID, a.Username, a.Role, login, status, a.WeComUserID)
+}
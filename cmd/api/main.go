@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"happynewyear/internal/config"
 	"happynewyear/internal/handler"
+	"happynewyear/internal/logic"
 	"happynewyear/internal/svc"
 	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -24,6 +27,35 @@ func main() {
 
 	// 2. Init Service Context
 	ctx := svc.NewServiceContext(c)
+	if err := logic.NewAdminAccountLogic(ctx).EnsureBootstrap(); err != nil {
+		log.Printf("Warning: admin bootstrap failed: %v", err)
+	}
+	awards := logic.NewAwardLogic(ctx)
+	if n, err := awards.EnsureBaselineRevisions(); err != nil {
+		log.Printf("Warning: award revision baseline failed: %v", err)
+	} else if n > 0 {
+		log.Printf("Recorded baseline revisions for %d awards", n)
+	}
+	if n, err := awards.MigrateLegacyTypes(); err != nil {
+		log.Printf("Warning: award type migration failed: %v", err)
+	} else if n > 0 {
+		log.Printf("Migrated %d legacy awards to their kind", n)
+	}
+
+	// 2.1 Background Jobs
+	if c.Checkpoint.Enabled {
+		go logic.NewCheckpointLogic(ctx).Run(context.Background())
+	}
+	if c.Notify.Enabled {
+		go logic.NewNotifyLogic(ctx).Run(context.Background())
+	}
+	if c.OrgSync.Enabled {
+		interval := time.Duration(c.OrgSync.IntervalMinutes) * time.Minute
+		if interval <= 0 {
+			interval = 6 * time.Hour
+		}
+		go logic.NewOrgSyncLogic(ctx).Run(context.Background(), interval)
+	}
 
 	// 3. Setup Router
 	r := gin.Default()
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"happynewyear/internal/logic"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// Usage: auditverify happynewyear-audit-xxx.tar.gz
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: auditverify <bundle.tar.gz|bundle.zip>")
+	}
+	path := os.Args[1]
+
+	var files map[string][]byte
+	var err error
+	if strings.HasSuffix(path, ".zip") {
+		files, err = readZip(path)
+	} else {
+		files, err = readTarGz(path)
+	}
+	if err != nil {
+		log.Fatalf("Failed to read bundle: %v", err)
+	}
+
+	report, err := logic.VerifyBundle(files)
+	if err != nil {
+		log.Fatalf("❌ Bundle invalid: %v", err)
+	}
+
+	fmt.Printf("Draws: %d | Checkpoints: %d | Games: %d | Adjustments: %d | Chain head: %s\n",
+		report.DrawCount, report.CheckpointCount, report.GameCount, report.AdjustmentCount, report.ChainHead)
+	if !report.OK() {
+		for _, p := range report.Problems {
+			fmt.Printf("❌ %s\n", p)
+		}
+		os.Exit(1)
+	}
+	fmt.Println("✅ Bundle verified: checksums, hash chain, ledgers and checkpoint roots are consistent")
+}
+
+func readTarGz(path string) (map[string][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gr)
+
+	files := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[hdr.Name] = data
+	}
+	return files, nil
+}
+
+func readZip(path string) (map[string][]byte, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	files := make(map[string][]byte)
+	for _, zf := range zr.File {
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		files[zf.Name] = data
+	}
+	return files, nil
+}
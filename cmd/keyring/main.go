@@ -0,0 +1,93 @@
+package main
+
+// keyring shows and rotates the JWT and game signing keys.
+//
+//	go run ./cmd/keyring status
+//	go run ./cmd/keyring -purpose jwt -in 15m rotate
+//
+// rotate prints the new ring; put it in JWT_KEYS / GAME_KEYS (or Keys in
+// config.yaml) and roll the replicas. The new key verifies as soon as a
+// replica has it but only signs after -in, so give the rollout that long.
+// The old key keeps verifying for Keys.GraceMinutes after the switch.
+
+import (
+	"flag"
+	"fmt"
+	"happynewyear/internal/config"
+	"happynewyear/internal/keyring"
+	"log"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	configFile = flag.String("f", "deploy/config/config.yaml", "the config file")
+	purpose    = flag.String("purpose", "jwt", "which ring to rotate: jwt or game")
+	in         = flag.Duration("in", 15*time.Minute, "when the new key starts signing; longer than a rolling deploy")
+	asYAML     = flag.Bool("yaml", false, "print the rotated ring as config.yaml instead of an env line")
+)
+
+func main() {
+	flag.Parse()
+
+	c, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	jwtKeys, gameKeys, err := keyring.FromConfig(c)
+	if err != nil {
+		log.Fatalf("Invalid signing keys: %v", err)
+	}
+
+	switch flag.Arg(0) {
+	case "status", "":
+		printStatus("JWT", jwtKeys)
+		printStatus("Game", gameKeys)
+	case "rotate":
+		ring, env := jwtKeys, "JWT_KEYS"
+		switch *purpose {
+		case "jwt":
+		case "game":
+			ring, env = gameKeys, "GAME_KEYS"
+		default:
+			log.Fatalf("Unknown purpose %q (jwt or game)", *purpose)
+		}
+		rotate(ring, env, time.Now().Add(*in).Truncate(time.Minute))
+	default:
+		log.Fatalf("Unknown command %q (status or rotate)", flag.Arg(0))
+	}
+}
+
+func printStatus(name string, ring *keyring.Keyring) {
+	fmt.Printf("%s keys:\n", name)
+	for _, s := range ring.Status(time.Now()) {
+		since := "always"
+		if !s.NotBefore.IsZero() {
+			since = s.NotBefore.Format(time.RFC3339)
+		}
+		fmt.Printf("  %-24s %-8s from %s\n", s.ID, s.State, since)
+	}
+}
+
+func rotate(ring *keyring.Keyring, env string, notBefore time.Time) {
+	keys, err := ring.Rotate(*purpose, notBefore)
+	if err != nil {
+		log.Fatalf("Rotate failed: %v", err)
+	}
+	list := keyring.ToSigningKeys(keys)
+
+	fmt.Fprintf(os.Stderr, "New %s key signs from %s. Deploy this to every replica before then:\n\n",
+		*purpose, notBefore.Format(time.RFC3339))
+	if *asYAML {
+		field := "JWT"
+		if *purpose == "game" {
+			field = "Game"
+		}
+		out, _ := yaml.Marshal(map[string]map[string][]config.SigningKey{"Keys": {field: list}})
+		fmt.Print(string(out))
+		return
+	}
+	fmt.Printf("%s=%s\n", env, config.FormatSigningKeys(list))
+}
@@ -0,0 +1,76 @@
+package main
+
+// orgsync pulls the WeCom department tree and member list into the database.
+//
+//	go run ./cmd/orgsync -dry-run   # print the differences only
+//	go run ./cmd/orgsync            # apply them
+//
+// Members missing from WeCom are disabled, not deleted. If that would hit more
+// than a fifth of the active members the sync stops unless -force is given.
+// It shares the API server's sync lock: while a scheduled or console sync is
+// running it exits with "org sync already running".
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"happynewyear/internal/config"
+	"happynewyear/internal/logic"
+	"happynewyear/internal/svc"
+	"log"
+	"os"
+	"strings"
+)
+
+var (
+	configFile = flag.String("f", "deploy/config/config.yaml", "the config file")
+	dryRun     = flag.Bool("dry-run", false, "report the differences without writing")
+	force      = flag.Bool("force", false, "allow disabling many members at once")
+	asJSON     = flag.Bool("json", false, "print the report as JSON")
+)
+
+func main() {
+	flag.Parse()
+
+	c, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	ctx := svc.NewServiceContext(c)
+
+	report, err := logic.NewOrgSyncLogic(ctx).Sync(*dryRun, *force)
+	if report != nil {
+		printReport(report)
+	}
+	if err != nil {
+		log.Fatalf("Sync failed: %v", err)
+	}
+}
+
+func printReport(r *logic.OrgSyncReport) {
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(r)
+		return
+	}
+
+	if r.DryRun {
+		fmt.Println("DRY RUN - nothing was written")
+	}
+	fmt.Println(r.Summary())
+	section("Departments added", r.DepartmentsAdded)
+	section("Departments changed", r.DepartmentsChanged)
+	section("Departments removed", r.DepartmentsRemoved)
+	section("Users added", r.UsersAdded)
+	section("Users updated", r.UsersUpdated)
+	section("Users disabled", r.UsersDisabled)
+	section("Users re-enabled", r.UsersEnabled)
+}
+
+func section(title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Printf("\n%s (%d):\n  %s\n", title, len(items), strings.Join(items, "\n  "))
+}
@@ -0,0 +1,78 @@
+package main
+
+// snapshot lists, takes and restores the event snapshots that every reset
+// writes first.
+//
+//	go run ./cmd/snapshot list
+//	go run ./cmd/snapshot create
+//	go run ./cmd/snapshot -id 12 restore
+//
+// A restore from the shell skips the console's second-admin approval, but it
+// snapshots the current state first and is written to the admin audit log.
+
+import (
+	"flag"
+	"fmt"
+	"happynewyear/internal/config"
+	"happynewyear/internal/logic"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"log"
+	"os"
+)
+
+var (
+	configFile = flag.String("f", "deploy/config/config.yaml", "the config file")
+	id         = flag.Int64("id", 0, "snapshot id to restore")
+)
+
+func main() {
+	flag.Parse()
+
+	c, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	ctx := svc.NewServiceContext(c)
+	l := logic.NewSnapshotLogic(ctx)
+	audit := logic.NewAdminAuditLogic(ctx)
+	actor := "snapshot:" + os.Getenv("USER")
+
+	switch flag.Arg(0) {
+	case "list", "":
+		list, err := l.List()
+		if err != nil {
+			log.Fatalf("List failed: %v", err)
+		}
+		for _, s := range list {
+			printSnapshot(&s)
+		}
+	case "create":
+		snap, _, err := l.Create("manual", actor)
+		audit.RecordCommand("snapshot", "snapshots.create", nil, err)
+		if err != nil {
+			log.Fatalf("Snapshot failed: %v", err)
+		}
+		printSnapshot(snap)
+	case "restore":
+		if *id <= 0 {
+			log.Fatal("restore needs -id")
+		}
+		snap, err := l.Restore(*id, actor)
+		audit.RecordCommand("snapshot", logic.OpDataRestore, map[string]interface{}{"snapshot_id": *id}, err)
+		if err != nil {
+			log.Fatalf("Restore failed: %v", err)
+		}
+		fmt.Printf("Restored snapshot #%d\n", snap.ID)
+	default:
+		log.Fatalf("Unknown command %q (list, create or restore)", flag.Arg(0))
+	}
+}
+
+func printSnapshot(s *model.ResetSnapshot) {
+	restored := ""
+	if s.RestoredAt != nil {
+		restored = "restored " + s.RestoredAt.Format("2006-01-02 15:04:05") + " by " + s.RestoredBy
+	}
+	fmt.Printf("%4d  %s  %-14s %-20s %s  %s\n", s.ID, s.CreatedAt.Format("2006-01-02 15:04:05"), s.Reason, s.CreatedBy, s.Rows, restored)
+}
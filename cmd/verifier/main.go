@@ -16,7 +16,7 @@ import (
 
 const (
 	BaseURL     = "http://localhost:8080"
-	AppSecret   = "HappyNewYear2024Secret!@#" // Must match config.yaml
+	AppSecret   = "HappyNewYear2024Secret!@#" // Must match the current game key (Game.AppSecret unless GAME_KEYS is set)
 	UserToken   = "" // Will be fetched or hardcoded for testing
 )
 
@@ -47,7 +47,8 @@ func calcSignature(params map[string]string, secret string) string {
 }
 
 func main() {
-	// 1. Login to get Token (Mock)
+	// 1. Login to get Token (Mock; the API must run with WECOM_BASE_URL pointing at cmd/wecommock
+	//    and Auth.AllowBearer: true)
 	token, err := login()
 	if err != nil {
 		fmt.Printf("❌ Login Failed: %v\n", err)
@@ -0,0 +1,298 @@
+package main
+
+// wecommock emulates the parts of the WeCom server API this project uses, with
+// a small seeded directory, so the app can run and be tested without a corp.
+//
+//	go run ./cmd/wecommock -addr :9090
+//	WECOM_BASE_URL=http://localhost:9090 go run ./cmd/api
+//
+// Login codes: "mock" -> mock_user_001, any seeded userid logs in as that user,
+// "external" behaves like an external contact and "bad" is an invalid code.
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	addr     = flag.String("addr", ":9090", "listen address")
+	tokenTTL = flag.Int("token-ttl", 7200, "expires_in for access tokens and tickets (seconds)")
+)
+
+type department struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	ParentID int    `json:"parentid"`
+	Order    int    `json:"order"`
+}
+
+type member struct {
+	UserID     string `json:"userid"`
+	Name       string `json:"name"`
+	Department []int  `json:"department"`
+	Position   string `json:"position"`
+	Avatar     string `json:"avatar"`
+	Gender     string `json:"gender"`
+	Status     int    `json:"status"`
+}
+
+var departments = []department{
+	{ID: 1, Name: "神州云服", ParentID: 0, Order: 1},
+	{ID: 2, Name: "研发部", ParentID: 1, Order: 2},
+	{ID: 3, Name: "产品部", ParentID: 1, Order: 3},
+	{ID: 4, Name: "行政部", ParentID: 1, Order: 4},
+}
+
+var members = []member{
+	{UserID: "mock_user_001", Name: "张三", Department: []int{2}, Position: "工程师", Gender: "1", Status: 1},
+	{UserID: "lisi", Name: "李四", Department: []int{2, 3}, Position: "产品经理", Gender: "1", Status: 1},
+	{UserID: "wangwu", Name: "王五", Department: []int{3}, Position: "设计师", Gender: "2", Status: 1},
+	{UserID: "zhaoliu", Name: "赵六", Department: []int{4}, Position: "行政专员", Gender: "2", Status: 1},
+	{UserID: "qianqi", Name: "钱七", Department: []int{2}, Position: "实习生", Gender: "1", Status: 5}, // left
+}
+
+type sentMessage struct {
+	At   time.Time              `json:"at"`
+	Body map[string]interface{} `json:"body"`
+}
+
+type server struct {
+	mu       sync.Mutex
+	tokens   map[string]time.Time
+	tickets  map[string]string // user_ticket -> userid
+	messages []sentMessage
+}
+
+func main() {
+	flag.Parse()
+
+	s := &server{tokens: map[string]time.Time{}, tickets: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cgi-bin/gettoken", s.getToken)
+	mux.HandleFunc("/cgi-bin/auth/getuserinfo", s.auth(s.getUserInfo))
+	mux.HandleFunc("/cgi-bin/auth/getuserdetail", s.auth(s.getUserDetail))
+	mux.HandleFunc("/cgi-bin/user/get", s.auth(s.getUser))
+	mux.HandleFunc("/cgi-bin/user/list", s.auth(s.listUsers))
+	mux.HandleFunc("/cgi-bin/department/list", s.auth(s.listDepartments))
+	mux.HandleFunc("/cgi-bin/department/get", s.auth(s.getDepartment))
+	mux.HandleFunc("/cgi-bin/message/send", s.auth(s.sendMessage))
+	mux.HandleFunc("/cgi-bin/get_jsapi_ticket", s.auth(s.jsapiTicket))
+	mux.HandleFunc("/cgi-bin/ticket/get", s.auth(s.jsapiTicket))
+	mux.HandleFunc("/connect/oauth2/authorize", s.authorize)
+	mux.HandleFunc("/wwlogin/sso/login", s.authorize)
+	mux.HandleFunc("/mock/messages", s.listMessages)
+
+	log.Printf("WeCom mock listening on %s", *addr)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		log.Fatalf("Failed to start mock: %v", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeErr(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, map[string]interface{}{"errcode": code, "errmsg": msg})
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func findMember(userID string) *member {
+	for i := range members {
+		if members[i].UserID == userID {
+			return &members[i]
+		}
+	}
+	return nil
+}
+
+// auth rejects calls without a live access_token (40014 / 42001), like WeCom does
+func (s *server) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("access_token")
+		s.mu.Lock()
+		exp, ok := s.tokens[token]
+		s.mu.Unlock()
+		if !ok {
+			writeErr(w, 40014, "invalid access_token")
+			return
+		}
+		if time.Now().After(exp) {
+			writeErr(w, 42001, "access_token expired")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *server) getToken(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("corpid") == "" || q.Get("corpsecret") == "" {
+		writeErr(w, 40013, "invalid corpid or corpsecret")
+		return
+	}
+	token := randomHex(16)
+	s.mu.Lock()
+	s.tokens[token] = time.Now().Add(time.Duration(*tokenTTL) * time.Second)
+	s.mu.Unlock()
+	writeJSON(w, map[string]interface{}{"errcode": 0, "errmsg": "ok", "access_token": token, "expires_in": *tokenTTL})
+}
+
+func (s *server) getUserInfo(w http.ResponseWriter, r *http.Request) {
+	code := r.URL.Query().Get("code")
+	switch code {
+	case "", "bad":
+		writeErr(w, 40029, "invalid code")
+		return
+	case "external":
+		writeJSON(w, map[string]interface{}{"errcode": 0, "errmsg": "ok", "openid": "o_mock_external", "external_userid": "wm_mock_external"})
+		return
+	case "mock":
+		code = "mock_user_001"
+	}
+
+	m := findMember(code)
+	if m == nil {
+		writeErr(w, 40029, "invalid code")
+		return
+	}
+	ticket := randomHex(16)
+	s.mu.Lock()
+	s.tickets[ticket] = m.UserID
+	s.mu.Unlock()
+	writeJSON(w, map[string]interface{}{"errcode": 0, "errmsg": "ok", "userid": m.UserID, "user_ticket": ticket, "expires_in": 1800})
+}
+
+func (s *server) getUserDetail(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		UserTicket string `json:"user_ticket"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	s.mu.Lock()
+	userID, ok := s.tickets[body.UserTicket]
+	s.mu.Unlock()
+	if !ok {
+		writeErr(w, 40129, "invalid user_ticket")
+		return
+	}
+	m := findMember(userID)
+	writeJSON(w, map[string]interface{}{
+		"errcode": 0, "errmsg": "ok", "userid": m.UserID, "gender": m.Gender,
+		"avatar": "https://example.invalid/avatar/" + m.UserID + ".png",
+	})
+}
+
+func (s *server) getUser(w http.ResponseWriter, r *http.Request) {
+	m := findMember(r.URL.Query().Get("userid"))
+	if m == nil {
+		writeErr(w, 60111, "userid not found")
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"errcode": 0, "errmsg": "ok", "userid": m.UserID, "name": m.Name,
+		"department": m.Department, "position": m.Position, "avatar": m.Avatar, "status": m.Status,
+	})
+}
+
+// listUsers is user/list: direct members of department_id, or the whole
+// subtree with fetch_child=1
+func (s *server) listUsers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	id, _ := strconv.Atoi(q.Get("department_id"))
+	want := map[int]bool{id: true}
+	if q.Get("fetch_child") == "1" {
+		for changed := true; changed; {
+			changed = false
+			for _, d := range departments {
+				if want[d.ParentID] && !want[d.ID] {
+					want[d.ID], changed = true, true
+				}
+			}
+		}
+	}
+
+	list := []member{}
+	for _, m := range members {
+		for _, d := range m.Department {
+			if want[d] {
+				list = append(list, m)
+				break
+			}
+		}
+	}
+	writeJSON(w, map[string]interface{}{"errcode": 0, "errmsg": "ok", "userlist": list})
+}
+
+func (s *server) listDepartments(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{"errcode": 0, "errmsg": "ok", "department": departments})
+}
+
+func (s *server) getDepartment(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+	for _, d := range departments {
+		if d.ID == id {
+			writeJSON(w, map[string]interface{}{"errcode": 0, "errmsg": "ok", "department": d})
+			return
+		}
+	}
+	writeErr(w, 60123, "invalid department id")
+}
+
+func (s *server) sendMessage(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeErr(w, 44004, "empty content")
+		return
+	}
+	s.mu.Lock()
+	s.messages = append(s.messages, sentMessage{At: time.Now(), Body: body})
+	s.mu.Unlock()
+	log.Printf("message/send to=%v msgtype=%v", body["touser"], body["msgtype"])
+	writeJSON(w, map[string]interface{}{"errcode": 0, "errmsg": "ok", "invaliduser": "", "msgid": randomHex(8)})
+}
+
+// jsapiTicket serves both the corp ticket and ?type=agent_config
+func (s *server) jsapiTicket(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{"errcode": 0, "errmsg": "ok", "ticket": "mock_ticket_" + randomHex(8), "expires_in": *tokenTTL})
+}
+
+// authorize stands in for open.weixin.qq.com and the QR login page: it
+// redirects straight back with a code for ?userid= (default mock_user_001)
+func (s *server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Host == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	code := q.Get("userid")
+	if code == "" {
+		code = "mock"
+	}
+	rq := redirect.Query()
+	rq.Set("code", code)
+	rq.Set("state", q.Get("state"))
+	redirect.RawQuery = rq.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// listMessages lets tests assert on what the app sent
+func (s *server) listMessages(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, map[string]interface{}{"count": len(s.messages), "messages": s.messages})
+}
@@ -9,30 +9,56 @@ CREATE TABLE IF NOT EXISTS `users` (
     `id` BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
     `user_id` VARCHAR(64) NOT NULL COMMENT 'WeCom UserId',
     `name` VARCHAR(64) NOT NULL DEFAULT '' COMMENT 'Real Name',
-    `department` VARCHAR(255) NOT NULL DEFAULT '' COMMENT 'Department IDs',
+    `department` VARCHAR(1024) NOT NULL DEFAULT '' COMMENT 'JSON [{id, name}] from WeCom',
+    `position` VARCHAR(128) NOT NULL DEFAULT '' COMMENT 'Job title from WeCom',
     `avatar` VARCHAR(512) NOT NULL DEFAULT '' COMMENT 'Avatar URL',
     `chances` INT NOT NULL DEFAULT 0 COMMENT 'Available Draw Chances',
     `total_score` BIGINT NOT NULL DEFAULT 0 COMMENT 'Total Accumulated Score',
+    `profile_synced_at` DATETIME NULL COMMENT 'Last WeCom profile refresh',
+    `disabled` TINYINT(1) NOT NULL DEFAULT 0 COMMENT 'Left the company or disabled in WeCom',
     `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-    UNIQUE KEY `uk_user_id` (`user_id`)
+    UNIQUE KEY `uk_user_id` (`user_id`),
+    KEY `idx_name` (`name`),
+    KEY `idx_chances` (`chances`),
+    KEY `idx_total_score` (`total_score`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
 -- 2. Awards Configuration
 CREATE TABLE IF NOT EXISTS `awards` (
     `id` INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
     `name` VARCHAR(64) NOT NULL COMMENT 'Prize Name',
-    `type` TINYINT NOT NULL COMMENT '1=Grand, 2=Regular, 3=Sunshine',
+    `type` TINYINT NOT NULL COMMENT '1=Grand, 2=Prize, 3=Blessing, 4=Points, 5=Chances, 6=Vacation Card',
     `total_count` INT NOT NULL COMMENT 'Initial Inventory',
     `remaining` INT NOT NULL COMMENT 'Current Inventory',
     `probability` INT NOT NULL DEFAULT 0 COMMENT 'Weight (out of 10000)',
-    `value` INT NOT NULL DEFAULT 0 COMMENT 'Point value for type=4',
+    `value` INT NOT NULL DEFAULT 0 COMMENT 'Points (type=4) or chances (type=5) granted',
     `image_url` VARCHAR(255) DEFAULT '',
+    `thumb_url` VARCHAR(255) DEFAULT '' COMMENT 'Downscaled image_url for lists',
     `version` INT NOT NULL DEFAULT 0 COMMENT 'Optimistic Lock',
+    `retired` TINYINT(1) NOT NULL DEFAULT 0 COMMENT 'Retired awards are never drawn',
     `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
+-- 2.1 Award Revisions (Configuration History)
+CREATE TABLE IF NOT EXISTS `award_revisions` (
+    `id` BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    `award_id` INT UNSIGNED NOT NULL,
+    `revision` INT NOT NULL,
+    `action` VARCHAR(16) NOT NULL COMMENT 'create, update, retire, migrate',
+    `name` VARCHAR(64) NOT NULL,
+    `type` TINYINT NOT NULL,
+    `total_count` INT NOT NULL,
+    `probability` INT NOT NULL,
+    `value` INT NOT NULL,
+    `image_url` VARCHAR(255) DEFAULT '',
+    `retired` TINYINT(1) NOT NULL DEFAULT 0,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    KEY `idx_award_id` (`award_id`),
+    KEY `idx_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
 -- 3. Game Records
 CREATE TABLE IF NOT EXISTS `game_records` (
     `id` BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
@@ -55,11 +81,17 @@ CREATE TABLE IF NOT EXISTS `draw_records` (
     `user_id` VARCHAR(64) NOT NULL,
     `award_id` INT UNSIGNED NOT NULL,
     `award_name` VARCHAR(64) NOT NULL,
+    `blessing_id` INT UNSIGNED NOT NULL DEFAULT 0 COMMENT 'Blessing picked for blessing awards',
+    `message` VARCHAR(255) NOT NULL DEFAULT '' COMMENT 'Rendered blessing message',
     `prev_hash` VARCHAR(64) NOT NULL DEFAULT '' COMMENT 'Hash of previous record',
     `data_hash` VARCHAR(64) NOT NULL COMMENT 'Hash of this record data',
     `final_hash` VARCHAR(64) NOT NULL COMMENT 'Combined Chain Hash',
+    `redeem_secret` VARCHAR(16) NOT NULL DEFAULT '' COMMENT 'Random half of the redemption code, outside the chain',
     `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    KEY `idx_user_id` (`user_id`)
+    KEY `idx_user_id` (`user_id`),
+    KEY `idx_award_id` (`award_id`),
+    KEY `idx_redeem_secret` (`redeem_secret`),
+    KEY `idx_created_at` (`created_at`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
 -- Initial Awards Data (2026 Mystery Edition)
@@ -67,8 +99,194 @@ INSERT INTO `awards` (`name`, `type`, `total_count`, `remaining`, `probability`,
 ('一等奖：神秘大奖', 1, 1, 1, 1, 0, ''),
 ('二等奖：神秘大奖', 1, 1, 1, 5, 0, ''),
 ('三等奖：神秘大奖', 2, 1, 1, 10, 0, ''),
-('休假奖励卡', 2, 1, 1, 600, 0, ''),
+('休假奖励卡', 6, 1, 1, 600, 0, ''),
 ('幸运奖：1000 积分', 4, 100, 100, 500, 1000, ''),
 ('幸运奖：500 积分', 4, 500, 500, 1500, 500, ''),
 ('幸运奖：100 积分', 4, 1000, 1000, 4500, 100, ''),
 ('新春快乐：马到成功', 3, 99999, 99999, 2884, 0, '');
+
+-- Baseline revision for the seeded awards
+INSERT INTO `award_revisions` (`award_id`, `revision`, `action`, `name`, `type`, `total_count`, `probability`, `value`, `image_url`, `retired`)
+SELECT `id`, 1, 'create', `name`, `type`, `total_count`, `probability`, `value`, `image_url`, `retired` FROM `awards`;
+
+-- 5. Draw Checkpoints (Hourly Merkle Anchor)
+CREATE TABLE IF NOT EXISTS `draw_checkpoints` (
+    `id` BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    `period_start` DATETIME NOT NULL COMMENT 'Start of anchored hour',
+    `period_end` DATETIME NOT NULL,
+    `first_record_id` BIGINT UNSIGNED NOT NULL,
+    `last_record_id` BIGINT UNSIGNED NOT NULL,
+    `leaf_count` INT NOT NULL,
+    `merkle_root` VARCHAR(64) NOT NULL COMMENT 'Merkle root over final_hash',
+    `published_to` VARCHAR(32) NOT NULL DEFAULT '' COMMENT 'Sink the root was published to',
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY `uk_period_start` (`period_start`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 6. Blessings (Random messages for blessing awards)
+CREATE TABLE IF NOT EXISTS `blessings` (
+    `id` INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    `template` VARCHAR(255) NOT NULL COMMENT 'Supports {name} and {department}',
+    `weight` INT NOT NULL DEFAULT 1,
+    `enabled` TINYINT(1) NOT NULL DEFAULT 1,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+INSERT INTO `blessings` (`template`, `weight`) VALUES
+('龙马精神，岁岁平安', 10),
+('马到成功，前程似锦', 10),
+('万马奔腾，财源滚滚', 10),
+('一马当先，步步高升', 10),
+('策马扬鞭，扬帆起航', 10),
+('骏马奔腾，福星高照', 10),
+('{name}，马年吉祥，福气满盈', 10),
+('祝{department}的{name}新春快乐，万事如意', 10);
+
+-- 7. WeCom App Message Queue / Send Log
+CREATE TABLE IF NOT EXISTS `notifications` (
+    `id` BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    `kind` VARCHAR(32) NOT NULL COMMENT 'prize_win, chance_reminder, leaderboard_frozen, broadcast',
+    `dedup_key` VARCHAR(128) NOT NULL,
+    `to_user` TEXT COMMENT '| separated userids or @all',
+    `to_party` VARCHAR(1024) NOT NULL DEFAULT '',
+    `msg_type` VARCHAR(32) NOT NULL,
+    `payload` TEXT COMMENT 'JSON body of the msgtype field',
+    `status` VARCHAR(16) NOT NULL COMMENT 'pending, sending, sent, failed',
+    `attempts` INT NOT NULL DEFAULT 0,
+    `next_attempt_at` DATETIME NOT NULL,
+    `last_error` VARCHAR(512) NOT NULL DEFAULT '',
+    `msg_id` VARCHAR(128) NOT NULL DEFAULT '',
+    `invalid_user` VARCHAR(1024) NOT NULL DEFAULT '',
+    `created_by` VARCHAR(64) NOT NULL DEFAULT '',
+    `sent_at` DATETIME NULL,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY `uk_dedup_key` (`dedup_key`),
+    INDEX `idx_kind` (`kind`),
+    INDEX `idx_status` (`status`),
+    INDEX `idx_next_attempt_at` (`next_attempt_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 8. Departments (WeCom org chart, kept by cmd/orgsync)
+CREATE TABLE IF NOT EXISTS `departments` (
+    `id` INT UNSIGNED PRIMARY KEY COMMENT 'WeCom department id',
+    `name` VARCHAR(64) NOT NULL,
+    `parent_id` INT UNSIGNED NOT NULL DEFAULT 0,
+    `sort_order` INT NOT NULL DEFAULT 0,
+    `member_count` INT NOT NULL DEFAULT 0 COMMENT 'Direct members at the last sync',
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX `idx_parent_id` (`parent_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 9. Admin Accounts (WeCom user id and/or local bcrypt password, one role each)
+CREATE TABLE IF NOT EXISTS `admin_accounts` (
+    `id` BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    `username` VARCHAR(64) NOT NULL,
+    `name` VARCHAR(64) NOT NULL DEFAULT '',
+    `wecom_user_id` VARCHAR(64) NOT NULL DEFAULT '',
+    `password_hash` VARCHAR(100) NOT NULL DEFAULT '' COMMENT 'bcrypt; empty disables local login',
+    `role` VARCHAR(32) NOT NULL COMMENT 'viewer, prize-fulfiller, operator, super-admin, auditor',
+    `disabled` TINYINT(1) NOT NULL DEFAULT 0,
+    `last_login_at` DATETIME NULL,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY `uk_username` (`username`),
+    INDEX `idx_wecom_user_id` (`wecom_user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 10. Prize Redemptions (offline hand-outs, checked against draw records)
+CREATE TABLE IF NOT EXISTS `prize_redemptions` (
+    `id` BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    `draw_record_id` BIGINT UNSIGNED NOT NULL,
+    `user_id` VARCHAR(64) NOT NULL,
+    `award_name` VARCHAR(64) NOT NULL,
+    `redeemed_by` VARCHAR(64) NOT NULL COMMENT 'Admin username',
+    `note` VARCHAR(255) NOT NULL DEFAULT '',
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY `uk_draw_record_id` (`draw_record_id`),
+    INDEX `idx_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 11. Admin Audit (append-only, hash-chained like draw_records)
+CREATE TABLE IF NOT EXISTS `admin_audit` (
+    `id` BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    `actor_id` BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT 'Admin account id, 0 for the CLI',
+    `actor` VARCHAR(64) NOT NULL,
+    `action` VARCHAR(64) NOT NULL COMMENT 'e.g. awards.update',
+    `params` TEXT NOT NULL COMMENT 'JSON: path, query and body, secrets redacted',
+    `ip` VARCHAR(45) NOT NULL DEFAULT '',
+    `user_agent` VARCHAR(255) NOT NULL DEFAULT '',
+    `status` INT NOT NULL COMMENT 'HTTP status of the response, 0 for adminctl and approved operations',
+    `outcome` VARCHAR(16) NOT NULL COMMENT 'success, denied or failure',
+    `error` VARCHAR(255) NOT NULL DEFAULT '',
+    `prev_hash` VARCHAR(64) NOT NULL,
+    `data_hash` VARCHAR(64) NOT NULL,
+    `final_hash` VARCHAR(64) NOT NULL,
+    `created_at` DATETIME NOT NULL,
+    INDEX `idx_actor` (`actor`),
+    INDEX `idx_action` (`action`),
+    INDEX `idx_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 12. Admin Approvals (two-person rule for resets, grand prize stock, large chance grants)
+CREATE TABLE IF NOT EXISTS `admin_approvals` (
+    `id` BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    `operation` VARCHAR(64) NOT NULL COMMENT 'data.reset, data.restore, awards.create, awards.update, chances.grant',
+    `params` TEXT NOT NULL COMMENT 'JSON the operation runs with',
+    `summary` VARCHAR(255) NOT NULL DEFAULT '',
+    `status` VARCHAR(16) NOT NULL COMMENT 'pending, approved, executed, failed, rejected, expired',
+    `proposed_by_id` BIGINT UNSIGNED NOT NULL,
+    `proposed_by` VARCHAR(64) NOT NULL,
+    `decided_by_id` BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    `decided_by` VARCHAR(64) NOT NULL DEFAULT '',
+    `note` VARCHAR(255) NOT NULL DEFAULT '' COMMENT 'Reason given when approving or rejecting',
+    `result` TEXT NULL COMMENT 'JSON result, or the error if it failed',
+    `expires_at` DATETIME NOT NULL,
+    `decided_at` DATETIME NULL,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX `idx_status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 13. Voided Draws (test users' draws, kept in the chain but out of play)
+CREATE TABLE IF NOT EXISTS `voided_draws` (
+    `id` BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    `draw_record_id` BIGINT UNSIGNED NOT NULL,
+    `user_id` VARCHAR(64) NOT NULL,
+    `award_id` INT UNSIGNED NOT NULL,
+    `reason` VARCHAR(255) NOT NULL DEFAULT '',
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY `uk_draw_record_id` (`draw_record_id`),
+    INDEX `idx_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 14. Reset Snapshots (gzipped JSONL files under Reset.SnapshotDir)
+CREATE TABLE IF NOT EXISTS `reset_snapshots` (
+    `id` BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    `reason` VARCHAR(64) NOT NULL COMMENT 'e.g. reset:all, restore:12, manual',
+    `file` VARCHAR(255) NOT NULL,
+    `sha256` VARCHAR(64) NOT NULL,
+    `size` BIGINT NOT NULL,
+    `rows` VARCHAR(1024) NOT NULL DEFAULT '' COMMENT 'JSON row count per table',
+    `created_by` VARCHAR(128) NOT NULL,
+    `restored_at` DATETIME NULL,
+    `restored_by` VARCHAR(128) NOT NULL DEFAULT '',
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 15. Balance Adjustments (ledger of manual chance and points changes)
+CREATE TABLE IF NOT EXISTS `balance_adjustments` (
+    `id` BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    `user_id` VARCHAR(64) NOT NULL,
+    `kind` VARCHAR(16) NOT NULL COMMENT 'chances or points',
+    `delta` BIGINT NOT NULL,
+    `balance` BIGINT NOT NULL COMMENT 'Chances or total score after the change',
+    `reason` VARCHAR(255) NOT NULL,
+    `actor` VARCHAR(128) NOT NULL,
+    `batch_id` VARCHAR(32) NOT NULL DEFAULT '' COMMENT 'Set for CSV uploads',
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX `idx_user_id` (`user_id`),
+    INDEX `idx_batch_id` (`batch_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
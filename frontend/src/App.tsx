@@ -1,7 +1,7 @@
 import React from 'react';
 import { BrowserRouter as Router, Routes, Route, useNavigate } from 'react-router-dom';
 import { useUserStore } from './store/userStore';
-import api from './services/api';
+import { fetchSession } from './services/api';
 import Home from './pages/Home';
 import Game from './pages/Game';
 import Draw from './pages/Draw';
@@ -10,32 +10,26 @@ import Rank from './pages/Rank';
 import Admin from './pages/Admin';
 import { useEffect } from 'react';
 
+const loginErrors: Record<string, string> = {
+  not_member: '本活动仅限公司员工参与',
+  invalid_code: '登录已过期，请重新进入',
+  invalid_state: '登录链接已失效，请重新登录',
+  cancelled: '已取消登录',
+};
+
+// The backend finishes WeCom OAuth at /auth/wecom/callback and sets the
+// session cookie; only failures land here, with ?error=
 const LoginCallback = () => {
   const navigate = useNavigate();
-  const setToken = useUserStore((state) => state.setToken);
-  const setUser = useUserStore((state) => state.setUser);
 
   useEffect(() => {
-    const params = new URLSearchParams(window.location.search);
-    const code = params.get('code');
-    if (code) {
-      api.get(`/user/login?code=${code}`)
-        .then(res => {
-          const { token, user } = res.data;
-          setToken(token);
-          setUser(user);
-          navigate('/');
-        })
-        .catch(err => {
-          console.error('Login failed', err);
-          alert('登录失败，请重试');
-          navigate('/');
-        });
-    } else {
-      // Redirect to home if no code
-      navigate('/');
+    const error = new URLSearchParams(window.location.search).get('error');
+    if (error) {
+      console.error('Login failed', error);
+      alert(loginErrors[error] || '登录失败，请重试');
     }
-  }, [navigate, setToken, setUser]);
+    navigate('/', { replace: true });
+  }, [navigate]);
 
   return <div className="text-white text-center mt-20 flex flex-col items-center">
     <div className="text-4xl animate-spin mb-4">🏮</div>
@@ -53,6 +47,13 @@ const Layout = ({ children }: { children: React.ReactNode }) => {
 };
 
 function App() {
+  const setUser = useUserStore((state) => state.setUser);
+
+  // Pick up an existing cookie session; anonymous visitors just see the login button
+  useEffect(() => {
+    fetchSession().then(setUser).catch(() => {});
+  }, [setUser]);
+
   return (
     <Router>
       <Routes>
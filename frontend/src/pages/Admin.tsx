@@ -1,4 +1,4 @@
-import { useState } from 'react';
+import { useEffect, useState } from 'react';
 import api from '../services/api';
 import LevelBadge from '../components/LevelBadge';
 
@@ -6,6 +6,7 @@ interface AdminUser {
     id: number;
     user_id: string;
     name: string;
+    department: string;
     score: number;
     chances: number;
     level: number;
@@ -16,30 +17,107 @@ interface AdminDrawRecord {
     id: number;
     user_id: string;
     name: string;
+    award_id: number;
+    award_type: number;
     award_name: string;
+    voided: boolean;
     created_at: string;
     data_hash: string;
 }
 
+// Query parameters for GET /admin/users and GET /admin/draws; empty values are dropped
+type Filters = Record<string, string>;
+
+const compact = (f: Filters) => Object.fromEntries(Object.entries(f).filter(([, v]) => v !== ''));
+
+interface AdminApproval {
+    id: number;
+    operation: string;
+    summary: string;
+    status: string;
+    proposed_by: string;
+    expires_at: string;
+    created_at: string;
+}
+
 const Admin = () => {
-    const [secret, setSecret] = useState('');
+    const [username, setUsername] = useState('');
+    const [password, setPassword] = useState('');
     const [isAuthed, setIsAuthed] = useState(false);
+    const [permissions, setPermissions] = useState<string[]>([]);
     const [users, setUsers] = useState<AdminUser[]>([]);
     const [draws, setDraws] = useState<AdminDrawRecord[]>([]);
+    const [userFilters, setUserFilters] = useState<Filters>({ name: '', department: '', min_score: '', max_score: '', min_chances: '', sort: 'score', order: 'desc' });
+    const [drawFilters, setDrawFilters] = useState<Filters>({ user_id: '', type: '', since: '', until: '' });
+    const [userCursor, setUserCursor] = useState('');
+    const [exportFormat, setExportFormat] = useState<'xlsx' | 'csv'>('xlsx');
+    const [drawCursor, setDrawCursor] = useState('');
+    const [approvals, setApprovals] = useState<AdminApproval[]>([]);
+    const [me, setMe] = useState('');
     const [loading, setLoading] = useState(false);
-    const [activeTab, setActiveTab] = useState<'users' | 'draws'>('users');
+    const [activeTab, setActiveTab] = useState<'users' | 'draws' | 'approvals'>('users');
+
+    // Lists come a page at a time; a cursor loads the next page onto the current one
+    const loadUsers = async (cursor = '') => {
+        const res = await api.get('/admin/users', { params: { ...compact(userFilters), cursor: cursor || undefined } });
+        const page: AdminUser[] = res.data.data || [];
+        setUsers(prev => (cursor ? [...prev, ...page] : page));
+        setUserCursor(res.data.next_cursor || '');
+    };
+
+    const loadDraws = async (cursor = '') => {
+        // datetime-local inputs have no zone; send them as RFC3339
+        const { since, until, ...rest } = drawFilters;
+        const params: Filters = compact(rest);
+        if (since) params.since = new Date(since).toISOString();
+        if (until) params.until = new Date(until).toISOString();
+        const res = await api.get('/admin/draws', { params: { ...params, cursor: cursor || undefined } });
+        const page: AdminDrawRecord[] = res.data.data || [];
+        setDraws(prev => (cursor ? [...prev, ...page] : page));
+        setDrawCursor(res.data.next_cursor || '');
+    };
+
+    const loadData = async () => {
+        const [approvalRes] = await Promise.all([
+            api.get('/admin/approvals', { params: { status: 'pending' } }),
+            loadUsers(),
+            loadDraws()
+        ]);
+        setApprovals(approvalRes.data.data || []);
+    };
+
+    const runQuery = async (load: () => Promise<void>) => {
+        setLoading(true);
+        try {
+            await load();
+        } catch (err: any) {
+            alert(err.response?.data?.error || '查询失败');
+        } finally {
+            setLoading(false);
+        }
+    };
+
+    const enterConsole = async (profile: { account: { username: string }, permissions: string[] }) => {
+        setMe(profile.account?.username || '');
+        setPermissions(profile.permissions || []);
+        await loadData();
+        setIsAuthed(true);
+    };
+
+    // A console session, or a WeCom login bound to an admin account, lets us straight in
+    useEffect(() => {
+        api.get('/admin/me')
+            .then(res => enterConsole(res.data.data))
+            .catch(() => { /* show the login form */ });
+    }, []);
 
     const handleLogin = async (e: any) => {
         e.preventDefault();
         setLoading(true);
         try {
-            const [userRes, drawRes] = await Promise.all([
-                api.get('/admin/users', { headers: { 'X-Admin-Secret': secret } }),
-                api.get('/admin/draws', { headers: { 'X-Admin-Secret': secret } })
-            ]);
-            setUsers(userRes.data.data || []);
-            setDraws(drawRes.data.data || []);
-            setIsAuthed(true);
+            const res = await api.post('/admin/login', { username, password });
+            setPassword('');
+            await enterConsole(res.data.data);
         } catch (err: any) {
             alert(err.response?.data?.error || '登录失败');
         } finally {
@@ -47,42 +125,39 @@ const Admin = () => {
         }
     };
 
-    const handleExportUsers = () => {
-        if (users.length === 0) return;
-        const headers = ['ID', 'WeComID', '姓名', '总得分', '抽奖次数', '等级', '注册时间'];
-        const csvRows = [headers.join(',')];
-        users.forEach((u: AdminUser) => {
-            csvRows.push([u.id, u.user_id, u.name, u.score, u.chances, u.level, u.created_at].join(','));
-        });
-        downloadCSV(csvRows.join('\n'), `happynewyear_users_${new Date().toISOString().slice(0, 10)}.csv`);
-    };
-
-    const handleExportDraws = () => {
-        if (draws.length === 0) return;
-        const headers = ['ID', 'WeComID', '姓名', '奖品', '时间', '审计哈希'];
-        const csvRows = [headers.join(',')];
-        draws.forEach((d: AdminDrawRecord) => {
-            csvRows.push([d.id, d.user_id, d.name, d.award_name, d.created_at, d.data_hash].join(','));
-        });
-        downloadCSV(csvRows.join('\n'), `happynewyear_draws_${new Date().toISOString().slice(0, 10)}.csv`);
+    // Exports stream from the server and cover every row, not just the loaded pages.
+    // The session cookie authenticates the download.
+    const handleExport = (kind: string) => {
+        const params = new URLSearchParams({ format: exportFormat });
+        // The draw tab's filters carry over to the draw-based exports
+        if (kind !== 'users') {
+            if (drawFilters.since) params.set('since', new Date(drawFilters.since).toISOString());
+            if (drawFilters.until) params.set('until', new Date(drawFilters.until).toISOString());
+        }
+        if (kind === 'draws' || kind === 'winners') {
+            if (drawFilters.type) params.set('type', drawFilters.type);
+        }
+        window.location.href = `/api/admin/exports/${kind}?${params}`;
     };
 
     const handleResetData = async () => {
-        if (!window.confirm('警告：此操作将清除所有用户分数、抽奖机会和中奖记录。此操作不可逆，确定要继续吗？')) {
+        const scope = window.prompt('重置范围：all（全部数据）、test_users（测试用户）或 inventory（仅库存）', 'all');
+        if (!scope) return;
+        let userIds: string[] = [];
+        if (scope === 'test_users') {
+            const ids = window.prompt('测试用户的企业微信 ID，用逗号分隔（留空使用配置中的列表）', '');
+            if (ids === null) return;
+            userIds = ids.split(',').map(id => id.trim()).filter(Boolean);
+        }
+        if (!window.confirm('重置前会自动保存完整快照，可随时恢复。确定提交重置申请吗？')) {
             return;
         }
 
         setLoading(true);
         try {
-            await api.post('/admin/reset', {}, { headers: { 'X-Admin-Secret': secret } });
-            alert('数据已成功重置！');
-            // Refresh data
-            const [userRes, drawRes] = await Promise.all([
-                api.get('/admin/users', { headers: { 'X-Admin-Secret': secret } }),
-                api.get('/admin/draws', { headers: { 'X-Admin-Secret': secret } })
-            ]);
-            setUsers(userRes.data.data || []);
-            setDraws(drawRes.data.data || []);
+            await api.post('/admin/reset', { scope, user_ids: userIds });
+            alert('重置申请已提交，需另一位管理员在审批列表中批准后才会执行。');
+            await loadData();
         } catch (err: any) {
             alert(err.response?.data?.error || '重置失败');
         } finally {
@@ -90,16 +165,54 @@ const Admin = () => {
         }
     };
 
+    // Approve runs the operation right away; the result comes back on the approval
+    const handleDecide = async (a: AdminApproval, decision: 'approve' | 'reject') => {
+        const note = window.prompt(decision === 'approve' ? `批准并立即执行：${a.summary}\n备注（可选）：` : `驳回：${a.summary}\n原因：`);
+        if (note === null) return;
+
+        setLoading(true);
+        try {
+            const res = await api.post(`/admin/approvals/${a.id}/${decision}`, { note });
+            const status = res.data.data?.status;
+            if (status === 'failed') {
+                alert(`已批准，但执行失败：${res.data.data.result}`);
+            } else {
+                alert(decision === 'approve' ? '已批准并执行' : '已驳回');
+            }
+            await loadData();
+        } catch (err: any) {
+            alert(err.response?.data?.error || '操作失败');
+        } finally {
+            setLoading(false);
+        }
+    };
+
     if (!isAuthed) {
         return (
             <div className="flex items-center justify-center min-h-screen bg-gray-900 text-white p-4">
                 <form onSubmit={handleLogin} className="bg-gray-800 p-8 rounded-2xl shadow-xl w-full max-w-sm">
                     <h2 className="text-2xl font-bold mb-6 text-center">管理后台登录</h2>
+                    <a
+                        href="/auth/wecom?redirect=/admin"
+                        className="block w-full text-center bg-green-600 hover:bg-green-700 py-3 rounded-lg font-bold transition-colors mb-6"
+                    >
+                        企业微信登录
+                    </a>
+                    <input
+                        type="text"
+                        value={username}
+                        onChange={(e) => setUsername(e.target.value)}
+                        placeholder="用户名"
+                        autoComplete="username"
+                        className="w-full bg-gray-700 border border-gray-600 rounded-lg px-4 py-3 mb-4 focus:ring-2 focus:ring-blue-500 outline-none"
+                        required
+                    />
                     <input
                         type="password"
-                        value={secret}
-                        onChange={(e) => setSecret(e.target.value)}
-                        placeholder="请输入管理员密钥"
+                        value={password}
+                        onChange={(e) => setPassword(e.target.value)}
+                        placeholder="密码"
+                        autoComplete="current-password"
                         className="w-full bg-gray-700 border border-gray-600 rounded-lg px-4 py-3 mb-4 focus:ring-2 focus:ring-blue-500 outline-none"
                         required
                     />
@@ -108,7 +221,7 @@ const Admin = () => {
                         disabled={loading}
                         className="w-full bg-blue-600 hover:bg-blue-700 disabled:opacity-50 py-3 rounded-lg font-bold transition-colors"
                     >
-                        {loading ? '验证中...' : '登录'}
+                        {loading ? '验证中...' : '账号密码登录'}
                     </button>
                 </form>
             </div>
@@ -126,47 +239,95 @@ const Admin = () => {
                                 onClick={() => setActiveTab('users')}
                                 className={`pb-2 px-1 font-bold transition-all ${activeTab === 'users' ? 'text-blue-600 border-b-4 border-blue-600' : 'text-gray-400'}`}
                             >
-                                参与人员 ({users.length})
+                                参与人员 ({users.length}{userCursor ? '+' : ''})
                             </button>
                             <button
                                 onClick={() => setActiveTab('draws')}
                                 className={`pb-2 px-1 font-bold transition-all ${activeTab === 'draws' ? 'text-blue-600 border-b-4 border-blue-600' : 'text-gray-400'}`}
                             >
-                                抽奖记录 ({draws.length})
+                                抽奖记录 ({draws.length}{drawCursor ? '+' : ''})
+                            </button>
+                            <button
+                                onClick={() => setActiveTab('approvals')}
+                                className={`pb-2 px-1 font-bold transition-all ${activeTab === 'approvals' ? 'text-blue-600 border-b-4 border-blue-600' : 'text-gray-400'}`}
+                            >
+                                待审批 ({approvals.length})
                             </button>
                         </div>
                     </div>
                     {activeTab === 'users' ? (
                         <div className="flex gap-2">
+                            {permissions.includes('manage') && (
+                                <button
+                                    onClick={handleResetData}
+                                    disabled={loading}
+                                    className="bg-red-600 hover:bg-red-700 text-white px-4 py-2 rounded-lg font-bold shadow-md transition-all flex items-center text-sm"
+                                >
+                                    <span className="mr-2">🧹</span> 重置数据
+                                </button>
+                            )}
+                            <select value={exportFormat} onChange={(e) => setExportFormat(e.target.value as 'xlsx' | 'csv')} className="border rounded-lg px-2 text-sm">
+                                <option value="xlsx">Excel</option>
+                                <option value="csv">CSV</option>
+                            </select>
                             <button
-                                onClick={handleResetData}
-                                disabled={loading}
-                                className="bg-red-600 hover:bg-red-700 text-white px-4 py-2 rounded-lg font-bold shadow-md transition-all flex items-center text-sm"
-                            >
-                                <span className="mr-2">🧹</span> 重置数据
-                            </button>
-                            <button
-                                onClick={handleExportUsers}
+                                onClick={() => handleExport('users')}
                                 className="bg-green-600 hover:bg-green-700 text-white px-6 py-2 rounded-lg font-bold shadow-md transition-all flex items-center"
                             >
                                 <span className="mr-2">📊</span> 导出人员数据
                             </button>
-                        </div>
-                    ) : (
-                        <div className="flex gap-2">
                             <button
-                                onClick={handleResetData}
-                                disabled={loading}
-                                className="bg-red-600 hover:bg-red-700 text-white px-4 py-2 rounded-lg font-bold shadow-md transition-all flex items-center text-sm"
+                                onClick={() => handleExport('departments')}
+                                className="bg-green-600 hover:bg-green-700 text-white px-4 py-2 rounded-lg font-bold shadow-md transition-all flex items-center text-sm"
                             >
-                                <span className="mr-2">🧹</span> 重置数据
+                                部门参与情况
                             </button>
+                            {permissions.includes('audit_bundle') && (
+                                <button
+                                    onClick={() => { window.location.href = '/api/admin/audit/bundle?format=zip'; }}
+                                    className="bg-gray-700 hover:bg-gray-800 text-white px-4 py-2 rounded-lg font-bold shadow-md transition-all flex items-center text-sm"
+                                >
+                                    审计包
+                                </button>
+                            )}
+                        </div>
+                    ) : activeTab === 'approvals' ? null : (
+                        <div className="flex gap-2">
+                            {permissions.includes('manage') && (
+                                <button
+                                    onClick={handleResetData}
+                                    disabled={loading}
+                                    className="bg-red-600 hover:bg-red-700 text-white px-4 py-2 rounded-lg font-bold shadow-md transition-all flex items-center text-sm"
+                                >
+                                    <span className="mr-2">🧹</span> 重置数据
+                                </button>
+                            )}
+                            <select value={exportFormat} onChange={(e) => setExportFormat(e.target.value as 'xlsx' | 'csv')} className="border rounded-lg px-2 text-sm">
+                                <option value="xlsx">Excel</option>
+                                <option value="csv">CSV</option>
+                            </select>
                             <button
-                                onClick={handleExportDraws}
+                                onClick={() => handleExport('draws')}
                                 className="bg-purple-600 hover:bg-purple-700 text-white px-6 py-2 rounded-lg font-bold shadow-md transition-all flex items-center"
                             >
                                 <span className="mr-2">📝</span> 导出抽奖记录
                             </button>
+                            {permissions.includes('redeem') && (
+                                <>
+                                    <button
+                                        onClick={() => handleExport('winners')}
+                                        className="bg-purple-600 hover:bg-purple-700 text-white px-4 py-2 rounded-lg font-bold shadow-md transition-all flex items-center text-sm"
+                                    >
+                                        中奖名单
+                                    </button>
+                                    <button
+                                        onClick={() => handleExport('fulfillment')}
+                                        className="bg-purple-600 hover:bg-purple-700 text-white px-4 py-2 rounded-lg font-bold shadow-md transition-all flex items-center text-sm"
+                                    >
+                                        发放状态
+                                    </button>
+                                </>
+                            )}
                         </div>
                     )}
                 </div>
@@ -174,6 +335,27 @@ const Admin = () => {
                 <div className="bg-white rounded-xl shadow-sm border border-gray-200 overflow-hidden">
                     {activeTab === 'users' ? (
                         <div className="overflow-x-auto">
+                            <form
+                                onSubmit={(e) => { e.preventDefault(); runQuery(() => loadUsers()); }}
+                                className="flex flex-wrap gap-2 p-4 border-b border-gray-200 text-sm"
+                            >
+                                <input value={userFilters.name} onChange={(e) => setUserFilters({ ...userFilters, name: e.target.value })} placeholder="姓名或企业微信 ID" className="border rounded-lg px-3 py-1" />
+                                <input value={userFilters.department} onChange={(e) => setUserFilters({ ...userFilters, department: e.target.value })} placeholder="部门" className="border rounded-lg px-3 py-1" />
+                                <input type="number" value={userFilters.min_score} onChange={(e) => setUserFilters({ ...userFilters, min_score: e.target.value })} placeholder="最低分" className="border rounded-lg px-3 py-1 w-24" />
+                                <input type="number" value={userFilters.max_score} onChange={(e) => setUserFilters({ ...userFilters, max_score: e.target.value })} placeholder="最高分" className="border rounded-lg px-3 py-1 w-24" />
+                                <input type="number" value={userFilters.min_chances} onChange={(e) => setUserFilters({ ...userFilters, min_chances: e.target.value })} placeholder="最少次数" className="border rounded-lg px-3 py-1 w-24" />
+                                <select value={userFilters.sort} onChange={(e) => setUserFilters({ ...userFilters, sort: e.target.value })} className="border rounded-lg px-3 py-1">
+                                    <option value="score">按总分</option>
+                                    <option value="chances">按剩余次数</option>
+                                    <option value="name">按姓名</option>
+                                    <option value="created">按注册时间</option>
+                                </select>
+                                <select value={userFilters.order} onChange={(e) => setUserFilters({ ...userFilters, order: e.target.value })} className="border rounded-lg px-3 py-1">
+                                    <option value="desc">降序</option>
+                                    <option value="asc">升序</option>
+                                </select>
+                                <button type="submit" disabled={loading} className="bg-blue-600 hover:bg-blue-700 text-white px-4 py-1 rounded-lg font-bold">查询</button>
+                            </form>
                             <table className="w-full text-left">
                                 <thead className="bg-gray-50 border-b border-gray-200">
                                     <tr>
@@ -189,6 +371,7 @@ const Admin = () => {
                                             <td className="px-6 py-4">
                                                 <div className="font-bold">{u.name}</div>
                                                 <div className="text-xs text-gray-400 font-mono tracking-tighter">{u.user_id}</div>
+                                                {u.department && <div className="text-xs text-gray-400">{u.department}</div>}
                                             </td>
                                             <td className="px-6 py-4">
                                                 <div className="flex gap-4">
@@ -212,9 +395,86 @@ const Admin = () => {
                                     ))}
                                 </tbody>
                             </table>
+                            {userCursor && (
+                                <button onClick={() => runQuery(() => loadUsers(userCursor))} disabled={loading} className="w-full py-3 text-sm font-bold text-blue-600 hover:bg-gray-50">
+                                    {loading ? '加载中...' : '加载更多'}
+                                </button>
+                            )}
+                        </div>
+                    ) : activeTab === 'approvals' ? (
+                        <div className="overflow-x-auto">
+                            <table className="w-full text-left">
+                                <thead className="bg-gray-50 border-b border-gray-200">
+                                    <tr>
+                                        <th className="px-6 py-4 text-xs font-semibold text-gray-500 uppercase tracking-wider">操作</th>
+                                        <th className="px-6 py-4 text-xs font-semibold text-gray-500 uppercase tracking-wider">申请人</th>
+                                        <th className="px-6 py-4 text-xs font-semibold text-gray-500 uppercase tracking-wider">截止时间</th>
+                                        <th className="px-6 py-4 text-xs font-semibold text-gray-500 uppercase tracking-wider"></th>
+                                    </tr>
+                                </thead>
+                                <tbody className="divide-y divide-gray-100">
+                                    {approvals.length === 0 && (
+                                        <tr>
+                                            <td colSpan={4} className="px-6 py-8 text-center text-gray-400">暂无待审批操作</td>
+                                        </tr>
+                                    )}
+                                    {approvals.map(a => (
+                                        <tr key={a.id} className="hover:bg-gray-50 transition-colors">
+                                            <td className="px-6 py-4">
+                                                <div className="font-bold">{a.summary}</div>
+                                                <div className="text-xs text-gray-400 font-mono">{a.operation}</div>
+                                            </td>
+                                            <td className="px-6 py-4 text-sm">{a.proposed_by}</td>
+                                            <td className="px-6 py-4 text-sm text-gray-500 whitespace-nowrap">
+                                                {new Date(a.expires_at).toLocaleString()}
+                                            </td>
+                                            <td className="px-6 py-4 whitespace-nowrap">
+                                                {permissions.includes('operate') && (
+                                                    <div className="flex gap-2">
+                                                        {a.proposed_by !== me && (
+                                                            <button
+                                                                onClick={() => handleDecide(a, 'approve')}
+                                                                disabled={loading}
+                                                                className="bg-green-600 hover:bg-green-700 text-white px-3 py-1 rounded-lg text-sm font-bold"
+                                                            >
+                                                                批准
+                                                            </button>
+                                                        )}
+                                                        <button
+                                                            onClick={() => handleDecide(a, 'reject')}
+                                                            disabled={loading}
+                                                            className="bg-gray-200 hover:bg-gray-300 text-gray-700 px-3 py-1 rounded-lg text-sm font-bold"
+                                                        >
+                                                            {a.proposed_by === me ? '撤回' : '驳回'}
+                                                        </button>
+                                                    </div>
+                                                )}
+                                            </td>
+                                        </tr>
+                                    ))}
+                                </tbody>
+                            </table>
                         </div>
                     ) : (
                         <div className="overflow-x-auto">
+                            <form
+                                onSubmit={(e) => { e.preventDefault(); runQuery(() => loadDraws()); }}
+                                className="flex flex-wrap gap-2 p-4 border-b border-gray-200 text-sm"
+                            >
+                                <input value={drawFilters.user_id} onChange={(e) => setDrawFilters({ ...drawFilters, user_id: e.target.value })} placeholder="企业微信 ID" className="border rounded-lg px-3 py-1" />
+                                <select value={drawFilters.type} onChange={(e) => setDrawFilters({ ...drawFilters, type: e.target.value })} className="border rounded-lg px-3 py-1">
+                                    <option value="">全部奖品类型</option>
+                                    <option value="1">大奖</option>
+                                    <option value="2">奖品</option>
+                                    <option value="3">祝福</option>
+                                    <option value="4">积分</option>
+                                    <option value="5">抽奖次数</option>
+                                    <option value="6">假期卡</option>
+                                </select>
+                                <input type="datetime-local" value={drawFilters.since} onChange={(e) => setDrawFilters({ ...drawFilters, since: e.target.value })} className="border rounded-lg px-3 py-1" />
+                                <input type="datetime-local" value={drawFilters.until} onChange={(e) => setDrawFilters({ ...drawFilters, until: e.target.value })} className="border rounded-lg px-3 py-1" />
+                                <button type="submit" disabled={loading} className="bg-blue-600 hover:bg-blue-700 text-white px-4 py-1 rounded-lg font-bold">查询</button>
+                            </form>
                             <table className="w-full text-left">
                                 <thead className="bg-gray-50 border-b border-gray-200">
                                     <tr>
@@ -225,8 +485,8 @@ const Admin = () => {
                                     </tr>
                                 </thead>
                                 <tbody className="divide-y divide-gray-100">
-                                    {draws.map((d, idx) => (
-                                        <tr key={`${d.user_id}-${idx}`} className="hover:bg-gray-50 transition-colors">
+                                    {draws.map(d => (
+                                        <tr key={d.id} className={`hover:bg-gray-50 transition-colors ${d.voided ? 'opacity-50' : ''}`}>
                                             <td className="px-6 py-4">
                                                 <div className="font-bold">{d.name || '未知用户'}</div>
                                                 <div className="text-xs text-gray-400 font-mono tracking-tighter">{d.user_id}</div>
@@ -238,6 +498,7 @@ const Admin = () => {
                                                     }`}>
                                                     {d.award_name}
                                                 </div>
+                                                {d.voided && <div className="text-xs text-gray-400 mt-1">已作废</div>}
                                             </td>
                                             <td className="px-6 py-4 text-sm text-gray-500">
                                                 {d.created_at}
@@ -251,6 +512,11 @@ const Admin = () => {
                                     ))}
                                 </tbody>
                             </table>
+                            {drawCursor && (
+                                <button onClick={() => runQuery(() => loadDraws(drawCursor))} disabled={loading} className="w-full py-3 text-sm font-bold text-blue-600 hover:bg-gray-50">
+                                    {loading ? '加载中...' : '加载更多'}
+                                </button>
+                            )}
                         </div>
                     )}
                 </div>
@@ -259,16 +525,4 @@ const Admin = () => {
     );
 };
 
-const downloadCSV = (content: string, filename: string) => {
-    const csvContent = "\uFEFF" + content;
-    const blob = new Blob([csvContent], { type: 'text/csv;charset=utf-8;' });
-    const url = URL.createObjectURL(blob);
-    const link = document.createElement('a');
-    link.setAttribute('href', url);
-    link.setAttribute('download', filename);
-    document.body.appendChild(link);
-    link.click();
-    document.body.removeChild(link);
-};
-
 export default Admin;
@@ -3,11 +3,22 @@ import { useNavigate } from 'react-router-dom';
 import api from '../services/api';
 import { useUserStore } from '../store/userStore';
 
+// Result copy per award type (model.AwardType); unit marks kinds credited straight to the account
+const PRIZE_COPY: Record<number, { icon: string, title: string, hint: string, unit?: string }> = {
+    1: { icon: "🏆", title: "恭喜中得大奖!", hint: "请联系行政领取您的大奖" },
+    2: { icon: "🎉", title: "恭喜中奖!", hint: "请联系行政领取您的奖品" },
+    3: { icon: "🧧", title: "新春祝福", hint: "祝您马到成功，万事如意！" },
+    4: { icon: "🎉", title: "恭喜中奖!", hint: "积分已直接存入您的总账户！", unit: "积分" },
+    5: { icon: "🎟️", title: "再来一次!", hint: "抽奖次数已到账，快去再抽一次吧！", unit: "次抽奖机会" },
+    6: { icon: "🏖️", title: "恭喜获得休假奖励卡!", hint: "凭兑换码联系行政登记您的假期" },
+};
+const DEFAULT_COPY = PRIZE_COPY[2];
+
 const Draw = () => {
     const navigate = useNavigate();
     const { user, setUser } = useUserStore();
     const [isDrawing, setIsDrawing] = useState(false);
-    const [prize, setPrize] = useState<{ name: string, type: number, value: number, image_url: string } | null>(null);
+    const [prize, setPrize] = useState<{ name: string, type: number, value: number, image_url: string, thumb_url?: string, redemption_code?: string } | null>(null);
 
     useEffect(() => {
         api.get('/user/info').then(res => {
@@ -15,15 +26,6 @@ const Draw = () => {
         });
     }, [setUser, prize]); // Refresh info when prize changes (收下好运)
 
-    const HORSE_BLESSINGS = [
-        "龙马精神，岁岁平安",
-        "马到成功，前程似锦",
-        "万马奔腾，财源滚滚",
-        "一马当先，步步高升",
-        "策马扬鞭，扬帆起航",
-        "骏马奔腾，福星高照"
-    ];
-
     const handleDraw = async () => {
         if (!user || user.chances <= 0) {
             alert("抽奖次数不足！请先去玩游戏获取次数。");
@@ -37,10 +39,9 @@ const Draw = () => {
             const res = await api.post('/draw');
             if (res.data.code === 0) {
                 let drawData = res.data.data;
-                // If it's a blessing (type 3), spice it up with random horse year wishes
-                if (drawData.type === 3) {
-                    const randomBlessing = HORSE_BLESSINGS[Math.floor(Math.random() * HORSE_BLESSINGS.length)];
-                    drawData = { ...drawData, name: randomBlessing };
+                // Blessings (type 3) come with a server-picked message
+                if (drawData.type === 3 && drawData.message) {
+                    drawData = { ...drawData, name: drawData.message };
                 }
                 setPrize(drawData);
             } else {
@@ -54,6 +55,8 @@ const Draw = () => {
         }
     };
 
+    const copy = (prize && PRIZE_COPY[prize.type]) || DEFAULT_COPY;
+
     return (
         <div className="flex flex-col items-center justify-center min-h-screen bg-festival-red text-white p-4 relative overflow-hidden">
             <div className="absolute top-0 left-0 text-9xl opacity-10 pointer-events-none">🏮</div>
@@ -107,21 +110,22 @@ const Draw = () => {
                 <div className="fixed inset-0 bg-black/90 flex items-center justify-center z-50 p-4">
                     <div className="bg-festival-red p-8 rounded-2xl border-4 border-yellow-500 text-center max-w-sm w-full animate-pop-in shadow-2xl relative">
                         <div className="absolute -top-12 left-1/2 transform -translate-x-1/2 text-6xl">
-                            {prize.type === 3 ? "🧧" : "🎉"}
+                            {copy.icon}
                         </div>
                         <h2 className="text-3xl font-bold text-yellow-300 mb-6 mt-4">
-                            {prize.type === 3 ? "新春祝福" : "恭喜中奖!"}
+                            {copy.title}
                         </h2>
 
                         <div className="bg-red-900/50 p-6 rounded-xl mb-6 border border-yellow-500/20">
                             <p className="text-2xl font-bold text-white mb-2">{prize.name}</p>
-                            {prize.type === 4 && prize.value > 0 && (
-                                <p className="text-yellow-400 font-mono text-xl mb-2">+{prize.value} 积分</p>
+                            {copy.unit && prize.value > 0 && (
+                                <p className="text-yellow-400 font-mono text-xl mb-2">+{prize.value} {copy.unit}</p>
+                            )}
+                            {prize.redemption_code && (
+                                <p className="text-yellow-400 font-mono text-xl mb-2">兑换码 {prize.redemption_code}</p>
                             )}
                             <p className="text-sm text-yellow-200/60 lowercase text-capitalize">
-                                {prize.type === 3
-                                    ? "祝您马到成功，万事如意！"
-                                    : (prize.type === 4 ? "积分已直接存入您的总账户！" : "请联系行政领取您的奖品")}
+                                {copy.hint}
                             </p>
                         </div>
 
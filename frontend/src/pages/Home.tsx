@@ -1,48 +1,11 @@
-import React, { useEffect } from 'react';
+import React from 'react';
 import { useNavigate } from 'react-router-dom';
 import { useUserStore } from '../store/userStore';
 
-declare global {
-    interface Window {
-        WwLogin: any;
-    }
-}
-
 const Home = () => {
     const navigate = useNavigate();
     const { user } = useUserStore();
 
-    useEffect(() => {
-        // Check if user is already logged in
-        if (user) return;
-
-        // Detect Environment
-        const isWeChat = /MicroMessenger/i.test(navigator.userAgent);
-        const isMobile = /Android|webOS|iPhone|iPad|iPod|BlackBerry|IEMobile|Opera Mini/i.test(navigator.userAgent);
-
-        if (isWeChat || isMobile) {
-            // Mobile: Do nothing, let user click login or auto-redirect if strictly enforced
-            // For now, we provide a button to login via OAuth
-        } else {
-            // PC: Show QR Code
-            // Need to wait for div to mount
-            const timer = setTimeout(() => {
-                if (window.WwLogin) {
-                    window.WwLogin({
-                        "id": "wx_reg",
-                        "appid": "ww112f4f89390a03cd",
-                        "agentid": "1000037",
-                        "redirect_uri": encodeURIComponent("https://happynewyear.ilinkedge.cn/login"),
-                        "state": "qr_login",
-                        "href": "", // Optional custom css
-                        "lang": "zh",
-                    });
-                }
-            }, 500);
-            return () => clearTimeout(timer);
-        }
-    }, [user]);
-
     const handleStartGame = () => {
         if (!user) {
             alert("请先登录 / Please Login First");
@@ -51,11 +14,9 @@ const Home = () => {
         navigate('/game');
     };
 
-    const handleMobleLogin = () => {
-        // Redirect to WeCom OAuth
-        const appid = "ww112f4f89390a03cd";
-        const redirect_uri = encodeURIComponent("https://happynewyear.ilinkedge.cn/login");
-        window.location.href = `https://open.weixin.qq.com/connect/oauth2/authorize?appid=${appid}&redirect_uri=${redirect_uri}&response_type=code&scope=snsapi_base&state=STATE#wechat_redirect`;
+    const handleLogin = () => {
+        // The backend picks in-app OAuth or the desktop QR page from the User-Agent
+        window.location.href = '/auth/wecom?redirect=/';
     };
 
     const [showRules, setShowRules] = React.useState(false);
@@ -134,11 +95,8 @@ const Home = () => {
                     </div>
                 ) : (
                     <div className="w-full flex flex-col items-center bg-white/10 p-6 rounded-xl backdrop-blur-sm">
-                        <div id="wx_reg" className="mb-4"></div>
-
-                        {/* Fallback for Mobile / if QR script fails */}
                         <button
-                            onClick={handleMobleLogin}
+                            onClick={handleLogin}
                             className="w-full py-3 bg-green-600 text-white rounded-lg font-bold shadow-lg"
                         >
                             企业微信一键登录
@@ -13,16 +13,22 @@ const Profile = () => {
         });
     }, [setUser]);
 
-    const handleLogout = () => {
-        logout();
-        navigate('/login');
+    // everywhere also ends the sessions on the user's other devices
+    const handleLogout = (everywhere = false) => {
+        api.post(everywhere ? '/user/logout-all' : '/user/logout').finally(() => {
+            logout();
+            navigate('/');
+        });
     };
 
     return (
         <div className="min-h-screen bg-festival-red text-white p-4">
             <div className="flex justify-between items-center mb-8">
                 <button onClick={() => navigate('/')} className="text-yellow-200">← 返回首页</button>
-                <button onClick={handleLogout} className="text-white/60 hover:text-white">退出登录</button>
+                <div className="flex gap-4">
+                    <button onClick={() => handleLogout(true)} className="text-white/60 hover:text-white">退出所有设备</button>
+                    <button onClick={() => handleLogout()} className="text-white/60 hover:text-white">退出登录</button>
+                </div>
             </div>
 
             <div className="flex flex-col items-center mb-10">
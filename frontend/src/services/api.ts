@@ -5,12 +5,20 @@ const api = axios.create({
     timeout: 10000,
 });
 
+// The session lives in an HttpOnly cookie; POSTs echo the readable CSRF cookie
+const readCookie = (name: string) => {
+    const match = document.cookie.match(new RegExp('(?:^|; )' + name + '=([^;]*)'));
+    return match ? decodeURIComponent(match[1]) : '';
+};
+
 // Request Interceptor
 api.interceptors.request.use(
     (config) => {
-        const token = localStorage.getItem('token');
-        if (token) {
-            config.headers['Authorization'] = `Bearer ${token}`;
+        const method = (config.method || 'get').toLowerCase();
+        if (!['get', 'head', 'options'].includes(method)) {
+            // The admin console has its own session unless the admin came in through WeCom
+            const isAdmin = (config.url || '').startsWith('/admin');
+            config.headers['X-CSRF-Token'] = (isAdmin && readCookie('hny_admin_csrf')) || readCookie('hny_csrf');
         }
         return config;
     },
@@ -19,19 +27,55 @@ api.interceptors.request.use(
     }
 );
 
+// The access token is short-lived; the refresh cookie (sent only to
+// /api/user/refresh) rotates on every use. Concurrent 401s share one refresh,
+// and a 409 means another tab already rotated it, so the new cookies are set.
+let refreshing: Promise<void> | null = null;
+const refreshSession = () => {
+    if (!refreshing) {
+        refreshing = axios.post('/api/user/refresh', null, {
+            headers: { 'X-CSRF-Token': readCookie('hny_csrf') },
+        })
+            .then(() => undefined)
+            .catch((err) => {
+                if (err.response && err.response.status === 409) return;
+                throw err;
+            })
+            .finally(() => { refreshing = null; });
+    }
+    return refreshing;
+};
+
 // Response Interceptor
 api.interceptors.response.use(
     (response) => {
         return response;
     },
-    (error) => {
-        if (error.response && error.response.status === 401) {
-            // Token expired or invalid
-            localStorage.removeItem('token');
-            window.location.href = '/login';
+    async (error) => {
+        const config = error.config;
+        if (error.response && error.response.status === 401 && config && !config._retried) {
+            config._retried = true;
+            try {
+                await refreshSession();
+                return api(config);
+            } catch {
+                // Session revoked, expired, or from another device: log in again and come back.
+                // The admin console shows its own login form instead.
+                if (!(config.url || '').startsWith('/admin')) {
+                    window.location.href = '/auth/wecom?redirect=' + encodeURIComponent(window.location.pathname);
+                }
+            }
         }
         return Promise.reject(error);
     }
 );
 
+// fetchSession loads the current user without forcing a login
+export const fetchSession = () => axios.get('/api/user/info')
+    .catch((err) => {
+        if (!err.response || err.response.status !== 401) throw err;
+        return refreshSession().then(() => axios.get('/api/user/info'));
+    })
+    .then(res => res.data.user);
+
 export default api;
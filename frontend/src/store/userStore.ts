@@ -9,11 +9,10 @@ interface User {
     total_score: number;
 }
 
+// The session itself is an HttpOnly cookie the SPA never sees
 interface UserState {
     user: User | null;
-    token: string | null;
     isAuthenticated: boolean;
-    setToken: (token: string) => void;
     setUser: (user: User) => void;
     updateChances: (chances: number) => void;
     logout: () => void;
@@ -21,13 +20,8 @@ interface UserState {
 
 export const useUserStore = create<UserState>((set) => ({
     user: null,
-    token: localStorage.getItem('token'),
-    isAuthenticated: !!localStorage.getItem('token'),
-    setToken: (token) => {
-        localStorage.setItem('token', token);
-        set({ token, isAuthenticated: true });
-    },
-    setUser: (user) => set({ user }),
+    isAuthenticated: false,
+    setUser: (user) => set({ user, isAuthenticated: true }),
     updateChances: (chances) => set((state) => {
         if (state.user) {
             return { user: { ...state.user, chances } };
@@ -35,7 +29,6 @@ export const useUserStore = create<UserState>((set) => ({
         return {};
     }),
     logout: () => {
-        localStorage.removeItem('token');
-        set({ user: null, token: null, isAuthenticated: false });
+        set({ user: null, isAuthenticated: false });
     },
 }));
@@ -1,11 +1,21 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
 
+// SigningKey is one entry of a keyring. NotBefore (RFC3339) stages a key:
+// it verifies at once but only signs from then on.
+type SigningKey struct {
+	ID        string `yaml:"ID"`
+	Secret    string `yaml:"Secret"`
+	NotBefore string `yaml:"NotBefore,omitempty"`
+}
+
 type Config struct {
 	Name string `yaml:"Name"`
 	Host string `yaml:"Host"`
@@ -23,16 +33,77 @@ type Config struct {
 		Type string `yaml:"Type"`
 	} `yaml:"Redis"`
 	WeCom struct {
-		CorpID  string `yaml:"CorpID"`
-		AgentID int    `yaml:"AgentID"`
-		Secret  string `yaml:"Secret"`
+		CorpID          string   `yaml:"CorpID"`
+		AgentID         int      `yaml:"AgentID"`
+		Secret          string   `yaml:"Secret"`
+		BaseURL         string   `yaml:"BaseURL"`         // Empty means the real qyapi.weixin.qq.com
+		ProfileTTLHours int      `yaml:"ProfileTTLHours"` // Refresh user/get on login after this long
+		NonMemberPolicy string   `yaml:"NonMemberPolicy"` // "reject" (default) or "guest"
+		JSSDKDomains    []string `yaml:"JSSDKDomains"`    // Pages allowed to request wx.config signatures
+		CallbackURL     string   `yaml:"CallbackURL"`     // Public /auth/wecom/callback URL; empty derives it from the request
+		OAuthScope      string   `yaml:"OAuthScope"`      // snsapi_base (default) or snsapi_privateinfo
 	} `yaml:"WeCom"`
 	Game struct {
-		AppSecret          string `yaml:"AppSecret"`
-		AdminPassword      string `yaml:"AdminPassword"`
-		ScoreToChanceRatio int    `yaml:"ScoreToChanceRatio"`
-		MaxChancesPerDay   int    `yaml:"MaxChancesPerDay"`
+		AppSecret           string `yaml:"AppSecret"`
+		AdminPassword       string `yaml:"AdminPassword"` // Seeds the first super-admin "admin" only
+		ScoreToChanceRatio  int    `yaml:"ScoreToChanceRatio"`
+		MaxChancesPerDay    int    `yaml:"MaxChancesPerDay"`
+		LeaderboardFreezeAt string `yaml:"LeaderboardFreezeAt"` // RFC3339; final ranking is announced after this
 	} `yaml:"Game"`
+	Keys struct {
+		JWT          []SigningKey `yaml:"JWT"`          // Session tokens; empty derives one from Game.AppSecret
+		Game         []SigningKey `yaml:"Game"`         // Game result signatures; empty uses Game.AppSecret
+		GraceMinutes int          `yaml:"GraceMinutes"` // How long a replaced key still verifies
+	} `yaml:"Keys"`
+	Auth struct {
+		AccessMinutes     int  `yaml:"AccessMinutes"`     // Access token lifetime; refreshed from the session
+		SessionHours      int  `yaml:"SessionHours"`      // Absolute session (refresh token) lifetime
+		AdminSessionHours int  `yaml:"AdminSessionHours"` // Admin console sessions; no refresh
+		InsecureCookies   bool `yaml:"InsecureCookies"`   // Drop the Secure flag for plain-http local runs
+		AllowBearer       bool `yaml:"AllowBearer"`       // Accept Authorization: Bearer for tooling (cmd/verifier)
+	} `yaml:"Auth"`
+	Storage struct {
+		Driver     string `yaml:"Driver"` // "local"
+		LocalDir   string `yaml:"LocalDir"`
+		BaseURL    string `yaml:"BaseURL"` // URL prefix the files are served under
+		MaxImageKB int    `yaml:"MaxImageKB"`
+	} `yaml:"Storage"`
+	Checkpoint struct {
+		Enabled       bool   `yaml:"Enabled"`
+		Sink          string `yaml:"Sink"` // "file", "wecom" or empty
+		FilePath      string `yaml:"FilePath"`
+		WebhookURL    string `yaml:"WebhookURL"`    // WeCom group robot webhook
+		SettleMinutes int    `yaml:"SettleMinutes"` // Anchor an hour this long after it closes, once its draws have committed
+	} `yaml:"Checkpoint"`
+	Notify struct {
+		Enabled       bool   `yaml:"Enabled"`
+		AppURL        string `yaml:"AppURL"`        // Link target for message cards
+		RatePerSecond int    `yaml:"RatePerSecond"` // message/send calls per second across all replicas
+		MaxAttempts   int    `yaml:"MaxAttempts"`
+		ReminderHour  int    `yaml:"ReminderHour"` // Local hour for the daily chances reminder, 0 disables
+	} `yaml:"Notify"`
+	OrgSync struct {
+		Enabled         bool `yaml:"Enabled"`
+		IntervalMinutes int  `yaml:"IntervalMinutes"`
+	} `yaml:"OrgSync"`
+	Approval struct {
+		WindowMinutes          int `yaml:"WindowMinutes"`          // How long a proposal waits for its second admin
+		ChanceGrantThreshold   int `yaml:"ChanceGrantThreshold"`   // Manual chance grants above this need approval
+		ChanceGrantWindowHours int `yaml:"ChanceGrantWindowHours"` // Grants to one user within this window add up
+	} `yaml:"Approval"`
+	Adjustments struct {
+		MaxChances   int `yaml:"MaxChances"`   // Largest manual chance change per user
+		MaxPoints    int `yaml:"MaxPoints"`    // Largest manual points change per user
+		MaxBatchRows int `yaml:"MaxBatchRows"` // Rows per CSV upload
+	} `yaml:"Adjustments"`
+	Reset struct {
+		SnapshotDir string   `yaml:"SnapshotDir"` // Where reset and restore write their snapshots
+		TestUserIDs []string `yaml:"TestUserIDs"` // Default users for the test_users reset scope
+	} `yaml:"Reset"`
+	Stats struct {
+		StreamIntervalSeconds int `yaml:"StreamIntervalSeconds"` // How often the admin SSE stream sends a reading
+		TopDepartments        int `yaml:"TopDepartments"`        // Departments ranked on the dashboard
+	} `yaml:"Stats"`
 }
 
 func Load(path string) (Config, error) {
@@ -50,15 +121,60 @@ func Load(path string) (Config, error) {
 	if secret := os.Getenv("WEWORK_SECRET"); secret != "" {
 		c.WeCom.Secret = secret
 	}
+	if baseURL := os.Getenv("WECOM_BASE_URL"); baseURL != "" {
+		c.WeCom.BaseURL = baseURL
+	}
 	if ds := os.Getenv("DB_DATASOURCE"); ds != "" {
 		c.Database.DataSource = ds
 	}
 	if appSecret := os.Getenv("APP_SECRET"); appSecret != "" {
 		c.Game.AppSecret = appSecret
 	}
+	for env, keys := range map[string]*[]SigningKey{"JWT_KEYS": &c.Keys.JWT, "GAME_KEYS": &c.Keys.Game} {
+		if spec := os.Getenv(env); spec != "" {
+			parsed, err := ParseSigningKeys(spec)
+			if err != nil {
+				return c, fmt.Errorf("%s: %v", env, err)
+			}
+			*keys = parsed
+		}
+	}
 	if adminPwd := os.Getenv("ADMIN_PASSWORD"); adminPwd != "" {
 		c.Game.AdminPassword = adminPwd
 	}
+	if webhook := os.Getenv("CHECKPOINT_WEBHOOK_URL"); webhook != "" {
+		c.Checkpoint.WebhookURL = webhook
+	}
 
 	return c, nil
 }
+
+// ParseSigningKeys reads the env form of a keyring: "id=secret[@notbefore],..."
+func ParseSigningKeys(spec string) ([]SigningKey, error) {
+	var keys []SigningKey
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, rest, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("key entry %q is not id=secret", id)
+		}
+		secret, notBefore, _ := strings.Cut(rest, "@")
+		keys = append(keys, SigningKey{ID: id, Secret: secret, NotBefore: notBefore})
+	}
+	return keys, nil
+}
+
+// FormatSigningKeys is the inverse of ParseSigningKeys
+func FormatSigningKeys(keys []SigningKey) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k.ID + "=" + k.Secret
+		if k.NotBefore != "" {
+			parts[i] += "@" + k.NotBefore
+		}
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"happynewyear/internal/logic"
+	"happynewyear/internal/svc"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewAdminAdjustHandler grants (positive delta) or revokes chances or points
+// for one user: {"kind": "chances"|"points", "delta": 2, "reason": "..."}.
+// Chance grants that take the user above Approval.ChanceGrantThreshold within
+// the grant window wait for a second admin.
+func NewAdminAdjustHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req logic.Adjustment
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		req.UserID = c.Param("user_id")
+
+		l := logic.NewAdjustmentLogic(ctx)
+		if err := l.Validate(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		row, err := l.Adjust(req, currentAdmin(c).Username, false)
+		if errors.Is(err, logic.ErrNeedsApproval) {
+			summary := fmt.Sprintf("Grant %d chances to %s: %s", req.Delta, req.UserID, req.Reason)
+			respondProposal(ctx, c, logic.OpChanceGrant, req, summary)
+			return
+		}
+		if err != nil {
+			c.JSON(adjustmentErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": row})
+	}
+}
+
+// NewAdminAdjustBatchHandler applies a CSV upload (multipart "file", header
+// user_id,kind,delta,reason) all or nothing. An optional "reason" form field
+// fills rows without one. If any row is a chance grant above the approval
+// threshold (per user, summed over the file and the grant window), the whole
+// file waits for a second admin.
+func NewAdminAdjustBatchHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing file"})
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file"})
+			return
+		}
+		defer f.Close()
+
+		items, err := logic.ParseAdjustmentCSV(f, c.PostForm("reason"))
+		if err != nil {
+			respondAdjustmentError(c, err)
+			return
+		}
+		l := logic.NewAdjustmentLogic(ctx)
+		if err := l.ValidateBatch(items); err != nil {
+			respondAdjustmentError(c, err)
+			return
+		}
+		c.Set("audit_extra", gin.H{"file": fh.Filename, "rows": len(items)})
+
+		rows, err := l.AdjustBatch(items, currentAdmin(c).Username, false)
+		if errors.Is(err, logic.ErrNeedsApproval) {
+			summary := fmt.Sprintf("Apply %d adjustments from %s", len(items), fh.Filename)
+			respondProposal(ctx, c, logic.OpAdjustBatch, items, summary)
+			return
+		}
+		if err != nil {
+			respondAdjustmentError(c, err)
+			return
+		}
+		c.Set("audit_extra", gin.H{"file": fh.Filename, "rows": len(rows), "batch_id": rows[0].BatchID})
+
+		c.JSON(http.StatusOK, gin.H{"data": rows})
+	}
+}
+
+// NewAdminListAdjustmentsHandler shows the adjustment ledger, ?user_id= for one user
+func NewAdminListAdjustmentsHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := logic.NewAdjustmentLogic(ctx).List(c.Query("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": list})
+	}
+}
+
+func respondAdjustmentError(c *gin.Context, err error) {
+	var batchErr *logic.AdjustmentBatchError
+	if errors.As(err, &batchErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "rows": batchErr.Rows})
+		return
+	}
+	c.JSON(adjustmentErrorStatus(err), gin.H{"error": err.Error()})
+}
+
+func adjustmentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, logic.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, logic.ErrLeaderboardFrozen):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"errors"
+	"happynewyear/internal/logic"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentAdmin is the account AdminAuth put on the request
+func currentAdmin(c *gin.Context) *model.AdminAccount {
+	return c.MustGet("admin").(*model.AdminAccount)
+}
+
+// NewAdminLoginHandler is the local username/password login. Admins with a
+// WeCom user id can skip it: their normal WeCom login works for the console.
+func NewAdminLoginHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		c.Set("audit_actor", req.Username)
+
+		account, err := logic.NewAdminAccountLogic(ctx).Login(req.Username, req.Password)
+		switch {
+		case errors.Is(err, logic.ErrAdminLocked):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, logic.ErrAdminLogin):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		session, err := logic.NewSessionLogic(ctx).CreateAdmin(account, c.GetHeader("User-Agent"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		setAdminCookies(ctx, c, session)
+		c.Set("admin", account)
+		c.JSON(http.StatusOK, gin.H{"data": adminProfile(account)})
+	}
+}
+
+// NewAdminMeHandler tells the console who is signed in and what they may do
+func NewAdminMeHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"data": adminProfile(currentAdmin(c))})
+	}
+}
+
+// NewAdminLogoutHandler ends a local console session. WeCom admins log out
+// through /api/user/logout.
+func NewAdminLogoutHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if sid := c.GetString("session_id"); sid != "" {
+			if err := logic.NewSessionLogic(ctx).Revoke(sid); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		clearAdminCookies(ctx, c)
+		c.JSON(http.StatusOK, gin.H{"message": "success"})
+	}
+}
+
+func adminProfile(account *model.AdminAccount) gin.H {
+	return gin.H{"account": account, "permissions": logic.RolePermissions(account.Role)}
+}
+
+// NewAdminListAccountsHandler
+func NewAdminListAccountsHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := logic.NewAdminAccountLogic(ctx).List()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": list})
+	}
+}
+
+// NewAdminCreateAccountHandler
+func NewAdminCreateAccountHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req logic.AdminAccountRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		account, err := logic.NewAdminAccountLogic(ctx).Create(req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": account})
+	}
+}
+
+// NewAdminUpdateAccountHandler
+func NewAdminUpdateAccountHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid account id"})
+			return
+		}
+		var req logic.AdminAccountRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		account, err := logic.NewAdminAccountLogic(ctx).Update(id, currentAdmin(c).ID, req)
+		if errors.Is(err, logic.ErrAdminNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": account})
+	}
+}
+
+// NewAdminLookupRedemptionHandler shows the draw behind a winner's code
+func NewAdminLookupRedemptionHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, err := logic.NewRedemptionLogic(ctx).Lookup(c.Param("code"))
+		if err != nil {
+			c.JSON(redemptionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": r})
+	}
+}
+
+// NewAdminRedeemHandler records that a prize was handed out
+func NewAdminRedeemHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Note string `json:"note"`
+		}
+		c.ShouldBindJSON(&req)
+
+		r, err := logic.NewRedemptionLogic(ctx).Redeem(c.Param("code"), currentAdmin(c).Username, req.Note)
+		if err != nil {
+			c.JSON(redemptionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": r})
+	}
+}
+
+func redemptionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, logic.ErrRedemptionCode):
+		return http.StatusNotFound
+	case errors.Is(err, logic.ErrNotRedeemable), errors.Is(err, logic.ErrAlreadyRedeemed), errors.Is(err, logic.ErrDrawVoided):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"happynewyear/internal/logic"
+	"happynewyear/internal/svc"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewAdminListAuditHandler queries the admin audit log, newest first:
+// ?actor=&action=&outcome=&since=&until=&before_id=&limit=
+// Times are RFC3339; action may be a prefix such as "awards.".
+func NewAdminListAuditHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		f := logic.AdminAuditFilter{
+			Actor:   c.Query("actor"),
+			Action:  c.Query("action"),
+			Outcome: c.Query("outcome"),
+		}
+		var err error
+		for param, t := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+			if v := c.Query(param); v != "" {
+				if *t, err = time.Parse(time.RFC3339, v); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be RFC3339"})
+					return
+				}
+			}
+		}
+		if v := c.Query("before_id"); v != "" {
+			if f.BeforeID, err = strconv.ParseInt(v, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid before_id"})
+				return
+			}
+		}
+		if v := c.Query("limit"); v != "" {
+			if f.Limit, err = strconv.Atoi(v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+				return
+			}
+		}
+
+		list, err := logic.NewAdminAuditLogic(ctx).List(f)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var next int64
+		if len(list) > 0 {
+			next = list[len(list)-1].ID
+		}
+		c.JSON(http.StatusOK, gin.H{"data": list, "next_before_id": next})
+	}
+}
+
+// NewAdminVerifyAuditHandler replays the admin audit hash chain
+func NewAdminVerifyAuditHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, err := logic.NewAdminAuditLogic(ctx).Verify()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": report})
+	}
+}
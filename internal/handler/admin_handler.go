@@ -1,9 +1,15 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"happynewyear/internal/logic"
+	"happynewyear/internal/model"
 	"happynewyear/internal/svc"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,36 +28,54 @@ func NewRankHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
 	}
 }
 
-// AdminListUsersHandler
+// NewAdminListUsersHandler pages through users:
+// ?name=&department=&min_score=&max_score=&min_chances=&max_chances=
+// &sort=score|chances|name|created&order=desc|asc&cursor=&limit=
+// Pass next_cursor back as cursor for the following page.
 func NewAdminListUsersHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Simple Auth Check
-		secret := c.GetHeader("X-Admin-Secret")
-		l := logic.NewAdminLogic(ctx)
-		if !l.CheckAuth(secret) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid admin secret"})
+		f := logic.UserFilter{
+			Name:       strings.TrimSpace(c.Query("name")),
+			Department: strings.TrimSpace(c.Query("department")),
+			Sort:       c.Query("sort"),
+			Asc:        c.Query("order") == "asc",
+			Cursor:     c.Query("cursor"),
+		}
+		var err error
+		for param, v := range map[string]**int64{"min_score": &f.MinScore, "max_score": &f.MaxScore} {
+			if *v, err = queryInt64(c, param); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param})
+				return
+			}
+		}
+		for param, v := range map[string]**int{"min_chances": &f.MinChances, "max_chances": &f.MaxChances} {
+			n, err := queryInt64(c, param)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param})
+				return
+			}
+			if n != nil {
+				i := int(*n)
+				*v = &i
+			}
+		}
+		if f.Limit, err = queryLimit(c); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
 			return
 		}
 
-		list, err := l.GetAllUsers()
+		list, next, err := logic.NewAdminLogic(ctx).ListUsers(f)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(pageErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"data": list})
+		c.JSON(http.StatusOK, gin.H{"data": list, "next_cursor": next})
 	}
 }
 func NewAdminListAwardsHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Simple Auth Check
-		secret := c.GetHeader("X-Admin-Secret")
 		l := logic.NewAdminLogic(ctx)
-		if !l.CheckAuth(secret) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid admin secret"})
-			return
-		}
-
 		list, err := l.GetAllAwards()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -62,18 +86,101 @@ func NewAdminListAwardsHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
 	}
 }
 
-// NewAdminListDrawRecordsHandler
+// NewAdminListDrawRecordsHandler pages through draws, newest first:
+// ?user_id=&award_id=&type=&since=&until=&order=desc|asc&cursor=&limit=
+// type is the award type; times are RFC3339.
 func NewAdminListDrawRecordsHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Simple Auth Check
-		secret := c.GetHeader("X-Admin-Secret")
-		l := logic.NewAdminLogic(ctx)
-		if !l.CheckAuth(secret) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid admin secret"})
+		f := logic.DrawFilter{
+			UserID: strings.TrimSpace(c.Query("user_id")),
+			Asc:    c.Query("order") == "asc",
+			Cursor: c.Query("cursor"),
+		}
+		var err error
+		for param, v := range map[string]*int{"award_id": &f.AwardID, "type": &f.AwardType} {
+			n, err := queryInt64(c, param)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param})
+				return
+			}
+			if n != nil {
+				*v = int(*n)
+			}
+		}
+		for param, t := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+			if v := c.Query(param); v != "" {
+				if *t, err = time.Parse(time.RFC3339, v); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be RFC3339"})
+					return
+				}
+			}
+		}
+		if f.Limit, err = queryLimit(c); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+
+		list, next, err := logic.NewAdminLogic(ctx).ListDrawRecords(f)
+		if err != nil {
+			c.JSON(pageErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": list, "next_cursor": next})
+	}
+}
+
+// queryInt64 returns nil for a missing parameter
+func queryInt64(c *gin.Context, param string) (*int64, error) {
+	v := c.Query(param)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+func queryLimit(c *gin.Context) (int, error) {
+	if v := c.Query("limit"); v != "" {
+		return strconv.Atoi(v)
+	}
+	return 0, nil
+}
+
+func pageErrorStatus(err error) int {
+	if errors.Is(err, logic.ErrInvalidCursor) || errors.Is(err, logic.ErrInvalidSort) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// NewAdminResetDataHandler only proposes the reset; it runs once a second
+// admin approves it. Body: {"scope": "all"|"test_users"|"inventory", "user_ids": [...]}
+func NewAdminResetDataHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req logic.ResetRequest
+		c.ShouldBindJSON(&req)
+		if err := logic.NewAdminLogic(ctx).NormalizeReset(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		list, err := l.GetDrawRecords()
+		summary := map[string]string{
+			logic.ResetScopeAll:       "Reset all scores, chances, game and draw records",
+			logic.ResetScopeInventory: "Reset all award stock to its total",
+			logic.ResetScopeTestUsers: fmt.Sprintf("Reset test users %s", strings.Join(req.UserIDs, ", ")),
+		}[req.Scope]
+		respondProposal(ctx, c, logic.OpDataReset, req, summary)
+	}
+}
+
+// NewAdminListSnapshotsHandler lists the snapshots written by resets and restores
+func NewAdminListSnapshotsHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := logic.NewSnapshotLogic(ctx).List()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -83,22 +190,62 @@ func NewAdminListDrawRecordsHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
 	}
 }
 
-// NewAdminResetDataHandler
-func NewAdminResetDataHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+// NewAdminCreateSnapshotHandler takes a snapshot on demand
+func NewAdminCreateSnapshotHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Simple Auth Check
-		secret := c.GetHeader("X-Admin-Secret")
-		l := logic.NewAdminLogic(ctx)
-		if !l.CheckAuth(secret) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid admin secret"})
+		snap, _, err := logic.NewSnapshotLogic(ctx).Create("manual", currentAdmin(c).Username)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": snap})
+	}
+}
+
+// NewAdminRestoreSnapshotHandler proposes rolling the event back to a
+// snapshot; like a reset it needs a second admin
+func NewAdminRestoreSnapshotHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid snapshot id"})
 			return
 		}
+		var snap model.ResetSnapshot
+		if err := ctx.DB.First(&snap, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": logic.ErrSnapshotNotFound.Error()})
+			return
+		}
+
+		summary := fmt.Sprintf("Restore snapshot #%d (%s, %s)", snap.ID, snap.Reason, snap.CreatedAt.Format("2006-01-02 15:04:05"))
+		respondProposal(ctx, c, logic.OpDataRestore, logic.SnapshotRestoreParams{SnapshotID: id}, summary)
+	}
+}
 
-		if err := l.ResetData(); err != nil {
+// NewAdminListCheckpointsHandler
+func NewAdminListCheckpointsHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := logic.NewCheckpointLogic(ctx).ListCheckpoints()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": list})
+	}
+}
+
+// NewAdminRevokeSessionsHandler is the kill switch: it logs a user out of
+// every device at once
+func NewAdminRevokeSessionsHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		n, err := logic.NewSessionLogic(ctx).RevokeUser(c.Param("user_id"))
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "success"})
+		c.JSON(http.StatusOK, gin.H{"data": gin.H{"user_id": c.Param("user_id"), "sessions": n}})
 	}
 }
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"errors"
+	"happynewyear/internal/logic"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewAdminListApprovalsHandler lists proposals, ?status=pending for the queue
+func NewAdminListApprovalsHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := logic.NewApprovalLogic(ctx).List(c.Query("status"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": list})
+	}
+}
+
+// NewAdminApproveHandler is the second admin's sign-off; the operation runs
+// right away and its outcome comes back on the approval
+func NewAdminApproveHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return decideApproval(ctx, (*logic.ApprovalLogic).Approve)
+}
+
+// NewAdminRejectHandler
+func NewAdminRejectHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return decideApproval(ctx, (*logic.ApprovalLogic).Reject)
+}
+
+func decideApproval(ctx *svc.ServiceContext, decide func(*logic.ApprovalLogic, int64, *model.AdminAccount, string) (*model.AdminApproval, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid approval id"})
+			return
+		}
+		var req struct {
+			Note string `json:"note"`
+		}
+		c.ShouldBindJSON(&req)
+
+		approval, err := decide(logic.NewApprovalLogic(ctx), id, currentAdmin(c), req.Note)
+		if err != nil {
+			c.JSON(approvalErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": approval})
+	}
+}
+
+// respondProposal answers a request that was queued instead of executed
+func respondProposal(ctx *svc.ServiceContext, c *gin.Context, op string, params interface{}, summary string) {
+	approval, err := logic.NewApprovalLogic(ctx).Propose(op, params, summary, currentAdmin(c))
+	if err != nil {
+		c.JSON(approvalErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"data": approval, "message": "awaiting approval by a second admin"})
+}
+
+func approvalErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, logic.ErrApprovalNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, logic.ErrApprovalPermission), errors.Is(err, logic.ErrSelfApproval):
+		return http.StatusForbidden
+	case errors.Is(err, logic.ErrApprovalClosed), errors.Is(err, logic.ErrApprovalExpired):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
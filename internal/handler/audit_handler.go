@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"fmt"
+	"happynewyear/internal/logic"
+	"happynewyear/internal/svc"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewAuditBundleHandler streams the tamper-evident audit bundle (?format=tar.gz|zip)
+// to an admin account with the audit bundle permission, e.g. the auditor role
+func NewAuditBundleHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		l := logic.NewAuditLogic(ctx)
+		format := c.DefaultQuery("format", "tar.gz")
+		if format != "tar.gz" && format != "zip" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be tar.gz or zip"})
+			return
+		}
+
+		filename := fmt.Sprintf("happynewyear-audit-%s.%s", time.Now().Format("20060102-150405"), format)
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+		if err := l.WriteBundle(c.Writer, format); err != nil {
+			// Headers may already be sent; the broken archive fails verification anyway
+			log.Printf("Audit bundle export failed: %v", err)
+			c.Status(http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"happynewyear/internal/logic"
+	"happynewyear/internal/svc"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewAdminCreateAwardHandler
+func NewAdminCreateAwardHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req logic.AwardRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		if err := req.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if ok, _ := logic.NewApprovalLogic(ctx).AwardChangeNeedsApproval(0, req); ok {
+			summary := fmt.Sprintf("Create grand prize %q with %d in stock", req.Name, req.TotalCount)
+			respondProposal(ctx, c, logic.OpAwardCreate, req, summary)
+			return
+		}
+
+		award, err := logic.NewAwardLogic(ctx).CreateAward(req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": award})
+	}
+}
+
+// NewAdminUpdateAwardHandler
+func NewAdminUpdateAwardHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid award id"})
+			return
+		}
+
+		var req logic.AwardRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		if err := req.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		needsApproval, err := logic.NewApprovalLogic(ctx).AwardChangeNeedsApproval(id, req)
+		if err != nil {
+			c.JSON(awardErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if needsApproval {
+			summary := fmt.Sprintf("Change grand prize #%d %q to %d in stock", id, req.Name, req.TotalCount)
+			respondProposal(ctx, c, logic.OpAwardUpdate, logic.AwardUpdateParams{AwardID: id, Award: req}, summary)
+			return
+		}
+
+		award, err := logic.NewAwardLogic(ctx).UpdateAward(id, req)
+		if err != nil {
+			c.JSON(awardErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": award})
+	}
+}
+
+// NewAdminRetireAwardHandler. Retiring a grand prize waits for a second admin.
+func NewAdminRetireAwardHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid award id"})
+			return
+		}
+
+		current, needsApproval, err := logic.NewApprovalLogic(ctx).AwardRetireNeedsApproval(id)
+		if err != nil {
+			c.JSON(awardErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if needsApproval {
+			summary := fmt.Sprintf("Retire grand prize #%d %q with %d in stock", id, current.Name, current.Remaining)
+			respondProposal(ctx, c, logic.OpAwardRetire, logic.AwardRetireParams{AwardID: id}, summary)
+			return
+		}
+
+		award, err := logic.NewAwardLogic(ctx).RetireAward(id)
+		if err != nil {
+			c.JSON(awardErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": award})
+	}
+}
+
+// NewAdminAwardRevisionsHandler
+func NewAdminAwardRevisionsHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid award id"})
+			return
+		}
+
+		list, err := logic.NewAwardLogic(ctx).ListRevisions(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": list})
+	}
+}
+
+// NewAdminAwardOddsHandler returns the award table in effect at ?at=RFC3339 (default now)
+func NewAdminAwardOddsHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		at := time.Now()
+		if v := c.Query("at"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "at must be RFC3339"})
+				return
+			}
+			at = t
+		}
+
+		list, err := logic.NewAwardLogic(ctx).OddsAt(at)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": list})
+	}
+}
+
+func awardErrorStatus(err error) int {
+	if errors.Is(err, logic.ErrAwardNotFound) {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, logic.ErrAwardRetired) {
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// NewAdminUploadAwardImageHandler accepts a multipart "file" field
+func NewAdminUploadAwardImageHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid award id"})
+			return
+		}
+
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing file"})
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file"})
+			return
+		}
+		defer f.Close()
+
+		// Read one byte past the limit so oversize uploads are rejected by the logic layer
+		limit := int64(ctx.Config.Storage.MaxImageKB) * 1024
+		if limit <= 0 {
+			limit = 2048 * 1024
+		}
+		data, err := io.ReadAll(io.LimitReader(f, limit+1))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file"})
+			return
+		}
+
+		img, err := logic.NewAwardLogic(ctx).UploadAwardImage(id, data)
+		if err != nil {
+			c.JSON(awardErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": img})
+	}
+}
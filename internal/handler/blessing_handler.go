@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"errors"
+	"happynewyear/internal/logic"
+	"happynewyear/internal/svc"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewAdminListBlessingsHandler
+func NewAdminListBlessingsHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := logic.NewBlessingLogic(ctx).ListBlessings()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": list})
+	}
+}
+
+// NewAdminCreateBlessingHandler
+func NewAdminCreateBlessingHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req logic.BlessingRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		b, err := logic.NewBlessingLogic(ctx).CreateBlessing(req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": b})
+	}
+}
+
+// NewAdminUpdateBlessingHandler also enables/disables a blessing via "enabled"
+func NewAdminUpdateBlessingHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid blessing id"})
+			return
+		}
+
+		var req logic.BlessingRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		b, err := logic.NewBlessingLogic(ctx).UpdateBlessing(id, req)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, logic.ErrBlessingNotFound) {
+				status = http.StatusNotFound
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": b})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"happynewyear/internal/logic"
 	"happynewyear/internal/svc"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -13,7 +14,7 @@ func NewDrawHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
 		userID := c.GetString("user_id")
 
 		l := logic.NewDrawLogic(ctx)
-		award, err := l.Draw(userID)
+		result, err := l.Draw(userID)
 		if err != nil {
 			c.JSON(http.StatusOK, gin.H{
 				"code": -1,
@@ -26,11 +27,44 @@ func NewDrawHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
 			"code": 0,
 			"msg": "success",
 			"data": gin.H{
-				"name":      award.Name,
-				"type":      award.Type,
-				"value":     award.Value,
-				"image_url": award.ImageURL,
+				"draw_id":         result.RecordID,
+				"name":            result.Award.Name,
+				"type":            result.Award.Type,
+				"value":           result.Award.Value,
+				"image_url":       result.Award.ImageURL,
+				"thumb_url":       result.Award.ThumbURL,
+				"message":         result.Message,
+				"redemption_code": result.RedemptionCode,
 			},
 		})
 	}
 }
+
+// NewDrawProofHandler returns a Merkle inclusion proof for one of the caller's draws
+func NewDrawProofHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("user_id")
+
+		drawID, err := strconv.ParseInt(c.Query("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid draw id"})
+			return
+		}
+
+		l := logic.NewCheckpointLogic(ctx)
+		proof, err := l.GetInclusionProof(userID, drawID)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"code": -1,
+				"msg":  err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code": 0,
+			"msg":  "success",
+			"data": proof,
+		})
+	}
+}
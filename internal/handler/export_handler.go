@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"fmt"
+	"happynewyear/internal/logic"
+	"happynewyear/internal/svc"
+	"happynewyear/internal/xlsx"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewAdminExportHandler streams a spreadsheet for the admin office:
+// GET /admin/exports/:kind?format=csv|xlsx&since=&until=&type=&status=
+// kind is users, draws, winners, fulfillment or departments (the last
+// two carry redemption codes and need PermRedeem); times are
+// RFC3339, type is an award type and status (fulfillment only) is
+// pending, redeemed or voided.
+func NewAdminExportHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kind := c.Param("kind")
+		sheet, ok := logic.ExportSheet(kind)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown export " + kind})
+			return
+		}
+		if !logic.HasPermission(currentAdmin(c).Role, logic.ExportPermission(kind)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "your role cannot do this"})
+			return
+		}
+		format := c.DefaultQuery("format", logic.ExportXLSX)
+		if format != logic.ExportCSV && format != logic.ExportXLSX {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or xlsx"})
+			return
+		}
+
+		f := logic.ExportFilter{Status: c.Query("status")}
+		var err error
+		for param, t := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+			if v := c.Query(param); v != "" {
+				if *t, err = time.Parse(time.RFC3339, v); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be RFC3339"})
+					return
+				}
+			}
+		}
+		if v := c.Query("type"); v != "" {
+			if f.AwardType, err = strconv.Atoi(v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid type"})
+				return
+			}
+		}
+		switch f.Status {
+		case "", logic.FulfillmentPending, logic.FulfillmentRedeemed, logic.FulfillmentVoided:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, redeemed or voided"})
+			return
+		}
+
+		contentType := "text/csv; charset=utf-8"
+		if format == logic.ExportXLSX {
+			contentType = xlsx.ContentType
+		}
+		filename := fmt.Sprintf("happynewyear_%s_%s.%s", kind, time.Now().Format("2006-01-02"), format)
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.Header("Cache-Control", "no-store")
+		c.Status(http.StatusOK)
+
+		// Rows go out as they are read: past this point a failure can only
+		// cut the download short, so it is logged rather than returned.
+		w, err := logic.NewExportWriter(c.Writer, format, sheet)
+		if err == nil {
+			err = logic.NewExportLogic(ctx).Export(kind, f, w)
+			if cerr := w.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			log.Printf("Export %s: %v", kind, err)
+			c.Abort()
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"happynewyear/internal/logic"
+	"happynewyear/internal/svc"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewAdminBroadcastHandler queues a WeCom app message to departments or everyone
+func NewAdminBroadcastHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req logic.BroadcastRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		n, err := logic.NewNotifyLogic(ctx).Broadcast(req, currentAdmin(c).Username)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": n})
+	}
+}
+
+// NewAdminListNotificationsHandler is the send log, filterable by ?status= and ?kind=
+func NewAdminListNotificationsHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		list, err := logic.NewNotifyLogic(ctx).ListNotifications(c.Query("status"), c.Query("kind"), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": list})
+	}
+}
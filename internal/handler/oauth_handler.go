@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"errors"
+	"happynewyear/internal/logic"
+	"happynewyear/internal/svc"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewWeComAuthHandler starts a WeCom login: /auth/wecom?redirect=/draw[&mode=qr|oauth]
+func NewWeComAuthHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mode := c.Query("mode")
+		if mode == "" {
+			mode = logic.DetectOAuthMode(c.GetHeader("User-Agent"))
+		}
+
+		start, err := logic.NewOAuthLogic(ctx).Begin(mode, c.Query("redirect"), callbackURL(ctx, c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Lax so the cookie survives the top-level redirect back from WeCom
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(logic.OAuthNonceCookie, start.Nonce, int(logic.OAuthStateTTL.Seconds()), "/auth/wecom", "", isHTTPS(c), true)
+		c.Redirect(http.StatusFound, start.URL)
+	}
+}
+
+// NewWeComCallbackHandler finishes the login, sets the session cookies and
+// returns the user to the page they started from.
+func NewWeComCallbackHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		nonce, _ := c.Cookie(logic.OAuthNonceCookie)
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(logic.OAuthNonceCookie, "", -1, "/auth/wecom", "", isHTTPS(c), true)
+
+		redirect, err := logic.NewOAuthLogic(ctx).Complete(c.Query("state"), nonce)
+		if err != nil {
+			loginFailed(c, "invalid_state")
+			return
+		}
+
+		code := c.Query("code")
+		if code == "" {
+			// The user backed out of the consent / QR page
+			loginFailed(c, "cancelled")
+			return
+		}
+
+		session, _, err := logic.NewUserLogic(ctx).Login(code, c.GetHeader("User-Agent"))
+		if err != nil {
+			var loginErr *logic.LoginError
+			if errors.As(err, &loginErr) {
+				loginFailed(c, loginErr.Code)
+				return
+			}
+			loginFailed(c, "login_failed")
+			return
+		}
+
+		setSessionCookies(ctx, c, session)
+		c.Redirect(http.StatusFound, redirect)
+	}
+}
+
+func loginFailed(c *gin.Context, code string) {
+	c.Redirect(http.StatusFound, "/login?error="+url.QueryEscape(code))
+}
+
+// callbackURL is WeCom.CallbackURL, or this host's callback behind the proxy
+func callbackURL(ctx *svc.ServiceContext, c *gin.Context) string {
+	if u := ctx.Config.WeCom.CallbackURL; u != "" {
+		return u
+	}
+	scheme := "http"
+	if isHTTPS(c) {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + "/auth/wecom/callback"
+}
+
+func isHTTPS(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"happynewyear/internal/logic"
+	"happynewyear/internal/svc"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewAdminListDepartmentsHandler lists the synced WeCom departments
+func NewAdminListDepartmentsHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := logic.NewOrgSyncLogic(ctx).ListDepartments()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": list})
+	}
+}
+
+// NewAdminOrgSyncHandler runs a directory sync now; ?dry_run=1 only reports
+func NewAdminOrgSyncHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dryRun := c.Query("dry_run") == "1"
+		force := c.Query("force") == "1"
+		report, err := logic.NewOrgSyncLogic(ctx).Sync(dryRun, force)
+		if err != nil {
+			// The mass-disable guard still returns the report for review
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "data": report})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": report})
+	}
+}
@@ -1,7 +1,9 @@
 package handler
 
 import (
+	"happynewyear/internal/logic"
 	"happynewyear/internal/middleware"
+	"happynewyear/internal/storage"
 	"happynewyear/internal/svc"
 	"net/http"
 
@@ -20,27 +22,94 @@ func RegisterHandlers(r *gin.Engine, ctx *svc.ServiceContext) {
 	r.StaticFile("/favicon.ico", "./static/favicon.ico")
 	r.StaticFile("/WW_verify_W6vPcrIQ7z3a1jAb.txt", "./static/WW_verify_W6vPcrIQ7z3a1jAb.txt")
 
+	// Uploaded Assets (content-addressed, safe to cache for a year)
+	if local, ok := ctx.Storage.(*storage.LocalStorage); ok {
+		uploads := r.Group(local.BaseURL, func(c *gin.Context) {
+			c.Header("Cache-Control", "public, max-age=31536000, immutable")
+			c.Next()
+		})
+		uploads.Static("/", local.Dir)
+	}
+
+	// WeCom OAuth (browser redirects, not JSON)
+	r.GET("/auth/wecom", NewWeComAuthHandler(ctx))
+	r.GET("/auth/wecom/callback", NewWeComCallbackHandler(ctx))
+
 	// API Group
 	api := r.Group("/api")
 	{
 		// User/Auth (Public Login)
 		api.GET("/user/login", NewLoginHandler(ctx))
+		api.POST("/user/refresh", NewRefreshHandler(ctx))
 		api.GET("/rank", NewRankHandler(ctx))
 
-		// Admin Routes
-		admin := api.Group("/admin")
+		// WeCom JS-SDK (public: wx.config runs before login)
+		api.GET("/wecom/jssdk", NewJSSDKConfigHandler(ctx))
+
+		// Admin Routes: route-level RBAC, see logic.rolePermissions
+		api.POST("/admin/login", middleware.AdminAudit(ctx, "admin.login"), NewAdminLoginHandler(ctx))
+		admin := api.Group("/admin", middleware.AdminAuth(ctx))
 		{
-			admin.GET("/users", NewAdminListUsersHandler(ctx))
-			admin.GET("/draws", NewAdminListDrawRecordsHandler(ctx))
-			admin.GET("/awards", NewAdminListAwardsHandler(ctx))
-			admin.POST("/reset", NewAdminResetDataHandler(ctx))
+			read := middleware.RequirePermission(logic.PermRead)
+			redeem := middleware.RequirePermission(logic.PermRedeem)
+			operate := middleware.RequirePermission(logic.PermOperate)
+			manage := middleware.RequirePermission(logic.PermManage)
+			auditBundle := middleware.RequirePermission(logic.PermAuditBundle)
+			// Mutations and sensitive reads go to the admin audit log
+			logged := func(action string) gin.HandlerFunc { return middleware.AdminAudit(ctx, action) }
+
+			admin.GET("/me", NewAdminMeHandler(ctx))
+			admin.POST("/logout", logged("admin.logout"), NewAdminLogoutHandler(ctx))
+
+			admin.GET("/stats", read, NewAdminStatsHandler(ctx))
+			admin.GET("/stats/stream", read, NewAdminStatsStreamHandler(ctx))
+			admin.GET("/users", logged("users.list"), read, NewAdminListUsersHandler(ctx))
+			admin.POST("/users/:user_id/adjustments", logged("adjustments.create"), operate, NewAdminAdjustHandler(ctx))
+			admin.GET("/adjustments", read, NewAdminListAdjustmentsHandler(ctx))
+			admin.POST("/adjustments/batch", logged("adjustments.batch"), operate, NewAdminAdjustBatchHandler(ctx))
+			admin.POST("/users/:user_id/revoke-sessions", logged("users.revoke_sessions"), operate, NewAdminRevokeSessionsHandler(ctx))
+			admin.GET("/draws", logged("draws.list"), read, NewAdminListDrawRecordsHandler(ctx))
+			admin.GET("/exports/:kind", logged("exports.download"), read, NewAdminExportHandler(ctx))
+			admin.GET("/awards", read, NewAdminListAwardsHandler(ctx))
+			admin.POST("/awards", logged("awards.create"), operate, NewAdminCreateAwardHandler(ctx))
+			admin.GET("/awards/odds", read, NewAdminAwardOddsHandler(ctx))
+			admin.PUT("/awards/:id", logged("awards.update"), operate, NewAdminUpdateAwardHandler(ctx))
+			admin.POST("/awards/:id/retire", logged("awards.retire"), operate, NewAdminRetireAwardHandler(ctx))
+			admin.GET("/awards/:id/revisions", read, NewAdminAwardRevisionsHandler(ctx))
+			admin.POST("/awards/:id/image", logged("awards.image"), operate, NewAdminUploadAwardImageHandler(ctx))
+			admin.GET("/redemptions/:code", logged("redemptions.lookup"), redeem, NewAdminLookupRedemptionHandler(ctx))
+			admin.POST("/redemptions/:code", logged("redemptions.redeem"), redeem, NewAdminRedeemHandler(ctx))
+			admin.POST("/reset", logged("data.reset.propose"), manage, NewAdminResetDataHandler(ctx))
+			admin.GET("/snapshots", manage, NewAdminListSnapshotsHandler(ctx))
+			admin.POST("/snapshots", logged("snapshots.create"), manage, NewAdminCreateSnapshotHandler(ctx))
+			admin.POST("/snapshots/:id/restore", logged("data.restore.propose"), manage, NewAdminRestoreSnapshotHandler(ctx))
+			admin.GET("/checkpoints", read, NewAdminListCheckpointsHandler(ctx))
+			admin.GET("/blessings", read, NewAdminListBlessingsHandler(ctx))
+			admin.POST("/blessings", logged("blessings.create"), operate, NewAdminCreateBlessingHandler(ctx))
+			admin.PUT("/blessings/:id", logged("blessings.update"), operate, NewAdminUpdateBlessingHandler(ctx))
+			admin.GET("/notifications", read, NewAdminListNotificationsHandler(ctx))
+			admin.POST("/notifications/broadcast", logged("notifications.broadcast"), operate, NewAdminBroadcastHandler(ctx))
+			admin.GET("/departments", read, NewAdminListDepartmentsHandler(ctx))
+			admin.POST("/orgsync", logged("orgsync.run"), operate, NewAdminOrgSyncHandler(ctx))
+			admin.GET("/accounts", logged("accounts.list"), manage, NewAdminListAccountsHandler(ctx))
+			admin.POST("/accounts", logged("accounts.create"), manage, NewAdminCreateAccountHandler(ctx))
+			admin.PUT("/accounts/:id", logged("accounts.update"), manage, NewAdminUpdateAccountHandler(ctx))
+			admin.GET("/approvals", read, NewAdminListApprovalsHandler(ctx))
+			admin.POST("/approvals/:id/approve", logged("approvals.approve"), operate, NewAdminApproveHandler(ctx))
+			admin.POST("/approvals/:id/reject", logged("approvals.reject"), operate, NewAdminRejectHandler(ctx))
+			admin.GET("/audit-log", logged("audit.list"), manage, NewAdminListAuditHandler(ctx))
+			admin.GET("/audit-log/verify", logged("audit.verify"), manage, NewAdminVerifyAuditHandler(ctx))
+			// Auditor accounts and super-admins; under /admin so the console cookie is sent
+			admin.GET("/audit/bundle", logged("audit.bundle"), auditBundle, NewAuditBundleHandler(ctx))
 		}
 
 		// Protected Routes
-		protected := api.Group("/", middleware.AuthMiddleware(ctx.Config))
+		protected := api.Group("/", middleware.AuthMiddleware(ctx))
 		{
 			// User Info
 			protected.GET("/user/info", NewUserInfoHandler(ctx))
+			protected.POST("/user/logout", NewLogoutHandler(ctx))
+			protected.POST("/user/logout-all", NewLogoutAllHandler(ctx))
 
 			// Game
 			protected.POST("/game/start", NewGameStartHandler(ctx))
@@ -48,6 +117,7 @@ func RegisterHandlers(r *gin.Engine, ctx *svc.ServiceContext) {
 
 			// Draw
 			protected.POST("/draw", NewDrawHandler(ctx))
+			protected.GET("/draw/proof", NewDrawProofHandler(ctx))
 		}
 	}
 
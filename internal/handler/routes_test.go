@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"happynewyear/internal/keyring"
+	"happynewyear/internal/logic"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testUserAgent = "console-test"
+
+// testContext serves admin accounts from account without a database. The
+// Redis session store is only connected when TEST_REDIS_ADDR is set.
+func testContext(t *testing.T, account *model.AdminAccount) *svc.ServiceContext {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "dry:run@tcp(127.0.0.1:1)/dry", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, SkipDefaultTransaction: true, DisableAutomaticPing: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Callback().Query().After("gorm:query").Register("test:admin_account", func(tx *gorm.DB) {
+		if dest, ok := tx.Statement.Dest.(*model.AdminAccount); ok && account != nil {
+			*dest = *account
+		}
+	})
+
+	keys, err := keyring.New([]keyring.Key{{ID: "k1", Secret: []byte("test-secret")}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &svc.ServiceContext{DB: db, JWTKeys: keys}
+	ctx.Config.Auth.InsecureCookies = true
+
+	if addr := os.Getenv("TEST_REDIS_ADDR"); addr != "" {
+		ctx.Redis = redis.NewClient(&redis.Options{Addr: addr, DB: 15})
+		if err := ctx.Redis.FlushDB(context.Background()).Err(); err != nil {
+			t.Fatalf("redis: %v", err)
+		}
+		t.Cleanup(func() { ctx.Redis.Close() })
+	}
+	return ctx
+}
+
+// consoleClient logs in the way the console does: the server sets the admin
+// cookies and a browser-like cookie jar decides where to send them
+func consoleClient(t *testing.T, ctx *svc.ServiceContext, session *logic.Session) (*httptest.Server, *http.Client) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/test/login", func(c *gin.Context) { setAdminCookies(ctx, c, session) })
+	RegisterHandlers(r, ctx)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	resp, err := client.Post(srv.URL+"/test/login", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return srv, client
+}
+
+func get(t *testing.T, client *http.Client, url string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("User-Agent", testUserAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Error string `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body.Error
+}
+
+func TestAuditBundleReceivesAdminCookie(t *testing.T) {
+	ctx := testContext(t, nil)
+	srv, client := consoleClient(t, ctx, &logic.Session{Token: "not-a-jwt", ExpiresAt: time.Now().Add(time.Hour)})
+
+	// The browser sends the cookie, so the token itself is what gets rejected
+	if status, msg := get(t, client, srv.URL+"/api/admin/audit/bundle?format=zip"); status != http.StatusUnauthorized || msg == "admin login required" {
+		t.Errorf("bundle: %d %q, want the console cookie to be checked", status, msg)
+	}
+}
+
+func TestAuditBundleWithAdminCookie(t *testing.T) {
+	if os.Getenv("TEST_REDIS_ADDR") == "" {
+		t.Skip("TEST_REDIS_ADDR not set")
+	}
+
+	cases := []struct {
+		role  string
+		allow bool
+	}{
+		{logic.RoleAuditor, true},
+		{logic.RoleSuperAdmin, true},
+		{logic.RoleViewer, false},
+		{logic.RoleOperator, false},
+	}
+	for _, tc := range cases {
+		account := &model.AdminAccount{ID: 7, Username: "audit", Role: tc.role}
+		ctx := testContext(t, account)
+		session, err := logic.NewSessionLogic(ctx).CreateAdmin(account, testUserAgent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv, client := consoleClient(t, ctx, session)
+
+		status, msg := get(t, client, srv.URL+"/api/admin/audit/bundle?format=zip")
+		if status == http.StatusUnauthorized {
+			t.Errorf("%s: admin cookie not accepted: %q", tc.role, msg)
+		}
+		if denied := status == http.StatusForbidden; denied == tc.allow {
+			t.Errorf("%s: status %d %q", tc.role, status, msg)
+		}
+	}
+}
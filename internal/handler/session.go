@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"happynewyear/internal/logic"
+	"happynewyear/internal/svc"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setSessionCookies stores the access and refresh tokens HttpOnly and the
+// CSRF token readable by the SPA. The refresh cookie is only sent to the
+// refresh endpoint.
+func setSessionCookies(ctx *svc.ServiceContext, c *gin.Context, s *logic.Session) {
+	sessionAge := int(time.Until(s.RefreshExpiresAt).Seconds())
+	secure := !ctx.Config.Auth.InsecureCookies
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(logic.SessionCookie, s.Token, int(time.Until(s.ExpiresAt).Seconds()), "/", "", secure, true)
+	c.SetCookie(logic.RefreshCookie, s.RefreshToken, sessionAge, logic.RefreshPath, "", secure, true)
+	c.SetCookie(logic.CSRFCookie, s.CSRF, sessionAge, "/", "", secure, false)
+}
+
+func clearSessionCookies(ctx *svc.ServiceContext, c *gin.Context) {
+	secure := !ctx.Config.Auth.InsecureCookies
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(logic.SessionCookie, "", -1, "/", "", secure, true)
+	c.SetCookie(logic.RefreshCookie, "", -1, logic.RefreshPath, "", secure, true)
+	c.SetCookie(logic.CSRFCookie, "", -1, "/", "", secure, false)
+}
+
+// setAdminCookies keeps the console session next to, not instead of, the player one
+func setAdminCookies(ctx *svc.ServiceContext, c *gin.Context, s *logic.Session) {
+	maxAge := int(time.Until(s.ExpiresAt).Seconds())
+	secure := !ctx.Config.Auth.InsecureCookies
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(logic.AdminSessionCookie, s.Token, maxAge, "/api/admin", "", secure, true)
+	c.SetCookie(logic.AdminCSRFCookie, s.CSRF, maxAge, "/", "", secure, false)
+}
+
+func clearAdminCookies(ctx *svc.ServiceContext, c *gin.Context) {
+	secure := !ctx.Config.Auth.InsecureCookies
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(logic.AdminSessionCookie, "", -1, "/api/admin", "", secure, true)
+	c.SetCookie(logic.AdminCSRFCookie, "", -1, "/", "", secure, false)
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"happynewyear/internal/logic"
+	"happynewyear/internal/svc"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// statsStreamMaxAge closes a dashboard stream now and then. EventSource
+// reconnects by itself, which re-checks the admin session, so a revoked
+// admin stops receiving figures within this window.
+const statsStreamMaxAge = 10 * time.Minute
+
+// NewAdminStatsHandler returns one reading of the operations dashboard
+func NewAdminStatsHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stats, err := logic.NewStatsLogic(ctx).Stats()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": stats})
+	}
+}
+
+// NewAdminStatsStreamHandler pushes a reading every Stats.StreamIntervalSeconds
+// as server-sent events: "stats" carries the same JSON as GET /admin/stats,
+// "error" carries {"error": ...} when a reading fails.
+func NewAdminStatsStreamHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		l := logic.NewStatsLogic(ctx)
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no") // Keep nginx from holding events back
+
+		ticker := time.NewTicker(l.StreamInterval())
+		defer ticker.Stop()
+		deadline := time.After(statsStreamMaxAge)
+		send := func() {
+			if stats, err := l.Stats(); err != nil {
+				c.SSEvent("error", gin.H{"error": err.Error()})
+			} else {
+				c.SSEvent("stats", stats)
+			}
+		}
+
+		send()
+		c.Writer.Flush()
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case <-c.Request.Context().Done():
+				return false
+			case <-deadline:
+				return false
+			case <-ticker.C:
+				send()
+				return true
+			}
+		})
+	}
+}
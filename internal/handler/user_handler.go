@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"happynewyear/internal/logic"
 	"happynewyear/internal/svc"
 	"net/http"
@@ -8,7 +9,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// LoginHandler
+// LoginHandler exchanges a code directly. Browsers go through /auth/wecom;
+// this stays for tooling, which gets the token in the body when Auth.AllowBearer is on.
 func NewLoginHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		code := c.Query("code")
@@ -18,16 +20,93 @@ func NewLoginHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
 		}
 
 		l := logic.NewUserLogic(ctx)
-		token, user, err := l.Login(code)
+		session, user, err := l.Login(code, c.GetHeader("User-Agent"))
 		if err != nil {
+			var loginErr *logic.LoginError
+			if errors.As(err, &loginErr) {
+				c.JSON(loginErrorStatus(loginErr.Code), gin.H{"error": loginErr.Msg, "error_code": loginErr.Code})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"token": token,
-			"user":  user,
-		})
+		setSessionCookies(ctx, c, session)
+		resp := gin.H{"user": user}
+		if ctx.Config.Auth.AllowBearer {
+			resp["token"] = session.Token
+			resp["refresh_token"] = session.RefreshToken
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// NewRefreshHandler swaps the refresh cookie (or, with Auth.AllowBearer, a
+// refresh_token in the body) for a new access token and refresh token.
+func NewRefreshHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		refreshToken, fromCookie := "", false
+		if cookie, err := c.Cookie(logic.RefreshCookie); err == nil && cookie != "" {
+			refreshToken, fromCookie = cookie, true
+		} else if ctx.Config.Auth.AllowBearer {
+			var req struct {
+				RefreshToken string `json:"refresh_token"`
+			}
+			c.ShouldBindJSON(&req)
+			refreshToken = req.RefreshToken
+		}
+		if refreshToken == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "login required"})
+			return
+		}
+
+		session, err := logic.NewSessionLogic(ctx).Refresh(refreshToken, c.GetHeader("User-Agent"), c.GetHeader(logic.CSRFHeader), fromCookie)
+		switch {
+		case errors.Is(err, logic.ErrRefreshRaced):
+			// Another tab already refreshed; its cookies are in the jar
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, logic.ErrSessionStore):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			clearSessionCookies(ctx, c)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		setSessionCookies(ctx, c, session)
+		resp := gin.H{"expires_at": session.ExpiresAt}
+		if ctx.Config.Auth.AllowBearer && !fromCookie {
+			resp["token"] = session.Token
+			resp["refresh_token"] = session.RefreshToken
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// NewLogoutHandler ends the current session and clears its cookies
+func NewLogoutHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := logic.NewSessionLogic(ctx).Revoke(c.GetString("session_id")); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		clearSessionCookies(ctx, c)
+		c.JSON(http.StatusOK, gin.H{"message": "success"})
+	}
+}
+
+// NewLogoutAllHandler ends every session of the current user ("log out everywhere")
+func NewLogoutAllHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		n, err := logic.NewSessionLogic(ctx).RevokeUser(c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		clearSessionCookies(ctx, c)
+		c.JSON(http.StatusOK, gin.H{"message": "success", "sessions": n})
 	}
 }
 
@@ -50,3 +129,14 @@ func NewUserInfoHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
 		c.JSON(http.StatusOK, gin.H{"user": user})
 	}
 }
+
+func loginErrorStatus(code string) int {
+	switch code {
+	case logic.LoginErrInvalidCode:
+		return http.StatusUnauthorized
+	case logic.LoginErrNotMember:
+		return http.StatusForbidden
+	default:
+		return http.StatusBadGateway
+	}
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"errors"
+	"happynewyear/internal/logic"
+	"happynewyear/internal/svc"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewJSSDKConfigHandler signs wx.config and wx.agentConfig for ?url=
+func NewJSSDKConfigHandler(ctx *svc.ServiceContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pageURL := c.Query("url")
+		if pageURL == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"code": -1, "msg": "missing url"})
+			return
+		}
+
+		cfg, err := logic.NewJSSDKLogic(ctx).Sign(pageURL)
+		if err != nil {
+			status := http.StatusBadGateway
+			if errors.Is(err, logic.ErrJSSDKURLNotAllowed) {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, gin.H{"code": -1, "msg": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code": 0,
+			"msg":  "success",
+			"data": cfg,
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package keyring
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"happynewyear/internal/config"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultGrace = time.Hour
+	// minSecretLen is in bytes, for configured keys; generated ones are 64
+	minSecretLen = 16
+)
+
+var ErrNoActiveKey = errors.New("keyring has no active key")
+
+// Key is one signing secret. It signs from NotBefore until a newer key takes
+// over, and keeps verifying for the grace period after that.
+type Key struct {
+	ID        string
+	Secret    []byte
+	NotBefore time.Time
+}
+
+// State of a key at a point in time
+const (
+	StateStaged  = "staged"  // Verifies, doesn't sign yet
+	StateCurrent = "current" // Signs and verifies
+	StateGrace   = "grace"   // Replaced less than the grace period ago; verifies only
+	StateRetired = "retired" // Safe to remove
+)
+
+// Keyring holds the keys for one purpose, oldest first. Staged keys verify
+// right away so every replica accepts a new key before any of them signs
+// with it; that is what makes a rolling rotation log nobody out.
+type Keyring struct {
+	keys  []Key
+	grace time.Duration
+}
+
+func New(keys []Key, grace time.Duration) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoActiveKey
+	}
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if k.ID == "" || strings.ContainsAny(k.ID, ",=@") {
+			return nil, fmt.Errorf("invalid key id %q", k.ID)
+		}
+		if seen[k.ID] {
+			return nil, fmt.Errorf("duplicate key id %q", k.ID)
+		}
+		seen[k.ID] = true
+		if len(k.Secret) == 0 {
+			return nil, fmt.Errorf("key %s has no secret", k.ID)
+		}
+	}
+	if grace <= 0 {
+		grace = DefaultGrace
+	}
+
+	sorted := append([]Key(nil), keys...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].NotBefore.Before(sorted[j].NotBefore) })
+	return &Keyring{keys: sorted, grace: grace}, nil
+}
+
+// current is the index of the newest key whose NotBefore has passed, or -1
+func (r *Keyring) current(now time.Time) int {
+	idx := -1
+	for i, k := range r.keys {
+		if !k.NotBefore.After(now) {
+			idx = i
+		}
+	}
+	return idx
+}
+
+func (r *Keyring) state(i, cur int, now time.Time) string {
+	switch {
+	case i == cur:
+		return StateCurrent
+	case i > cur:
+		return StateStaged
+	case now.Before(r.keys[i+1].NotBefore.Add(r.grace)):
+		return StateGrace
+	default:
+		return StateRetired
+	}
+}
+
+// Signing returns the key new signatures use
+func (r *Keyring) Signing(now time.Time) (Key, error) {
+	cur := r.current(now)
+	if cur < 0 {
+		return Key{}, ErrNoActiveKey
+	}
+	return r.keys[cur], nil
+}
+
+// Lookup finds a key by id if it may still verify
+func (r *Keyring) Lookup(id string, now time.Time) (Key, bool) {
+	cur := r.current(now)
+	for i, k := range r.keys {
+		if k.ID == id {
+			return k, r.state(i, cur, now) != StateRetired
+		}
+	}
+	return Key{}, false
+}
+
+// Verifying returns every key that may still verify, current key first, for
+// signatures that don't carry a key id
+func (r *Keyring) Verifying(now time.Time) []Key {
+	cur := r.current(now)
+	var keys []Key
+	if cur >= 0 {
+		keys = append(keys, r.keys[cur])
+	}
+	for i := len(r.keys) - 1; i >= 0; i-- {
+		if i != cur && r.state(i, cur, now) != StateRetired {
+			keys = append(keys, r.keys[i])
+		}
+	}
+	return keys
+}
+
+type KeyStatus struct {
+	ID        string
+	NotBefore time.Time
+	State     string
+}
+
+func (r *Keyring) Status(now time.Time) []KeyStatus {
+	cur := r.current(now)
+	list := make([]KeyStatus, len(r.keys))
+	for i, k := range r.keys {
+		list[i] = KeyStatus{ID: k.ID, NotBefore: k.NotBefore, State: r.state(i, cur, now)}
+	}
+	return list
+}
+
+// Rotate returns the keys with a new one staged to sign from notBefore, and
+// without keys that will already be retired by then
+func (r *Keyring) Rotate(prefix string, notBefore time.Time) ([]Key, error) {
+	next := Key{
+		ID:        prefix + "-" + notBefore.Format("20060102-1504"),
+		Secret:    randomSecret(),
+		NotBefore: notBefore,
+	}
+	var keys []Key
+	for _, k := range r.keys {
+		if k.ID == next.ID {
+			return nil, fmt.Errorf("key %s already exists", next.ID)
+		}
+		keys = append(keys, k)
+	}
+	keys = append(keys, next)
+
+	staged, err := New(keys, r.grace)
+	if err != nil {
+		return nil, err
+	}
+	// The current key stays for its grace period after the new one takes over
+	var kept []Key
+	for _, s := range staged.Status(notBefore) {
+		if s.State != StateRetired {
+			k, _ := staged.find(s.ID)
+			kept = append(kept, k)
+		}
+	}
+	return kept, nil
+}
+
+func (r *Keyring) find(id string) (Key, bool) {
+	for _, k := range r.keys {
+		if k.ID == id {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
+
+// FromConfig builds the JWT and game keyrings. Without Keys configured both
+// fall back to Game.AppSecret, the game key as-is (clients already sign
+// with it) and the JWT key derived from it so the two never coincide.
+func FromConfig(c config.Config) (jwtKeys, gameKeys *Keyring, err error) {
+	grace := time.Duration(c.Keys.GraceMinutes) * time.Minute
+
+	jwtList, err := fromSigningKeys(c.Keys.JWT)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Keys.JWT: %v", err)
+	}
+	if len(jwtList) == 0 && c.Game.AppSecret != "" {
+		mac := hmac.New(sha256.New, []byte(c.Game.AppSecret))
+		mac.Write([]byte("happynewyear-jwt"))
+		jwtList = []Key{{ID: "legacy-jwt", Secret: []byte(hex.EncodeToString(mac.Sum(nil)))}}
+	}
+	gameList, err := fromSigningKeys(c.Keys.Game)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Keys.Game: %v", err)
+	}
+	if len(gameList) == 0 && c.Game.AppSecret != "" {
+		gameList = []Key{{ID: "legacy", Secret: []byte(c.Game.AppSecret)}}
+	}
+
+	if jwtKeys, err = New(jwtList, grace); err != nil {
+		return nil, nil, fmt.Errorf("Keys.JWT: %v", err)
+	}
+	if gameKeys, err = New(gameList, grace); err != nil {
+		return nil, nil, fmt.Errorf("Keys.Game: %v", err)
+	}
+	if _, err := jwtKeys.Signing(time.Now()); err != nil {
+		return nil, nil, fmt.Errorf("Keys.JWT: %v", err)
+	}
+	if _, err := gameKeys.Signing(time.Now()); err != nil {
+		return nil, nil, fmt.Errorf("Keys.Game: %v", err)
+	}
+	return jwtKeys, gameKeys, nil
+}
+
+func fromSigningKeys(list []config.SigningKey) ([]Key, error) {
+	keys := make([]Key, 0, len(list))
+	for _, sk := range list {
+		if len(sk.Secret) < minSecretLen {
+			return nil, fmt.Errorf("key %s: secret must be at least %d bytes", sk.ID, minSecretLen)
+		}
+		k := Key{ID: sk.ID, Secret: []byte(sk.Secret)}
+		if sk.NotBefore != "" {
+			t, err := time.Parse(time.RFC3339, sk.NotBefore)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: NotBefore: %v", sk.ID, err)
+			}
+			k.NotBefore = t
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// ToSigningKeys is the inverse of fromSigningKeys, for printing a rotated ring
+func ToSigningKeys(keys []Key) []config.SigningKey {
+	list := make([]config.SigningKey, len(keys))
+	for i, k := range keys {
+		list[i] = config.SigningKey{ID: k.ID, Secret: string(k.Secret)}
+		if !k.NotBefore.IsZero() {
+			list[i].NotBefore = k.NotBefore.Format(time.RFC3339)
+		}
+	}
+	return list
+}
+
+func randomSecret() []byte {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return []byte(hex.EncodeToString(b))
+}
@@ -0,0 +1,79 @@
+package keyring
+
+import (
+	"testing"
+	"time"
+)
+
+func testRing(t *testing.T, grace time.Duration, keys ...Key) *Keyring {
+	t.Helper()
+	r, err := New(keys, grace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestKeyringRotation(t *testing.T) {
+	t0 := time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+	r := testRing(t, time.Hour,
+		Key{ID: "new", Secret: []byte("s2"), NotBefore: t0},
+		Key{ID: "old", Secret: []byte("s1")},
+	)
+
+	// Before the switch: old signs, new is staged but already verifies
+	if k, _ := r.Signing(t0.Add(-time.Minute)); k.ID != "old" {
+		t.Errorf("signing before switch = %s", k.ID)
+	}
+	if _, ok := r.Lookup("new", t0.Add(-time.Minute)); !ok {
+		t.Error("a staged key should verify")
+	}
+
+	// After: new signs, old verifies for the grace period only
+	if k, _ := r.Signing(t0); k.ID != "new" {
+		t.Errorf("signing after switch = %s", k.ID)
+	}
+	if _, ok := r.Lookup("old", t0.Add(59*time.Minute)); !ok {
+		t.Error("the previous key should verify during grace")
+	}
+	if _, ok := r.Lookup("old", t0.Add(time.Hour)); ok {
+		t.Error("the previous key should be retired after grace")
+	}
+	if got := r.Verifying(t0.Add(time.Minute)); len(got) != 2 || got[0].ID != "new" {
+		t.Errorf("verifying = %v", got)
+	}
+	if _, ok := r.Lookup("unknown", t0); ok {
+		t.Error("unknown kid should not verify")
+	}
+}
+
+func TestKeyringRotatePrunesRetired(t *testing.T) {
+	t0 := time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+	r := testRing(t, time.Hour,
+		Key{ID: "a", Secret: []byte("s1")},
+		Key{ID: "b", Secret: []byte("s2"), NotBefore: t0},
+	)
+
+	keys, err := r.Rotate("jwt", t0.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].ID != "b" || keys[1].ID != "jwt-20260211-1200" {
+		t.Fatalf("rotated ring = %v", keys)
+	}
+	if len(keys[1].Secret) != 64 {
+		t.Error("generated secret should be 32 bytes hex")
+	}
+}
+
+func TestKeyringRejectsBadKeys(t *testing.T) {
+	if _, err := New([]Key{{ID: "a", Secret: []byte("x")}, {ID: "a", Secret: []byte("y")}}, 0); err == nil {
+		t.Error("duplicate ids should be rejected")
+	}
+	if _, err := New([]Key{{ID: "a=b", Secret: []byte("x")}}, 0); err == nil {
+		t.Error("ids must survive the env format")
+	}
+	if _, err := New(nil, 0); err != ErrNoActiveKey {
+		t.Error("an empty ring should be rejected")
+	}
+}
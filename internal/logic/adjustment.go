@@ -0,0 +1,385 @@
+package logic
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Adjustment kinds
+const (
+	AdjustChances = "chances"
+	AdjustPoints  = "points"
+)
+
+const (
+	defaultMaxAdjustChances = 20
+	defaultMaxAdjustPoints  = 1000
+	defaultMaxBatchRows     = 500
+)
+
+var (
+	ErrLeaderboardFrozen = errors.New("the leaderboard is frozen; points can no longer change")
+	ErrNeedsApproval     = errors.New("chance grants above the approval threshold need a second admin")
+)
+
+// Adjustment is one manual change to a user's chances or points. It only
+// ever touches users.chances and users.total_score: awards and draw records
+// are out of reach, so no admin can hand anyone a prize.
+type Adjustment struct {
+	UserID string `json:"user_id"`
+	Kind   string `json:"kind"`
+	Delta  int64  `json:"delta"`
+	Reason string `json:"reason"`
+}
+
+// AdjustmentRowError is a rejected CSV row; Line counts the header as 1
+type AdjustmentRowError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// AdjustmentBatchError rejects a whole CSV upload
+type AdjustmentBatchError struct {
+	Rows []AdjustmentRowError
+}
+
+func (e *AdjustmentBatchError) Error() string {
+	return fmt.Sprintf("%d rows rejected, nothing was applied", len(e.Rows))
+}
+
+type AdjustmentLogic struct {
+	ctx *svc.ServiceContext
+}
+
+func NewAdjustmentLogic(ctx *svc.ServiceContext) *AdjustmentLogic {
+	return &AdjustmentLogic{ctx: ctx}
+}
+
+func (l *AdjustmentLogic) limit(kind string) int64 {
+	c := l.ctx.Config.Adjustments
+	if kind == AdjustChances {
+		if c.MaxChances > 0 {
+			return int64(c.MaxChances)
+		}
+		return defaultMaxAdjustChances
+	}
+	if c.MaxPoints > 0 {
+		return int64(c.MaxPoints)
+	}
+	return defaultMaxAdjustPoints
+}
+
+func (l *AdjustmentLogic) maxBatchRows() int {
+	if n := l.ctx.Config.Adjustments.MaxBatchRows; n > 0 {
+		return n
+	}
+	return defaultMaxBatchRows
+}
+
+// Validate checks one adjustment against the caps. It does not look at the
+// user's balance; applyAdjustment does that under a row lock.
+func (l *AdjustmentLogic) Validate(a *Adjustment) error {
+	a.UserID = strings.TrimSpace(a.UserID)
+	a.Kind = strings.ToLower(strings.TrimSpace(a.Kind))
+	a.Reason = strings.TrimSpace(a.Reason)
+	if a.UserID == "" {
+		return errors.New("user_id is required")
+	}
+	if a.Kind != AdjustChances && a.Kind != AdjustPoints {
+		return fmt.Errorf("kind must be %s or %s", AdjustChances, AdjustPoints)
+	}
+	if a.Delta == 0 {
+		return errors.New("delta must not be zero")
+	}
+	if max := l.limit(a.Kind); a.Delta > max || a.Delta < -max {
+		return fmt.Errorf("%s change is capped at %d", a.Kind, max)
+	}
+	if a.Reason == "" {
+		return errors.New("reason is required")
+	}
+	if utf8.RuneCountInString(a.Reason) > 255 {
+		return errors.New("reason must be at most 255 characters")
+	}
+	if a.Kind == AdjustPoints {
+		frozen, err := l.leaderboardFrozen()
+		if err != nil {
+			return err
+		}
+		if frozen {
+			return ErrLeaderboardFrozen
+		}
+	}
+	return nil
+}
+
+// checkChanceGrants returns ErrNeedsApproval if the chance grants in items
+// take any user above Approval.ChanceGrantThreshold. A user's grants add up,
+// within items and with those applied in the last ChanceGrantWindowHours, so
+// a large grant can't be split into rows or requests that each pass on their
+// own. The users are locked first, in a fixed order: concurrent grants to
+// the same user queue up, and the window sum, being the first plain read of
+// the transaction, sees every grant committed before the lock was ours.
+func (l *AdjustmentLogic) checkChanceGrants(tx *gorm.DB, items []Adjustment) error {
+	pending := chanceGrants(items)
+	if len(pending) == 0 {
+		return nil
+	}
+	users := make([]string, 0, len(pending))
+	for userID := range pending {
+		users = append(users, userID)
+	}
+	sort.Strings(users)
+
+	var locked []model.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "user_id").
+		Where("user_id IN ?", users).
+		Order("user_id").
+		Find(&locked).Error; err != nil {
+		return err
+	}
+
+	approval := NewApprovalLogic(l.ctx)
+	var recent []struct {
+		UserID string
+		Total  int64
+	}
+	err := tx.Model(&model.BalanceAdjustment{}).
+		Select("user_id, SUM(delta) AS total").
+		Where("kind = ? AND delta > 0 AND created_at >= ? AND user_id IN ?",
+			AdjustChances, time.Now().Add(-approval.ChanceGrantWindow()), users).
+		Group("user_id").Find(&recent).Error
+	if err != nil {
+		return err
+	}
+	for _, r := range recent {
+		pending[r.UserID] += r.Total
+	}
+	threshold := int64(approval.ChanceGrantThreshold())
+	for _, total := range pending {
+		if total > threshold {
+			return ErrNeedsApproval
+		}
+	}
+	return nil
+}
+
+// chanceGrants sums the chance grants in items per user. Revocations don't
+// offset them: granting and revoking in turn must not reset the count.
+func chanceGrants(items []Adjustment) map[string]int64 {
+	grants := map[string]int64{}
+	for _, a := range items {
+		if a.Kind == AdjustChances && a.Delta > 0 {
+			grants[a.UserID] += a.Delta
+		}
+	}
+	return grants
+}
+
+func (l *AdjustmentLogic) leaderboardFrozen() (bool, error) {
+	freezeAt := l.ctx.Config.Game.LeaderboardFreezeAt
+	if freezeAt == "" {
+		return false, nil
+	}
+	t, err := time.Parse(time.RFC3339, freezeAt)
+	if err != nil {
+		return false, fmt.Errorf("invalid LeaderboardFreezeAt: %v", err)
+	}
+	return !time.Now().Before(t), nil
+}
+
+// Adjust applies one adjustment. Unless approved by a second admin, a chance
+// grant above the approval threshold returns ErrNeedsApproval instead.
+func (l *AdjustmentLogic) Adjust(a Adjustment, actor string, approved bool) (*model.BalanceAdjustment, error) {
+	if err := l.Validate(&a); err != nil {
+		return nil, err
+	}
+	var row *model.BalanceAdjustment
+	err := l.ctx.DB.Transaction(func(tx *gorm.DB) error {
+		if !approved {
+			if err := l.checkChanceGrants(tx, []Adjustment{a}); err != nil {
+				return err
+			}
+		}
+		var err error
+		row, err = applyAdjustment(tx, a, actor, "")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	NewStatsLogic(l.ctx).Adjusted([]model.BalanceAdjustment{*row})
+	return row, nil
+}
+
+// AdjustBatch applies a CSV upload all or nothing. Any invalid row, or a
+// revoke that would go below zero, rejects the whole batch with an
+// *AdjustmentBatchError. Unless approved, chance grants above the approval
+// threshold hold back the whole batch with ErrNeedsApproval.
+func (l *AdjustmentLogic) AdjustBatch(items []Adjustment, actor string, approved bool) ([]model.BalanceAdjustment, error) {
+	if err := l.ValidateBatch(items); err != nil {
+		return nil, err
+	}
+	batchID := randomHex(8)
+	var rows []model.BalanceAdjustment
+	err := l.ctx.DB.Transaction(func(tx *gorm.DB) error {
+		if !approved {
+			if err := l.checkChanceGrants(tx, items); err != nil {
+				return err
+			}
+		}
+		var rowErrs []AdjustmentRowError
+		for i, a := range items {
+			row, err := applyAdjustment(tx, a, actor, batchID)
+			if err != nil {
+				rowErrs = append(rowErrs, AdjustmentRowError{Line: i + 2, Error: err.Error()})
+				continue
+			}
+			rows = append(rows, *row)
+		}
+		if len(rowErrs) > 0 {
+			return &AdjustmentBatchError{Rows: rowErrs}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	NewStatsLogic(l.ctx).Adjusted(rows)
+	return rows, nil
+}
+
+// ValidateBatch checks every row of an upload before anything is applied
+func (l *AdjustmentLogic) ValidateBatch(items []Adjustment) error {
+	if len(items) == 0 {
+		return errors.New("the file has no rows")
+	}
+	if len(items) > l.maxBatchRows() {
+		return fmt.Errorf("at most %d rows per upload", l.maxBatchRows())
+	}
+	var rowErrs []AdjustmentRowError
+	for i := range items {
+		if err := l.Validate(&items[i]); err != nil {
+			rowErrs = append(rowErrs, AdjustmentRowError{Line: i + 2, Error: err.Error()})
+		}
+	}
+	if len(rowErrs) > 0 {
+		return &AdjustmentBatchError{Rows: rowErrs}
+	}
+	return nil
+}
+
+// applyAdjustment changes the balance under a row lock and writes the ledger
+func applyAdjustment(tx *gorm.DB, a Adjustment, actor, batchID string) (*model.BalanceAdjustment, error) {
+	var user model.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", a.UserID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrUserNotFound, a.UserID)
+		}
+		return nil, err
+	}
+
+	column, balance := "chances", int64(user.Chances)
+	if a.Kind == AdjustPoints {
+		column, balance = "total_score", user.TotalScore
+	}
+	if balance+a.Delta < 0 {
+		return nil, fmt.Errorf("%s has only %d %s", a.UserID, balance, a.Kind)
+	}
+	balance += a.Delta
+	if err := tx.Model(&user).Update(column, balance).Error; err != nil {
+		return nil, err
+	}
+
+	row := model.BalanceAdjustment{
+		UserID:  a.UserID,
+		Kind:    a.Kind,
+		Delta:   a.Delta,
+		Balance: balance,
+		Reason:  a.Reason,
+		Actor:   truncate(actor, 128),
+		BatchID: batchID,
+	}
+	if err := tx.Create(&row).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// List returns the ledger, newest first; userID "" lists everyone
+func (l *AdjustmentLogic) List(userID string) ([]model.BalanceAdjustment, error) {
+	q := l.ctx.DB.Order("id desc").Limit(500)
+	if userID != "" {
+		q = q.Where("user_id = ?", userID)
+	}
+	var list []model.BalanceAdjustment
+	err := q.Find(&list).Error
+	return list, err
+}
+
+// ParseAdjustmentCSV reads an upload with the header
+// user_id,kind,delta,reason. A reason column left empty takes
+// defaultReason. Excel's UTF-8 BOM is accepted.
+func ParseAdjustmentCSV(r io.Reader, defaultReason string) ([]Adjustment, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.New("the file has no header row")
+	}
+	cols := map[string]int{}
+	for i, h := range header {
+		cols[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+	}
+	for _, want := range []string{"user_id", "kind", "delta"} {
+		if _, ok := cols[want]; !ok {
+			return nil, fmt.Errorf("missing column %q", want)
+		}
+	}
+
+	var items []Adjustment
+	var rowErrs []AdjustmentRowError
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			rowErrs = append(rowErrs, AdjustmentRowError{Line: line, Error: err.Error()})
+			continue
+		}
+		field := func(name string) string {
+			if i, ok := cols[name]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		delta, err := strconv.ParseInt(field("delta"), 10, 64)
+		if err != nil {
+			rowErrs = append(rowErrs, AdjustmentRowError{Line: line, Error: "delta must be a whole number"})
+			continue
+		}
+		reason := field("reason")
+		if reason == "" {
+			reason = defaultReason
+		}
+		items = append(items, Adjustment{UserID: field("user_id"), Kind: field("kind"), Delta: delta, Reason: reason})
+	}
+	if len(rowErrs) > 0 {
+		return nil, &AdjustmentBatchError{Rows: rowErrs}
+	}
+	return items, nil
+}
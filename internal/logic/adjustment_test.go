@@ -0,0 +1,131 @@
+package logic
+
+import (
+	"errors"
+	"happynewyear/internal/svc"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateAdjustment(t *testing.T) {
+	ctx := &svc.ServiceContext{}
+	ctx.Config.Adjustments.MaxChances = 5
+	l := NewAdjustmentLogic(ctx)
+
+	ok := Adjustment{UserID: " u1 ", Kind: "Chances", Delta: -5, Reason: " support ticket 12 "}
+	if err := l.Validate(&ok); err != nil {
+		t.Fatalf("valid adjustment rejected: %v", err)
+	}
+	if ok.UserID != "u1" || ok.Kind != AdjustChances || ok.Reason != "support ticket 12" {
+		t.Errorf("fields not normalized: %+v", ok)
+	}
+
+	bad := []Adjustment{
+		{Kind: AdjustChances, Delta: 1, Reason: "x"},
+		{UserID: "u1", Kind: "prizes", Delta: 1, Reason: "x"},
+		{UserID: "u1", Kind: AdjustChances, Delta: 0, Reason: "x"},
+		{UserID: "u1", Kind: AdjustChances, Delta: 6, Reason: "x"},
+		{UserID: "u1", Kind: AdjustPoints, Delta: -1001, Reason: "x"},
+		{UserID: "u1", Kind: AdjustPoints, Delta: 10, Reason: "  "},
+	}
+	for _, a := range bad {
+		if err := l.Validate(&a); err == nil {
+			t.Errorf("%+v accepted", a)
+		}
+	}
+}
+
+func TestValidateAdjustmentFrozenLeaderboard(t *testing.T) {
+	ctx := &svc.ServiceContext{}
+	ctx.Config.Game.LeaderboardFreezeAt = time.Now().Add(-time.Hour).Format(time.RFC3339)
+	l := NewAdjustmentLogic(ctx)
+
+	points := Adjustment{UserID: "u1", Kind: AdjustPoints, Delta: 10, Reason: "bug"}
+	if err := l.Validate(&points); !errors.Is(err, ErrLeaderboardFrozen) {
+		t.Errorf("points after freeze: err = %v", err)
+	}
+	chances := Adjustment{UserID: "u1", Kind: AdjustChances, Delta: 1, Reason: "bug"}
+	if err := l.Validate(&chances); err != nil {
+		t.Errorf("chances after freeze: %v", err)
+	}
+}
+
+func TestCheckChanceGrants(t *testing.T) {
+	// Nothing to grant: no need to lock or read anything
+	for _, items := range [][]Adjustment{
+		nil,
+		{{UserID: "u1", Kind: AdjustChances, Delta: -10}},
+		{{UserID: "u1", Kind: AdjustPoints, Delta: 500}},
+	} {
+		db, rec := dryRunDB(t)
+		l := NewAdjustmentLogic(&svc.ServiceContext{DB: db})
+		if err := l.checkChanceGrants(db, items); err != nil || len(rec.statements) != 0 {
+			t.Errorf("%+v: err = %v, statements = %v", items, err, rec.statements)
+		}
+	}
+
+	// The users are locked in a fixed order before the window is summed
+	db, rec := dryRunDB(t)
+	l := NewAdjustmentLogic(&svc.ServiceContext{DB: db})
+	items := []Adjustment{
+		{UserID: "u2", Kind: AdjustChances, Delta: 4},
+		{UserID: "u1", Kind: AdjustChances, Delta: 6},
+	}
+	if err := l.checkChanceGrants(db, items); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.statements) != 2 {
+		t.Fatalf("statements = %v", rec.statements)
+	}
+	lock, sum := rec.statements[0], rec.statements[1]
+	if !strings.Contains(lock, "FROM `users` WHERE user_id IN ('u1','u2') ORDER BY user_id FOR UPDATE") {
+		t.Errorf("users not locked in order: %s", lock)
+	}
+	if !strings.Contains(sum, "FROM `balance_adjustments`") || !strings.Contains(sum, "SUM(delta)") {
+		t.Errorf("second statement is not the window sum: %s", sum)
+	}
+
+	// Rows for the same user add up against the threshold
+	items = append(items, Adjustment{UserID: "u1", Kind: AdjustChances, Delta: 6})
+	if err := l.checkChanceGrants(db, items); !errors.Is(err, ErrNeedsApproval) {
+		t.Errorf("12 chances for u1: err = %v", err)
+	}
+}
+
+func TestChanceGrantsAddUpPerUser(t *testing.T) {
+	got := chanceGrants([]Adjustment{
+		{UserID: "u1", Kind: AdjustChances, Delta: 6},
+		{UserID: "u2", Kind: AdjustChances, Delta: 3},
+		{UserID: "u1", Kind: AdjustChances, Delta: 6},
+		{UserID: "u1", Kind: AdjustChances, Delta: -12}, // A revocation doesn't reset the count
+		{UserID: "u2", Kind: AdjustPoints, Delta: 500},
+	})
+	if len(got) != 2 || got["u1"] != 12 || got["u2"] != 3 {
+		t.Errorf("chanceGrants = %v", got)
+	}
+}
+
+func TestParseAdjustmentCSV(t *testing.T) {
+	in := "\ufeffuser_id,kind,delta,reason\nu1,chances,2,outage\nu2,points,-50,\n"
+	items, err := ParseAdjustmentCSV(strings.NewReader(in), "cleanup")
+	if err != nil {
+		t.Fatalf("ParseAdjustmentCSV: %v", err)
+	}
+	if len(items) != 2 || items[0].Delta != 2 || items[1].Delta != -50 {
+		t.Fatalf("unexpected rows: %+v", items)
+	}
+	if items[0].Reason != "outage" || items[1].Reason != "cleanup" {
+		t.Errorf("reasons = %q, %q", items[0].Reason, items[1].Reason)
+	}
+
+	_, err = ParseAdjustmentCSV(strings.NewReader("user_id,kind,delta\nu1,chances,two\nu2,chances,1\nu3,points,1.5\n"), "")
+	var batchErr *AdjustmentBatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Rows) != 2 || batchErr.Rows[0].Line != 2 || batchErr.Rows[1].Line != 4 {
+		t.Errorf("bad rows: err = %v", err)
+	}
+
+	if _, err := ParseAdjustmentCSV(strings.NewReader("user,delta\n"), ""); err == nil {
+		t.Error("missing columns accepted")
+	}
+}
@@ -1,10 +1,18 @@
 package logic
 
 import (
+	"errors"
+	"fmt"
 	"happynewyear/internal/model"
 	"happynewyear/internal/svc"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
 )
 
+var ErrUserNotFound = errors.New("user not found")
+
 type AdminLogic struct {
 	ctx *svc.ServiceContext
 }
@@ -13,110 +21,343 @@ func NewAdminLogic(ctx *svc.ServiceContext) *AdminLogic {
 	return &AdminLogic{ctx: ctx}
 }
 
-// CheckAuth verifies the admin secret
-func (l *AdminLogic) CheckAuth(secret string) bool {
-	return secret == l.ctx.Config.Game.AdminPassword
-}
-
 type AdminUserItem struct {
 	ID         int64  `json:"id"`
 	UserID     string `json:"user_id"`
 	Name       string `json:"name"`
+	Department string `json:"department"`
 	Score      int64  `json:"score"`
 	Chances    int    `json:"chances"`
 	Level      int    `json:"level"`
 	CreatedAt  string `json:"created_at"`
 }
 
-func (l *AdminLogic) GetAllUsers() ([]AdminUserItem, error) {
+// User list sort keys
+const (
+	UserSortScore   = "score"
+	UserSortChances = "chances"
+	UserSortName    = "name"
+	UserSortCreated = "created"
+)
+
+var userSortColumns = map[string]string{
+	UserSortScore:   "total_score",
+	UserSortChances: "chances",
+	UserSortName:    "name",
+	UserSortCreated: "", // id order is join order
+}
+
+// UserFilter narrows the admin user list. Nil bounds are open.
+type UserFilter struct {
+	Name       string // Substring of the name, or an exact user_id
+	Department string // Substring of any department name
+	MinScore   *int64
+	MaxScore   *int64
+	MinChances *int
+	MaxChances *int
+	Sort       string // score (default), chances, name or created
+	Asc        bool
+	Cursor     string // next_cursor from the previous page
+	Limit      int
+}
+
+// ListUsers returns one page of users and the cursor for the next page,
+// "" on the last page
+func (l *AdminLogic) ListUsers(f UserFilter) ([]AdminUserItem, string, error) {
+	if f.Sort == "" {
+		f.Sort = UserSortScore
+	}
+	column, ok := userSortColumns[f.Sort]
+	if !ok {
+		return nil, "", fmt.Errorf("%w %q", ErrInvalidSort, f.Sort)
+	}
+
+	q := l.ctx.DB.Model(&model.User{})
+	if f.Name != "" {
+		q = q.Where("(name LIKE ? OR user_id = ?)", "%"+escapeLike(f.Name)+"%", f.Name)
+	}
+	if f.Department != "" {
+		q = q.Where("department LIKE ?", "%"+escapeLike(f.Department)+"%")
+	}
+	if f.MinScore != nil {
+		q = q.Where("total_score >= ?", *f.MinScore)
+	}
+	if f.MaxScore != nil {
+		q = q.Where("total_score <= ?", *f.MaxScore)
+	}
+	if f.MinChances != nil {
+		q = q.Where("chances >= ?", *f.MinChances)
+	}
+	if f.MaxChances != nil {
+		q = q.Where("chances <= ?", *f.MaxChances)
+	}
+	if f.Cursor != "" {
+		cur, err := decodePageCursor(f.Cursor, f.Sort, f.Asc)
+		if err != nil {
+			return nil, "", err
+		}
+		q = cur.where(q, column, "id", f.Asc)
+	}
+	q = orderPage(q, column, "id", f.Asc)
+
+	limit := pageLimit(f.Limit)
 	var users []model.User
-	err := l.ctx.DB.Order("total_score desc").Find(&users).Error
-	if err != nil {
-		return nil, err
+	if err := q.Limit(limit + 1).Find(&users).Error; err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(users) > limit {
+		users = users[:limit]
+		last := users[limit-1]
+		cur := pageCursor{Sort: f.Sort, Asc: f.Asc, ID: last.ID}
+		switch f.Sort {
+		case UserSortScore:
+			cur.N = last.TotalScore
+		case UserSortChances:
+			cur.N = int64(last.Chances)
+		case UserSortName:
+			cur.S = &last.Name
+		}
+		next = cur.encode()
 	}
 
-	var result []AdminUserItem
+	result := make([]AdminUserItem, 0, len(users))
 	for _, u := range users {
 		result = append(result, AdminUserItem{
-			ID:        u.ID,
-			UserID:    u.UserID,
-			Name:      u.Name,
-			Score:     u.TotalScore,
-			Chances:   u.Chances,
-			Level:     CalculateLevel(u.TotalScore),
-			CreatedAt: u.CreatedAt.Format("2006-01-02 15:04:05"),
+			ID:         u.ID,
+			UserID:     u.UserID,
+			Name:       u.Name,
+			Department: u.Department.Names(),
+			Score:      u.TotalScore,
+			Chances:    u.Chances,
+			Level:      CalculateLevel(u.TotalScore),
+			CreatedAt:  u.CreatedAt.Format("2006-01-02 15:04:05"),
 		})
 	}
-	return result, nil
+	return result, next, nil
 }
 
 type AdminDrawRecord struct {
 	ID        int64  `json:"id"`
 	UserID    string `json:"user_id"`
 	Name      string `json:"name"`
+	AwardID   int    `json:"award_id"`
+	AwardType int    `json:"award_type"`
 	AwardName string `json:"award_name"`
+	Voided    bool   `json:"voided"` // Voided by a test_users reset
 	CreatedAt string `json:"created_at"`
 	DataHash  string `json:"data_hash"`
 }
 
-func (l *AdminLogic) GetDrawRecords() ([]AdminDrawRecord, error) {
-	var records []model.DrawRecord
-	// Join with users table to get real names
-	err := l.ctx.DB.Order("id desc").Find(&records).Error
-	if err != nil {
-		return nil, err
+// DrawFilter narrows the admin draw list. Zero values match everything.
+type DrawFilter struct {
+	UserID    string
+	AwardID   int
+	AwardType int
+	Since     time.Time
+	Until     time.Time
+	Asc       bool // Oldest first
+	Cursor    string
+	Limit     int
+}
+
+// ListDrawRecords returns one page of draws, newest first unless f.Asc, and
+// the cursor for the next page. Names come from a join, not a users scan.
+func (l *AdminLogic) ListDrawRecords(f DrawFilter) ([]AdminDrawRecord, string, error) {
+	q := l.ctx.DB.Table("draw_records").
+		Select("draw_records.id, draw_records.user_id, COALESCE(users.name, '') AS name, " +
+			"draw_records.award_id, COALESCE(awards.type, 0) AS award_type, draw_records.award_name, " +
+			"voided_draws.id IS NOT NULL AS voided, draw_records.data_hash, draw_records.created_at").
+		Joins("LEFT JOIN users ON users.user_id = draw_records.user_id").
+		Joins("LEFT JOIN awards ON awards.id = draw_records.award_id").
+		Joins("LEFT JOIN voided_draws ON voided_draws.draw_record_id = draw_records.id")
+	if f.UserID != "" {
+		q = q.Where("draw_records.user_id = ?", f.UserID)
+	}
+	if f.AwardID > 0 {
+		q = q.Where("draw_records.award_id = ?", f.AwardID)
+	}
+	if f.AwardType > 0 {
+		q = q.Where("awards.type = ?", f.AwardType)
+	}
+	if !f.Since.IsZero() {
+		q = q.Where("draw_records.created_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		q = q.Where("draw_records.created_at < ?", f.Until)
 	}
+	if f.Cursor != "" {
+		cur, err := decodePageCursor(f.Cursor, "id", f.Asc)
+		if err != nil {
+			return nil, "", err
+		}
+		q = cur.where(q, "", "draw_records.id", f.Asc)
+	}
+	q = orderPage(q, "", "draw_records.id", f.Asc)
 
-	// Fetch user names for mapping
-	var users []model.User
-	l.ctx.DB.Find(&users)
-	nameMap := make(map[string]string)
-	for _, u := range users {
-		nameMap[u.UserID] = u.Name
+	limit := pageLimit(f.Limit)
+	var rows []struct {
+		ID        int64
+		UserID    string
+		Name      string
+		AwardID   int
+		AwardType int
+		AwardName string
+		Voided    bool
+		DataHash  string
+		CreatedAt time.Time
+	}
+	if err := q.Limit(limit + 1).Scan(&rows).Error; err != nil {
+		return nil, "", err
 	}
 
-	var result []AdminDrawRecord
-	for _, r := range records {
+	var next string
+	if len(rows) > limit {
+		rows = rows[:limit]
+		next = pageCursor{Sort: "id", Asc: f.Asc, ID: rows[limit-1].ID}.encode()
+	}
+
+	result := make([]AdminDrawRecord, 0, len(rows))
+	for _, r := range rows {
 		result = append(result, AdminDrawRecord{
 			ID:        r.ID,
 			UserID:    r.UserID,
-			Name:      nameMap[r.UserID],
+			Name:      r.Name,
+			AwardID:   r.AwardID,
+			AwardType: r.AwardType,
 			AwardName: r.AwardName,
+			Voided:    r.Voided,
 			DataHash:  r.DataHash,
 			CreatedAt: r.CreatedAt.Format("2006-01-02 15:04:05"),
 		})
 	}
-	return result, nil
+	return result, next, nil
 }
+
 func (l *AdminLogic) GetAllAwards() ([]model.Award, error) {
 	var awards []model.Award
 	err := l.ctx.DB.Order("id asc").Find(&awards).Error
 	return awards, err
 }
 
-func (l *AdminLogic) ResetData() error {
-	// Destination tables for truncation
-	tables := []string{"draw_records", "game_records"}
+// Reset scopes
+const (
+	ResetScopeAll       = "all"        // Every score, chance, game, draw and adjustment
+	ResetScopeTestUsers = "test_users" // Only the given users; their draws are voided
+	ResetScopeInventory = "inventory"  // Only award stock back to total_count
+)
+
+type ResetRequest struct {
+	Scope   string   `json:"scope"`
+	UserIDs []string `json:"user_ids"` // test_users only; defaults to Reset.TestUserIDs
+}
 
-	for _, table := range tables {
-		if err := l.ctx.DB.Exec("TRUNCATE TABLE " + table).Error; err != nil {
-			return err
+// NormalizeReset defaults and checks a reset before it is proposed
+func (l *AdminLogic) NormalizeReset(req *ResetRequest) error {
+	if req.Scope == "" {
+		req.Scope = ResetScopeAll
+	}
+	switch req.Scope {
+	case ResetScopeAll, ResetScopeInventory:
+		req.UserIDs = nil
+	case ResetScopeTestUsers:
+		if len(req.UserIDs) == 0 {
+			req.UserIDs = l.ctx.Config.Reset.TestUserIDs
+		}
+		if len(req.UserIDs) == 0 {
+			return errors.New("test_users reset needs user_ids or Reset.TestUserIDs")
 		}
+	default:
+		return fmt.Errorf("unknown reset scope %q", req.Scope)
 	}
+	return nil
+}
 
-	// Reset Users
-	if err := l.ctx.DB.Model(&model.User{}).Where("1 = 1").Updates(map[string]interface{}{
-		"total_score": 0,
-		"chances":     0,
-	}).Error; err != nil {
-		return err
+type ResetResult struct {
+	Scope    string               `json:"scope"`
+	Snapshot *model.ResetSnapshot `json:"snapshot"` // Restore this to undo the reset
+	Rows     map[string]int64     `json:"rows"`     // Rows deleted, updated or voided per table
+}
+
+// ResetData snapshots the event and then resets the given scope in one
+// transaction. Rows written after the snapshot are left alone, so nothing
+// is removed that the snapshot does not hold.
+func (l *AdminLogic) ResetData(req ResetRequest, actor string) (*ResetResult, error) {
+	if err := l.NormalizeReset(&req); err != nil {
+		return nil, err
+	}
+	snap, maxIDs, err := NewSnapshotLogic(l.ctx).Create("reset:"+req.Scope, actor)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot before reset: %w", err)
+	}
+
+	result := &ResetResult{Scope: req.Scope, Snapshot: snap, Rows: map[string]int64{}}
+	exec := func(tx *gorm.DB, table, sql string, args ...interface{}) error {
+		res := tx.Exec(sql, args...)
+		result.Rows[table] += res.RowsAffected
+		return res.Error
 	}
 
-	// Reset Awards inventory
-	// Using a raw query to reset remaining to total to avoid GORM batch update complexities
-	if err := l.ctx.DB.Exec("UPDATE awards SET remaining = total, version = 0").Error; err != nil {
+	err = l.ctx.DB.Transaction(func(tx *gorm.DB) error {
+		switch req.Scope {
+		case ResetScopeAll:
+			// DELETE, unlike TRUNCATE, rolls back with the transaction
+			for _, table := range []string{"voided_draws", "prize_redemptions", "draw_checkpoints", "draw_records", "game_records", "balance_adjustments"} {
+				if err := exec(tx, table, "DELETE FROM "+table+" WHERE id <= ?", maxIDs[table]); err != nil {
+					return err
+				}
+			}
+			if err := exec(tx, "users", "UPDATE users SET total_score = 0, chances = 0"); err != nil {
+				return err
+			}
+			return exec(tx, "awards", "UPDATE awards SET remaining = total_count, version = version + 1")
+
+		case ResetScopeInventory:
+			return exec(tx, "awards", "UPDATE awards SET remaining = total_count, version = version + 1")
+
+		case ResetScopeTestUsers:
+			return l.resetUsers(tx, req.UserIDs, maxIDs, exec)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := NewStatsLogic(l.ctx).Clear(); err != nil {
+		log.Printf("Reset: failed to clear dashboard counters: %v", err)
+	}
+	return result, nil
+}
+
+// resetUsers clears the given users. Their draws stay in the audit chain but
+// are voided, and the stock they won goes back on the shelf.
+func (l *AdminLogic) resetUsers(tx *gorm.DB, userIDs []string, maxIDs map[string]int64, exec func(*gorm.DB, string, string, ...interface{}) error) error {
+	var draws []model.DrawRecord
+	if err := tx.Where("user_id IN ? AND id <= ?", userIDs, maxIDs["draw_records"]).
+		Where("id NOT IN (?)", tx.Model(&model.VoidedDraw{}).Select("draw_record_id")).
+		Find(&draws).Error; err != nil {
 		return err
 	}
+	restock := map[int]int{}
+	for _, d := range draws {
+		err := exec(tx, "voided_draws", "INSERT INTO voided_draws (draw_record_id, user_id, award_id, reason, created_at) VALUES (?, ?, ?, ?, ?)",
+			d.ID, d.UserID, d.AwardID, "reset:"+ResetScopeTestUsers, time.Now())
+		if err != nil {
+			return err
+		}
+		restock[d.AwardID]++
+	}
+	for awardID, n := range restock {
+		if err := exec(tx, "awards", "UPDATE awards SET remaining = LEAST(remaining + ?, total_count), version = version + 1 WHERE id = ?", n, awardID); err != nil {
+			return err
+		}
+	}
 
-	return nil
+	for _, table := range []string{"prize_redemptions", "game_records", "balance_adjustments"} {
+		if err := exec(tx, table, "DELETE FROM "+table+" WHERE user_id IN ? AND id <= ?", userIDs, maxIDs[table]); err != nil {
+			return err
+		}
+	}
+	return exec(tx, "users", "UPDATE users SET total_score = 0, chances = 0 WHERE user_id IN ?", userIDs)
 }
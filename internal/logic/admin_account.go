@@ -0,0 +1,306 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"log"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Admin roles
+const (
+	RoleViewer         = "viewer"
+	RolePrizeFulfiller = "prize-fulfiller"
+	RoleOperator       = "operator"
+	RoleSuperAdmin     = "super-admin"
+	RoleAuditor        = "auditor" // External auditor: read-only, plus the audit bundle
+)
+
+// Permission is what a route asks for; roles grant a set of them
+type Permission string
+
+const (
+	PermRead    Permission = "read"    // Dashboards and lists
+	PermRedeem  Permission = "redeem"  // Look up redemption codes and hand out prizes
+	PermOperate Permission = "operate" // Awards, blessings, broadcasts, org sync, user sessions
+	PermManage  Permission = "manage"  // Data reset and admin accounts
+
+	PermAuditBundle Permission = "audit_bundle" // Download the tamper-evident audit bundle
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleViewer:         {PermRead},
+	RolePrizeFulfiller: {PermRead, PermRedeem},
+	RoleOperator:       {PermRead, PermRedeem, PermOperate},
+	RoleSuperAdmin:     {PermRead, PermRedeem, PermOperate, PermManage, PermAuditBundle},
+	RoleAuditor:        {PermRead, PermAuditBundle},
+}
+
+const (
+	// AdminSubjectPrefix marks admin sessions in the session store, so they
+	// never collide with a WeCom user id
+	AdminSubjectPrefix = "admin:"
+
+	adminLoginMaxFailures = 10
+	adminLoginLockout     = 15 * time.Minute
+	adminMinPasswordLen   = 10
+)
+
+var (
+	ErrAdminLogin    = errors.New("invalid username or password")
+	ErrAdminLocked   = errors.New("too many failed logins, try again later")
+	ErrAdminNotFound = errors.New("admin account not found")
+	ErrAdminSelfLock = errors.New("you cannot demote or disable your own account")
+	usernamePattern  = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{1,63}$`)
+
+	// Compared against when the username doesn't exist, so a miss takes as
+	// long as a wrong password
+	dummyHashOnce     sync.Once
+	dummyPasswordHash []byte
+)
+
+func dummyHash() []byte {
+	dummyHashOnce.Do(func() {
+		dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("happynewyear-dummy"), bcrypt.DefaultCost)
+	})
+	return dummyPasswordHash
+}
+
+// Roles lists the admin roles, sorted
+func Roles() []string {
+	return slices.Sorted(maps.Keys(rolePermissions))
+}
+
+// ValidRole reports whether role is one of the admin roles
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission reports whether role grants perm
+func HasPermission(role string, perm Permission) bool {
+	return slices.Contains(rolePermissions[role], perm)
+}
+
+// RolePermissions lists what role grants, for the console to hide what it can't use
+func RolePermissions(role string) []Permission {
+	return rolePermissions[role]
+}
+
+// AdminSubject is the session subject for an admin account
+func AdminSubject(id int64) string {
+	return AdminSubjectPrefix + strconv.FormatInt(id, 10)
+}
+
+// HashPassword bcrypts a local admin password
+func HashPassword(password string) (string, error) {
+	if len(password) < adminMinPasswordLen {
+		return "", fmt.Errorf("password must be at least %d characters", adminMinPasswordLen)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+type AdminAccountLogic struct {
+	ctx *svc.ServiceContext
+}
+
+func NewAdminAccountLogic(ctx *svc.ServiceContext) *AdminAccountLogic {
+	return &AdminAccountLogic{ctx: ctx}
+}
+
+// Login checks a local username and password. Repeated failures lock the
+// username for a while.
+func (l *AdminAccountLogic) Login(username, password string) (*model.AdminAccount, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	rctx := context.Background()
+	failKey := "admin:login_fail:" + username
+	if n, _ := l.ctx.Redis.Get(rctx, failKey).Int(); n >= adminLoginMaxFailures {
+		return nil, ErrAdminLocked
+	}
+
+	var account model.AdminAccount
+	err := l.ctx.DB.Where("username = ?", username).First(&account).Error
+	hash := dummyHash()
+	if err == nil && account.PasswordHash != "" {
+		hash = []byte(account.PasswordHash)
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || err != nil ||
+		account.PasswordHash == "" || account.Disabled {
+		pipe := l.ctx.Redis.TxPipeline()
+		pipe.Incr(rctx, failKey)
+		pipe.Expire(rctx, failKey, adminLoginLockout)
+		pipe.Exec(rctx)
+		return nil, ErrAdminLogin
+	}
+
+	l.ctx.Redis.Del(rctx, failKey)
+	l.touch(&account)
+	return &account, nil
+}
+
+// FindByWeCom returns the enabled admin account bound to a WeCom user id
+func (l *AdminAccountLogic) FindByWeCom(wecomUserID string) (*model.AdminAccount, error) {
+	if wecomUserID == "" {
+		return nil, ErrAdminNotFound
+	}
+	var account model.AdminAccount
+	err := l.ctx.DB.Where("wecom_user_id = ? AND disabled = ?", wecomUserID, false).First(&account).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAdminNotFound
+	}
+	return &account, err
+}
+
+// FindBySubject resolves the subject of an admin session
+func (l *AdminAccountLogic) FindBySubject(subject string) (*model.AdminAccount, error) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(subject, AdminSubjectPrefix), 10, 64)
+	if err != nil || !strings.HasPrefix(subject, AdminSubjectPrefix) {
+		return nil, ErrAdminNotFound
+	}
+	var account model.AdminAccount
+	err = l.ctx.DB.Where("id = ? AND disabled = ?", id, false).First(&account).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAdminNotFound
+	}
+	return &account, err
+}
+
+func (l *AdminAccountLogic) touch(account *model.AdminAccount) {
+	now := time.Now()
+	account.LastLoginAt = &now
+	l.ctx.DB.Model(account).Update("last_login_at", now)
+}
+
+func (l *AdminAccountLogic) List() ([]model.AdminAccount, error) {
+	var list []model.AdminAccount
+	err := l.ctx.DB.Order("id asc").Find(&list).Error
+	return list, err
+}
+
+// AdminAccountRequest creates or updates an account. On update an empty
+// Password keeps the current one.
+type AdminAccountRequest struct {
+	Username    string `json:"username"`
+	Name        string `json:"name"`
+	WeComUserID string `json:"wecom_user_id"`
+	Password    string `json:"password"`
+	Role        string `json:"role"`
+	Disabled    bool   `json:"disabled"`
+}
+
+func (r *AdminAccountRequest) normalize() error {
+	r.Username = strings.ToLower(strings.TrimSpace(r.Username))
+	r.WeComUserID = strings.TrimSpace(r.WeComUserID)
+	if !ValidRole(r.Role) {
+		return fmt.Errorf("role must be one of %s", strings.Join(Roles(), ", "))
+	}
+	return nil
+}
+
+func (l *AdminAccountLogic) Create(req AdminAccountRequest) (*model.AdminAccount, error) {
+	if err := req.normalize(); err != nil {
+		return nil, err
+	}
+	if !usernamePattern.MatchString(req.Username) {
+		return nil, errors.New("username must be 2-64 lowercase letters, digits, '.', '_' or '-'")
+	}
+	if req.WeComUserID == "" && req.Password == "" {
+		return nil, errors.New("an account needs a wecom_user_id or a password")
+	}
+
+	account := model.AdminAccount{
+		Username:    req.Username,
+		Name:        req.Name,
+		WeComUserID: req.WeComUserID,
+		Role:        req.Role,
+		Disabled:    req.Disabled,
+	}
+	if req.Password != "" {
+		hash, err := HashPassword(req.Password)
+		if err != nil {
+			return nil, err
+		}
+		account.PasswordHash = hash
+	}
+	if err := l.ctx.DB.Create(&account).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// Update changes an account. actorID is the admin making the change, who
+// can't take away their own access. Roles are read on every request, so a
+// demotion applies at once; disabling or a new password also ends sessions.
+func (l *AdminAccountLogic) Update(id, actorID int64, req AdminAccountRequest) (*model.AdminAccount, error) {
+	if err := req.normalize(); err != nil {
+		return nil, err
+	}
+	var account model.AdminAccount
+	if err := l.ctx.DB.First(&account, id).Error; err != nil {
+		return nil, ErrAdminNotFound
+	}
+	if id == actorID && (req.Disabled || req.Role != account.Role) {
+		return nil, ErrAdminSelfLock
+	}
+
+	revoke := req.Disabled
+	updates := map[string]interface{}{
+		"name":          req.Name,
+		"wecom_user_id": req.WeComUserID,
+		"role":          req.Role,
+		"disabled":      req.Disabled,
+	}
+	if req.Password != "" {
+		hash, err := HashPassword(req.Password)
+		if err != nil {
+			return nil, err
+		}
+		updates["password_hash"] = hash
+		revoke = true
+	}
+	if err := l.ctx.DB.Model(&account).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	if err := l.ctx.DB.First(&account, id).Error; err != nil {
+		return nil, err
+	}
+
+	if revoke {
+		if _, err := NewSessionLogic(l.ctx).RevokeUser(AdminSubject(id)); err != nil {
+			log.Printf("Revoke sessions of admin %d: %v", id, err)
+		}
+	}
+	return &account, nil
+}
+
+// EnsureBootstrap creates a super-admin "admin" from Game.AdminPassword
+// while there are no accounts yet, so a fresh install can sign in
+func (l *AdminAccountLogic) EnsureBootstrap() error {
+	var count int64
+	if err := l.ctx.DB.Model(&model.AdminAccount{}).Count(&count).Error; err != nil || count > 0 {
+		return err
+	}
+	password := l.ctx.Config.Game.AdminPassword
+	if password == "" {
+		log.Printf("Warning: no admin accounts; create one with go run ./cmd/adminctl")
+		return nil
+	}
+	_, err := l.Create(AdminAccountRequest{Username: "admin", Name: "Administrator", Password: password, Role: RoleSuperAdmin})
+	if err == nil {
+		log.Printf("Created super-admin \"admin\" from Game.AdminPassword; add personal accounts and disable it")
+	}
+	return err
+}
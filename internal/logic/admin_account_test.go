@@ -0,0 +1,83 @@
+package logic
+
+import (
+	"happynewyear/internal/svc"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRolePermissions(t *testing.T) {
+	cases := []struct {
+		role string
+		perm Permission
+		want bool
+	}{
+		{RoleViewer, PermRead, true},
+		{RoleViewer, PermRedeem, false},
+		{RolePrizeFulfiller, PermRedeem, true},
+		{RolePrizeFulfiller, PermOperate, false},
+		{RoleOperator, PermOperate, true},
+		{RoleOperator, PermManage, false},
+		{RoleSuperAdmin, PermManage, true},
+		{RoleAuditor, PermAuditBundle, true},
+		{RoleAuditor, PermRedeem, false},
+		{RoleOperator, PermAuditBundle, false},
+		{"admin", PermRead, false},
+	}
+	for _, c := range cases {
+		if got := HasPermission(c.role, c.perm); got != c.want {
+			t.Errorf("HasPermission(%s, %s) = %v", c.role, c.perm, got)
+		}
+	}
+	if ValidRole("root") || !ValidRole(RolePrizeFulfiller) {
+		t.Error("ValidRole disagrees with the role list")
+	}
+}
+
+func TestRoleErrorListsEveryRole(t *testing.T) {
+	req := AdminAccountRequest{Username: "a", Role: "root"}
+	err := req.normalize()
+	if err == nil {
+		t.Fatal("unknown role accepted")
+	}
+	want := "role must be one of auditor, operator, prize-fulfiller, super-admin, viewer"
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	if _, err := HashPassword("short"); err == nil {
+		t.Error("short passwords should be rejected")
+	}
+	hash, err := HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte("correct horse battery")) != nil {
+		t.Error("hash should verify")
+	}
+}
+
+func TestAdminSubject(t *testing.T) {
+	l := NewAdminAccountLogic(&svc.ServiceContext{})
+	if AdminSubject(42) != "admin:42" {
+		t.Errorf("AdminSubject = %s", AdminSubject(42))
+	}
+	// Player ids must never resolve to an admin session
+	for _, subject := range []string{"zhangsan", "42", "admin:", "admin:x", "guest:1"} {
+		if _, err := l.FindBySubject(subject); err != ErrAdminNotFound {
+			t.Errorf("FindBySubject(%q) = %v", subject, err)
+		}
+	}
+}
+
+func TestRedemptionCodeFormat(t *testing.T) {
+	l := NewRedemptionLogic(&svc.ServiceContext{})
+	for _, code := range []string{"", "ABC123", "x-ABC123", "42-"} {
+		if _, err := l.Lookup(code); err != ErrRedemptionCode {
+			t.Errorf("Lookup(%q) = %v", code, err)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AdminAuditGenesis is the PrevHash of the first admin audit entry
+const AdminAuditGenesis = "ADMIN_AUDIT_GENESIS_2026"
+
+// Admin audit outcomes
+const (
+	AuditSuccess = "success"
+	AuditDenied  = "denied"
+	AuditFailure = "failure"
+)
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 500
+)
+
+// redactedParams are never written to the audit log, at any depth
+var redactedParams = map[string]bool{"password": true, "secret": true, "token": true, "refresh_token": true}
+
+type AdminAuditLogic struct {
+	ctx *svc.ServiceContext
+}
+
+func NewAdminAuditLogic(ctx *svc.ServiceContext) *AdminAuditLogic {
+	return &AdminAuditLogic{ctx: ctx}
+}
+
+// adminAuditPayload is what DataHash covers: every column except the id and
+// the chain hashes. Its field order is fixed, so the JSON is canonical.
+type adminAuditPayload struct {
+	ActorID   int64  `json:"actor_id"`
+	Actor     string `json:"actor"`
+	Action    string `json:"action"`
+	Params    string `json:"params"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Status    int    `json:"status"`
+	Outcome   string `json:"outcome"`
+	Error     string `json:"error"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// AdminAuditDataHash hashes the content of one entry
+func AdminAuditDataHash(e *model.AdminAudit) string {
+	raw, _ := json.Marshal(adminAuditPayload{
+		ActorID:   e.ActorID,
+		Actor:     e.Actor,
+		Action:    e.Action,
+		Params:    e.Params,
+		IP:        e.IP,
+		UserAgent: e.UserAgent,
+		Status:    e.Status,
+		Outcome:   e.Outcome,
+		Error:     e.Error,
+		CreatedAt: e.CreatedAt.Unix(),
+	})
+	return sha256Sum(string(raw))
+}
+
+// Record appends e to the chain. The last entry is read FOR UPDATE, which on
+// InnoDB also locks the gap after it, so concurrent appends queue up instead
+// of forking the chain.
+func (l *AdminAuditLogic) Record(e *model.AdminAudit) error {
+	e.ID = 0
+	e.CreatedAt = time.Now().UTC().Truncate(time.Second) // DATETIME keeps whole seconds
+	e.Actor = truncate(e.Actor, 64)
+	e.UserAgent = truncate(e.UserAgent, 255)
+	e.Error = truncate(e.Error, 255)
+	if e.Params == "" {
+		e.Params = "{}"
+	}
+
+	return l.ctx.DB.Transaction(func(tx *gorm.DB) error {
+		var last model.AdminAudit
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Order("id desc").Limit(1).Find(&last).Error
+		if err != nil {
+			return err
+		}
+		e.PrevHash = last.FinalHash
+		if e.PrevHash == "" {
+			e.PrevHash = AdminAuditGenesis
+		}
+		e.DataHash = AdminAuditDataHash(e)
+		e.FinalHash = sha256Sum(e.DataHash + e.PrevHash)
+		return tx.Create(e).Error
+	})
+}
+
+// AdminAuditFilter narrows List; zero values match everything. Pages run
+// newest first: pass the smallest id seen as BeforeID for the next one.
+type AdminAuditFilter struct {
+	Actor    string
+	Action   string // Exact, or a prefix ending in "." such as "awards."
+	Outcome  string
+	Since    time.Time
+	Until    time.Time
+	BeforeID int64
+	Limit    int
+}
+
+func (l *AdminAuditLogic) List(f AdminAuditFilter) ([]model.AdminAudit, error) {
+	q := l.ctx.DB.Model(&model.AdminAudit{})
+	if f.Actor != "" {
+		q = q.Where("actor = ?", f.Actor)
+	}
+	if strings.HasSuffix(f.Action, ".") {
+		q = q.Where("action LIKE ?", f.Action+"%")
+	} else if f.Action != "" {
+		q = q.Where("action = ?", f.Action)
+	}
+	if f.Outcome != "" {
+		q = q.Where("outcome = ?", f.Outcome)
+	}
+	if !f.Since.IsZero() {
+		q = q.Where("created_at >= ?", f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		q = q.Where("created_at < ?", f.Until.UTC())
+	}
+	if f.BeforeID > 0 {
+		q = q.Where("id < ?", f.BeforeID)
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = defaultAuditPageSize
+	}
+	if limit > maxAuditPageSize {
+		limit = maxAuditPageSize
+	}
+
+	var list []model.AdminAudit
+	err := q.Order("id desc").Limit(limit).Find(&list).Error
+	return list, err
+}
+
+type AdminAuditReport struct {
+	EntryCount int      `json:"entry_count"`
+	ChainHead  string   `json:"chain_head"`
+	Problems   []string `json:"problems"`
+}
+
+// Verify replays the whole chain from the genesis hash
+func (l *AdminAuditLogic) Verify() (*AdminAuditReport, error) {
+	report := &AdminAuditReport{ChainHead: AdminAuditGenesis}
+	var batch []model.AdminAudit
+	err := l.ctx.DB.Order("id asc").FindInBatches(&batch, 1000, func(tx *gorm.DB, _ int) error {
+		report.ChainHead, report.Problems = VerifyAdminAuditChain(batch, report.ChainHead, report.Problems)
+		report.EntryCount += len(batch)
+		return nil
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// VerifyAdminAuditChain checks that entries, in id order, continue the chain
+// from prev. It returns the new head and problems with any findings appended.
+func VerifyAdminAuditChain(entries []model.AdminAudit, prev string, problems []string) (string, []string) {
+	for i := range entries {
+		e := &entries[i]
+		if e.PrevHash != prev {
+			problems = append(problems, fmt.Sprintf("entry #%d: prev_hash does not link to previous entry", e.ID))
+		}
+		if AdminAuditDataHash(e) != e.DataHash {
+			problems = append(problems, fmt.Sprintf("entry #%d: content does not match data_hash", e.ID))
+		}
+		if sha256Sum(e.DataHash+e.PrevHash) != e.FinalHash {
+			problems = append(problems, fmt.Sprintf("entry #%d: final_hash does not match data_hash+prev_hash", e.ID))
+		}
+		prev = e.FinalHash
+	}
+	return prev, problems
+}
+
+// AuditParams renders request parameters for the log. Keys in
+// redactedParams are replaced wherever they appear.
+func AuditParams(params map[string]interface{}) string {
+	raw, err := json.Marshal(redact(params))
+	if err != nil {
+		return "{}"
+	}
+	return string(raw)
+}
+
+func redact(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			if redactedParams[strings.ToLower(k)] {
+				out[k] = "[redacted]"
+				continue
+			}
+			out[k] = redact(val)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, val := range t {
+			out[i] = redact(val)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// AuditOutcome classifies a response status
+func AuditOutcome(status int) string {
+	switch {
+	case status == 401 || status == 403:
+		return AuditDenied
+	case status >= 400:
+		return AuditFailure
+	default:
+		return AuditSuccess
+	}
+}
+
+// RecordCommand logs a change made from a shell tool such as adminctl. The
+// actor is the tool and the OS user running it.
+func (l *AdminAuditLogic) RecordCommand(tool, action string, params map[string]interface{}, runErr error) {
+	entry := &model.AdminAudit{
+		Actor:   tool + ":" + os.Getenv("USER"),
+		Action:  action,
+		Params:  AuditParams(params),
+		Outcome: AuditSuccess,
+	}
+	if runErr != nil {
+		entry.Outcome, entry.Error = AuditFailure, runErr.Error()
+	}
+	if err := l.Record(entry); err != nil {
+		log.Printf("Warning: could not write the admin audit log: %v", err)
+	}
+}
@@ -0,0 +1,396 @@
+package logic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Approval statuses. An approved proposal is executed at once; it only stays
+// "approved" if the process died while running it.
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalExecuted = "executed"
+	ApprovalFailed   = "failed"
+	ApprovalRejected = "rejected"
+	ApprovalExpired  = "expired"
+)
+
+// Operations that need a second admin
+const (
+	OpDataReset   = "data.reset"
+	OpDataRestore = "data.restore"
+	OpAwardCreate = "awards.create"
+	OpAwardUpdate = "awards.update"
+	OpAwardRetire = "awards.retire"
+	OpChanceGrant = "chances.grant"     // Params: one Adjustment
+	OpAdjustBatch = "adjustments.batch" // Params: []Adjustment from a CSV upload
+)
+
+const (
+	defaultApprovalWindow       = time.Hour
+	defaultChanceGrantThreshold = 10
+	defaultChanceGrantWindow    = 24 * time.Hour
+)
+
+var (
+	ErrApprovalNotFound   = errors.New("approval not found")
+	ErrApprovalClosed     = errors.New("approval is no longer pending")
+	ErrApprovalExpired    = errors.New("approval window has passed")
+	ErrSelfApproval       = errors.New("a second admin must approve this")
+	ErrApprovalPermission = errors.New("your role cannot approve this operation")
+)
+
+// ApprovalOperation is one kind of operation that runs under the two-person
+// rule. Execute gets the params stored with the proposal and the names of
+// both admins.
+type ApprovalOperation struct {
+	Permission Permission
+	Execute    func(ctx *svc.ServiceContext, params json.RawMessage, actor string) (interface{}, error)
+}
+
+var approvalOperations = map[string]ApprovalOperation{}
+
+func RegisterApprovalOperation(name string, op ApprovalOperation) {
+	approvalOperations[name] = op
+}
+
+// AwardUpdateParams are the params of an awards.update proposal
+type AwardUpdateParams struct {
+	AwardID int          `json:"award_id"`
+	Award   AwardRequest `json:"award"`
+}
+
+// AwardRetireParams are the params of an awards.retire proposal
+type AwardRetireParams struct {
+	AwardID int `json:"award_id"`
+}
+
+// SnapshotRestoreParams are the params of a data.restore proposal
+type SnapshotRestoreParams struct {
+	SnapshotID int64 `json:"snapshot_id"`
+}
+
+func init() {
+	RegisterApprovalOperation(OpDataReset, ApprovalOperation{
+		Permission: PermManage,
+		Execute: func(ctx *svc.ServiceContext, params json.RawMessage, actor string) (interface{}, error) {
+			var req ResetRequest
+			if err := json.Unmarshal(params, &req); err != nil {
+				return nil, err
+			}
+			return NewAdminLogic(ctx).ResetData(req, actor)
+		},
+	})
+	RegisterApprovalOperation(OpDataRestore, ApprovalOperation{
+		Permission: PermManage,
+		Execute: func(ctx *svc.ServiceContext, params json.RawMessage, actor string) (interface{}, error) {
+			var p SnapshotRestoreParams
+			if err := json.Unmarshal(params, &p); err != nil {
+				return nil, err
+			}
+			return NewSnapshotLogic(ctx).Restore(p.SnapshotID, actor)
+		},
+	})
+	RegisterApprovalOperation(OpAwardCreate, ApprovalOperation{
+		Permission: PermOperate,
+		Execute: func(ctx *svc.ServiceContext, params json.RawMessage, actor string) (interface{}, error) {
+			var req AwardRequest
+			if err := json.Unmarshal(params, &req); err != nil {
+				return nil, err
+			}
+			return NewAwardLogic(ctx).CreateAward(req)
+		},
+	})
+	RegisterApprovalOperation(OpAwardUpdate, ApprovalOperation{
+		Permission: PermOperate,
+		Execute: func(ctx *svc.ServiceContext, params json.RawMessage, actor string) (interface{}, error) {
+			var p AwardUpdateParams
+			if err := json.Unmarshal(params, &p); err != nil {
+				return nil, err
+			}
+			return NewAwardLogic(ctx).UpdateAward(p.AwardID, p.Award)
+		},
+	})
+	RegisterApprovalOperation(OpAwardRetire, ApprovalOperation{
+		Permission: PermOperate,
+		Execute: func(ctx *svc.ServiceContext, params json.RawMessage, actor string) (interface{}, error) {
+			var p AwardRetireParams
+			if err := json.Unmarshal(params, &p); err != nil {
+				return nil, err
+			}
+			return NewAwardLogic(ctx).RetireAward(p.AwardID)
+		},
+	})
+	RegisterApprovalOperation(OpChanceGrant, ApprovalOperation{
+		Permission: PermOperate,
+		Execute: func(ctx *svc.ServiceContext, params json.RawMessage, actor string) (interface{}, error) {
+			var a Adjustment
+			if err := json.Unmarshal(params, &a); err != nil {
+				return nil, err
+			}
+			return NewAdjustmentLogic(ctx).Adjust(a, actor, true)
+		},
+	})
+	RegisterApprovalOperation(OpAdjustBatch, ApprovalOperation{
+		Permission: PermOperate,
+		Execute: func(ctx *svc.ServiceContext, params json.RawMessage, actor string) (interface{}, error) {
+			var items []Adjustment
+			if err := json.Unmarshal(params, &items); err != nil {
+				return nil, err
+			}
+			return NewAdjustmentLogic(ctx).AdjustBatch(items, actor, true)
+		},
+	})
+}
+
+type ApprovalLogic struct {
+	ctx *svc.ServiceContext
+}
+
+func NewApprovalLogic(ctx *svc.ServiceContext) *ApprovalLogic {
+	return &ApprovalLogic{ctx: ctx}
+}
+
+func (l *ApprovalLogic) window() time.Duration {
+	if m := l.ctx.Config.Approval.WindowMinutes; m > 0 {
+		return time.Duration(m) * time.Minute
+	}
+	return defaultApprovalWindow
+}
+
+// ChanceGrantThreshold is the largest manual chance grant that runs without approval
+func (l *ApprovalLogic) ChanceGrantThreshold() int {
+	if n := l.ctx.Config.Approval.ChanceGrantThreshold; n > 0 {
+		return n
+	}
+	return defaultChanceGrantThreshold
+}
+
+// ChanceGrantWindow is how far back a user's earlier grants count towards the threshold
+func (l *ApprovalLogic) ChanceGrantWindow() time.Duration {
+	if h := l.ctx.Config.Approval.ChanceGrantWindowHours; h > 0 {
+		return time.Duration(h) * time.Hour
+	}
+	return defaultChanceGrantWindow
+}
+
+// AwardChangeNeedsApproval reports whether creating (id 0) or updating an
+// award touches grand prize stock: a grand prize with stock is created, or a
+// grand prize gains or loses stock or its grand prize type.
+func (l *ApprovalLogic) AwardChangeNeedsApproval(id int, req AwardRequest) (bool, error) {
+	grand := model.AwardTypeGrandPrize
+	if id == 0 {
+		return req.Type == grand && req.TotalCount > 0, nil
+	}
+	var award model.Award
+	if err := l.ctx.DB.First(&award, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, ErrAwardNotFound
+		}
+		return false, err
+	}
+	if award.Type != grand && req.Type != grand {
+		return false, nil
+	}
+	return award.Type != req.Type || award.TotalCount != req.TotalCount, nil
+}
+
+// AwardRetireNeedsApproval reports whether retiring award id takes a grand
+// prize out of the draw. The award is returned for the proposal summary.
+func (l *ApprovalLogic) AwardRetireNeedsApproval(id int) (*model.Award, bool, error) {
+	var award model.Award
+	if err := l.ctx.DB.First(&award, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, ErrAwardNotFound
+		}
+		return nil, false, err
+	}
+	return &award, retireNeedsApproval(&award), nil
+}
+
+// retireNeedsApproval: an already retired award falls through to
+// RetireAward, which reports ErrAwardRetired
+func retireNeedsApproval(award *model.Award) bool {
+	return award.Type == model.AwardTypeGrandPrize && !award.Retired
+}
+
+// Propose queues op for a second admin. The proposer needs the same
+// permission as the approver.
+func (l *ApprovalLogic) Propose(op string, params interface{}, summary string, proposer *model.AdminAccount) (*model.AdminApproval, error) {
+	spec, ok := approvalOperations[op]
+	if !ok {
+		return nil, fmt.Errorf("unknown operation %q", op)
+	}
+	if !HasPermission(proposer.Role, spec.Permission) {
+		return nil, ErrApprovalPermission
+	}
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	approval := model.AdminApproval{
+		Operation:    op,
+		Params:       string(raw),
+		Summary:      truncate(summary, 255),
+		Status:       ApprovalPending,
+		ProposedByID: proposer.ID,
+		ProposedBy:   proposer.Username,
+		ExpiresAt:    time.Now().Add(l.window()),
+	}
+	if err := l.ctx.DB.Create(&approval).Error; err != nil {
+		return nil, err
+	}
+	return &approval, nil
+}
+
+// List shows proposals, newest first; status "" lists all of them
+func (l *ApprovalLogic) List(status string) ([]model.AdminApproval, error) {
+	if err := l.expireStale(); err != nil {
+		return nil, err
+	}
+	q := l.ctx.DB.Order("id desc").Limit(200)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var list []model.AdminApproval
+	err := q.Find(&list).Error
+	return list, err
+}
+
+// Approve lets a second admin sign off, then runs the operation. A failed
+// run still returns the approval, with status "failed" and the error as
+// its result.
+func (l *ApprovalLogic) Approve(id int64, approver *model.AdminAccount, note string) (*model.AdminApproval, error) {
+	approval, spec, err := l.decidable(id, approver)
+	if err != nil {
+		return nil, err
+	}
+	if approval.ProposedByID == approver.ID {
+		return nil, ErrSelfApproval
+	}
+	if err := l.claim(approval, ApprovalApproved, approver, note); err != nil {
+		return nil, err
+	}
+
+	actor := approval.ProposedBy + "+" + approver.Username
+	result, runErr := spec.Execute(l.ctx, json.RawMessage(approval.Params), actor)
+	approval.Status = ApprovalExecuted
+	if runErr != nil {
+		approval.Status = ApprovalFailed
+		result = map[string]string{"error": runErr.Error()}
+	}
+	raw, _ := json.Marshal(result)
+	approval.Result = string(raw)
+	if err := l.ctx.DB.Model(approval).Updates(map[string]interface{}{
+		"status": approval.Status,
+		"result": approval.Result,
+	}).Error; err != nil {
+		log.Printf("Approval #%d: %s but could not save it: %v", approval.ID, approval.Status, err)
+	}
+
+	l.audit(approval, approver, runErr)
+	return approval, nil
+}
+
+// Reject closes a proposal without running it. The proposer may withdraw
+// their own.
+func (l *ApprovalLogic) Reject(id int64, decider *model.AdminAccount, note string) (*model.AdminApproval, error) {
+	approval, _, err := l.decidable(id, decider)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.claim(approval, ApprovalRejected, decider, note); err != nil {
+		return nil, err
+	}
+	return approval, nil
+}
+
+// decidable loads a pending proposal that admin may decide on
+func (l *ApprovalLogic) decidable(id int64, admin *model.AdminAccount) (*model.AdminApproval, ApprovalOperation, error) {
+	var approval model.AdminApproval
+	if err := l.ctx.DB.First(&approval, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ApprovalOperation{}, ErrApprovalNotFound
+		}
+		return nil, ApprovalOperation{}, err
+	}
+	spec, ok := approvalOperations[approval.Operation]
+	if !ok {
+		return nil, ApprovalOperation{}, fmt.Errorf("unknown operation %q", approval.Operation)
+	}
+	if !HasPermission(admin.Role, spec.Permission) {
+		return nil, ApprovalOperation{}, ErrApprovalPermission
+	}
+	if approval.Status != ApprovalPending {
+		return nil, ApprovalOperation{}, ErrApprovalClosed
+	}
+	if !time.Now().Before(approval.ExpiresAt) {
+		l.expireStale()
+		return nil, ApprovalOperation{}, ErrApprovalExpired
+	}
+	return &approval, spec, nil
+}
+
+// claim moves a pending, unexpired proposal to status. The conditional
+// update makes sure two admins cannot both decide it.
+func (l *ApprovalLogic) claim(approval *model.AdminApproval, status string, admin *model.AdminAccount, note string) error {
+	now := time.Now()
+	res := l.ctx.DB.Model(&model.AdminApproval{}).
+		Where("id = ? AND status = ? AND expires_at > ?", approval.ID, ApprovalPending, now).
+		Updates(map[string]interface{}{
+			"status":        status,
+			"decided_by_id": admin.ID,
+			"decided_by":    admin.Username,
+			"note":          truncate(note, 255),
+			"decided_at":    now,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrApprovalClosed
+	}
+	approval.Status = status
+	approval.DecidedByID, approval.DecidedBy = admin.ID, admin.Username
+	approval.Note = truncate(note, 255)
+	approval.DecidedAt = &now
+	return nil
+}
+
+func (l *ApprovalLogic) expireStale() error {
+	return l.ctx.DB.Model(&model.AdminApproval{}).
+		Where("status = ? AND expires_at <= ?", ApprovalPending, time.Now()).
+		Update("status", ApprovalExpired).Error
+}
+
+// audit logs the execution itself, next to the approve request that caused it
+func (l *ApprovalLogic) audit(approval *model.AdminApproval, approver *model.AdminAccount, runErr error) {
+	var params interface{}
+	json.Unmarshal([]byte(approval.Params), &params)
+	entry := &model.AdminAudit{
+		ActorID: approver.ID,
+		Actor:   approver.Username,
+		Action:  approval.Operation,
+		Params: AuditParams(map[string]interface{}{
+			"approval_id": approval.ID,
+			"proposed_by": approval.ProposedBy,
+			"params":      params,
+		}),
+		Outcome: AuditSuccess,
+	}
+	if runErr != nil {
+		entry.Outcome, entry.Error = AuditFailure, runErr.Error()
+	}
+	if err := NewAdminAuditLogic(l.ctx).Record(entry); err != nil {
+		log.Printf("Admin audit: failed to record approval #%d: %v", approval.ID, err)
+	}
+}
@@ -0,0 +1,87 @@
+package logic
+
+import (
+	"errors"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"testing"
+)
+
+func TestApprovalOperations(t *testing.T) {
+	want := map[string]Permission{
+		OpDataReset:   PermManage,
+		OpDataRestore: PermManage,
+		OpAwardCreate: PermOperate,
+		OpAwardUpdate: PermOperate,
+		OpAwardRetire: PermOperate,
+		OpChanceGrant: PermOperate,
+		OpAdjustBatch: PermOperate,
+	}
+	for op, perm := range want {
+		spec, ok := approvalOperations[op]
+		if !ok {
+			t.Errorf("%s is not registered", op)
+			continue
+		}
+		if spec.Permission != perm || spec.Execute == nil {
+			t.Errorf("%s: permission %s, want %s", op, spec.Permission, perm)
+		}
+	}
+}
+
+func TestProposeChecksRole(t *testing.T) {
+	l := NewApprovalLogic(&svc.ServiceContext{})
+	operator := &model.AdminAccount{ID: 2, Username: "op", Role: RoleOperator}
+
+	if _, err := l.Propose(OpDataReset, struct{}{}, "reset", operator); !errors.Is(err, ErrApprovalPermission) {
+		t.Errorf("operator proposing a reset: err = %v", err)
+	}
+	if _, err := l.Propose("data.drop", nil, "", operator); err == nil {
+		t.Error("unknown operation accepted")
+	}
+}
+
+func TestAwardCreateNeedsApproval(t *testing.T) {
+	l := NewApprovalLogic(&svc.ServiceContext{})
+	cases := []struct {
+		req  AwardRequest
+		want bool
+	}{
+		{AwardRequest{Type: model.AwardTypeGrandPrize, TotalCount: 1}, true},
+		{AwardRequest{Type: model.AwardTypeGrandPrize, TotalCount: 0}, false},
+		{AwardRequest{Type: model.AwardTypePrize, TotalCount: 50}, false},
+	}
+	for _, c := range cases {
+		if got, _ := l.AwardChangeNeedsApproval(0, c.req); got != c.want {
+			t.Errorf("create %+v: needs approval = %v, want %v", c.req, got, c.want)
+		}
+	}
+}
+
+func TestAwardRetireNeedsApproval(t *testing.T) {
+	cases := []struct {
+		award model.Award
+		want  bool
+	}{
+		{model.Award{Type: model.AwardTypeGrandPrize, Remaining: 1}, true},
+		{model.Award{Type: model.AwardTypeGrandPrize}, true}, // Sold out still changes the published odds
+		{model.Award{Type: model.AwardTypeGrandPrize, Retired: true}, false},
+		{model.Award{Type: model.AwardTypePrize, Remaining: 50}, false},
+	}
+	for _, c := range cases {
+		if got := retireNeedsApproval(&c.award); got != c.want {
+			t.Errorf("retire %+v: needs approval = %v, want %v", c.award, got, c.want)
+		}
+	}
+}
+
+func TestChanceGrantThreshold(t *testing.T) {
+	ctx := &svc.ServiceContext{}
+	if got := NewApprovalLogic(ctx).ChanceGrantThreshold(); got != defaultChanceGrantThreshold {
+		t.Errorf("default threshold = %d", got)
+	}
+	ctx.Config.Approval.ChanceGrantThreshold = 3
+	if got := NewApprovalLogic(ctx).ChanceGrantThreshold(); got != 3 {
+		t.Errorf("configured threshold = %d, want 3", got)
+	}
+}
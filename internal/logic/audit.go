@@ -0,0 +1,442 @@
+package logic
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"io"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	BundleManifest    = "manifest.json"
+	BundleAwards      = "awards.json"
+	BundleRevisions   = "award_revisions.json"
+	BundleDraws       = "draw_records.jsonl"
+	BundleCheckpoints = "draw_checkpoints.json"
+	BundleGames       = "game_records.jsonl"        // Where the chances came from
+	BundleAdjustments = "balance_adjustments.jsonl" // Manual chance and points changes
+)
+
+// BundleFormatVersion 2 added the game and adjustment ledgers; 3 draws whose
+// data_hash can be recomputed from their columns (see DrawDataHash)
+const BundleFormatVersion = 3
+
+const bundleBatchSize = 1000
+
+type AuditLogic struct {
+	ctx *svc.ServiceContext
+}
+
+func NewAuditLogic(ctx *svc.ServiceContext) *AuditLogic {
+	return &AuditLogic{ctx: ctx}
+}
+
+type BundleFile struct {
+	SHA256 string `json:"sha256"`
+	Size   int    `json:"size"`
+}
+
+type BundleManifestData struct {
+	FormatVersion   int                   `json:"format_version"`
+	GeneratedAt     time.Time             `json:"generated_at"`
+	Genesis         string                `json:"genesis"`
+	DrawCount       int                   `json:"draw_count"`
+	ChainHead       string                `json:"chain_head"`
+	CheckpointCount int                   `json:"checkpoint_count"`
+	GameCount       int                   `json:"game_count"`
+	AdjustmentCount int                   `json:"adjustment_count"`
+	Files           map[string]BundleFile `json:"files"`
+}
+
+// WriteBundle writes a "tar.gz" or "zip" audit bundle of the whole event to
+// w. Every table is read from one consistent view. The ledgers are read in
+// batches and each file is spooled to a temp file while it is checksummed,
+// so memory stays flat however many draws there are; the manifest goes last.
+func (l *AuditLogic) WriteBundle(w io.Writer, format string) error {
+	archive, err := newBundleArchive(w, format)
+	if err != nil {
+		return err
+	}
+	b, err := newBundleWriter(archive, time.Now())
+	if err != nil {
+		return err
+	}
+	defer b.cleanup()
+
+	err = consistentRead(l.ctx.DB, func(conn *gorm.DB) error {
+		var awards []model.Award
+		if err := conn.Order("id asc").Find(&awards).Error; err != nil {
+			return err
+		}
+		if err := b.jsonFile(BundleAwards, awards); err != nil {
+			return err
+		}
+		var revisions []model.AwardRevision
+		if err := conn.Order("id asc").Find(&revisions).Error; err != nil {
+			return err
+		}
+		if err := b.jsonFile(BundleRevisions, revisions); err != nil {
+			return err
+		}
+		var checkpoints []model.DrawCheckpoint
+		if err := conn.Order("period_start asc").Find(&checkpoints).Error; err != nil {
+			return err
+		}
+		if err := b.checkpoints(checkpoints); err != nil {
+			return err
+		}
+
+		// Redeem secrets hand out prizes and are not part of the chain
+		err := b.draws(func(emit func(*model.DrawRecord) error) error {
+			return eachRow(conn.Omit("redeem_secret"), emit)
+		})
+		if err != nil {
+			return err
+		}
+		err = b.ledger(BundleGames, &b.manifest.GameCount, func(emit func(interface{}) error) error {
+			return eachRow(conn, func(r *model.GameRecord) error { return emit(r) })
+		})
+		if err != nil {
+			return err
+		}
+		return b.ledger(BundleAdjustments, &b.manifest.AdjustmentCount, func(emit func(interface{}) error) error {
+			return eachRow(conn, func(r *model.BalanceAdjustment) error { return emit(r) })
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return b.close()
+}
+
+// eachRow calls fn for every row of T's table in id order, a batch at a time
+func eachRow[T any](db *gorm.DB, fn func(*T) error) error {
+	var batch []T
+	return db.Order("id asc").FindInBatches(&batch, bundleBatchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+// bundleWriter adds files to an archive one at a time and builds the
+// manifest from their checksums
+type bundleWriter struct {
+	archive  bundleArchive
+	spool    *os.File
+	manifest BundleManifestData
+}
+
+func newBundleWriter(archive bundleArchive, now time.Time) (*bundleWriter, error) {
+	spool, err := os.CreateTemp("", "audit-bundle-*")
+	if err != nil {
+		return nil, err
+	}
+	return &bundleWriter{
+		archive: archive,
+		spool:   spool,
+		manifest: BundleManifestData{
+			FormatVersion: BundleFormatVersion,
+			GeneratedAt:   now,
+			Genesis:       GenesisHash,
+			Files:         make(map[string]BundleFile),
+		},
+	}, nil
+}
+
+// file renders one file into the spool, records its checksum and copies it
+// into the archive
+func (b *bundleWriter) file(name string, render func(w io.Writer) error) error {
+	if err := b.spool.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := b.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	h := sha256.New()
+	cw := &countingWriter{w: io.MultiWriter(b.spool, h)}
+	bw := bufio.NewWriter(cw)
+	if err := render(bw); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	b.manifest.Files[name] = BundleFile{SHA256: hex.EncodeToString(h.Sum(nil)), Size: int(cw.n)}
+
+	if _, err := b.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return b.archive.Add(name, io.LimitReader(b.spool, cw.n), cw.n)
+}
+
+func (b *bundleWriter) jsonFile(name string, v interface{}) error {
+	return b.file(name, func(w io.Writer) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+}
+
+func (b *bundleWriter) checkpoints(checkpoints []model.DrawCheckpoint) error {
+	b.manifest.CheckpointCount = len(checkpoints)
+	return b.jsonFile(BundleCheckpoints, checkpoints)
+}
+
+// draws writes the hash chain, one record per line, and notes its head
+func (b *bundleWriter) draws(each func(emit func(*model.DrawRecord) error) error) error {
+	return b.file(BundleDraws, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		return each(func(r *model.DrawRecord) error {
+			b.manifest.DrawCount++
+			b.manifest.ChainHead = r.FinalHash
+			return enc.Encode(r)
+		})
+	})
+}
+
+// ledger writes one row per line and counts them into count
+func (b *bundleWriter) ledger(name string, count *int, each func(emit func(interface{}) error) error) error {
+	return b.file(name, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		return each(func(row interface{}) error {
+			*count++
+			return enc.Encode(row)
+		})
+	})
+}
+
+// close adds the manifest and finishes the archive
+func (b *bundleWriter) close() error {
+	data, err := json.MarshalIndent(b.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := b.archive.Add(BundleManifest, bytes.NewReader(data), int64(len(data))); err != nil {
+		return err
+	}
+	return b.archive.Close()
+}
+
+func (b *bundleWriter) cleanup() {
+	b.spool.Close()
+	os.Remove(b.spool.Name())
+}
+
+// bundleArchive is a tar.gz or zip being written; tar needs each size up front
+type bundleArchive interface {
+	Add(name string, r io.Reader, size int64) error
+	Close() error
+}
+
+func newBundleArchive(w io.Writer, format string) (bundleArchive, error) {
+	switch format {
+	case "zip":
+		return &zipArchive{zw: zip.NewWriter(w)}, nil
+	case "", "tar.gz":
+		gw := gzip.NewWriter(w)
+		return &tarArchive{gw: gw, tw: tar.NewWriter(gw)}, nil
+	}
+	return nil, fmt.Errorf("unsupported bundle format: %s", format)
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchive) Add(name string, r io.Reader, _ int64) error {
+	f, err := a.zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	return err
+}
+
+func (a *zipArchive) Close() error { return a.zw.Close() }
+
+type tarArchive struct {
+	gw *gzip.Writer
+	tw *tar.Writer
+}
+
+func (a *tarArchive) Add(name string, r io.Reader, size int64) error {
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: size, ModTime: time.Now()}
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := io.Copy(a.tw, r)
+	return err
+}
+
+func (a *tarArchive) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gw.Close()
+}
+
+type AuditReport struct {
+	DrawCount       int      `json:"draw_count"`
+	CheckpointCount int      `json:"checkpoint_count"`
+	GameCount       int      `json:"game_count"`
+	AdjustmentCount int      `json:"adjustment_count"`
+	ChainHead       string   `json:"chain_head"`
+	Problems        []string `json:"problems"`
+}
+
+func (r *AuditReport) OK() bool { return len(r.Problems) == 0 }
+
+func (r *AuditReport) addf(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// VerifyBundle checks file checksums, replays the draw hash chain, counts the
+// ledgers and recomputes every checkpoint root. It needs nothing but the
+// bundle itself.
+func VerifyBundle(files map[string][]byte) (*AuditReport, error) {
+	raw, ok := files[BundleManifest]
+	if !ok {
+		return nil, errors.New("bundle has no manifest")
+	}
+	var manifest BundleManifestData
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+
+	report := &AuditReport{}
+
+	// 1. Checksums
+	for name, meta := range manifest.Files {
+		data, ok := files[name]
+		if !ok {
+			report.addf("%s: listed in manifest but missing", name)
+			continue
+		}
+		h := sha256.Sum256(data)
+		if hex.EncodeToString(h[:]) != meta.SHA256 {
+			report.addf("%s: checksum mismatch", name)
+		}
+	}
+	for name := range files {
+		if _, ok := manifest.Files[name]; !ok && name != BundleManifest {
+			report.addf("%s: not listed in manifest", name)
+		}
+	}
+
+	// 2. Hash chain
+	var records []model.DrawRecord
+	dec := json.NewDecoder(bytes.NewReader(files[BundleDraws]))
+	for dec.More() {
+		var r model.DrawRecord
+		if err := dec.Decode(&r); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", BundleDraws, err)
+		}
+		records = append(records, r)
+	}
+	report.DrawCount = len(records)
+
+	prev := manifest.Genesis
+	for _, r := range records {
+		if r.PrevHash != prev {
+			report.addf("draw #%d: prev_hash does not link to previous record", r.ID)
+		}
+		if manifest.FormatVersion >= 3 && DrawDataHash(&r) != r.DataHash {
+			report.addf("draw #%d: data_hash does not match the record", r.ID)
+		}
+		if sha256Sum(r.DataHash+r.PrevHash) != r.FinalHash {
+			report.addf("draw #%d: final_hash does not match data_hash+prev_hash", r.ID)
+		}
+		prev = r.FinalHash
+	}
+	if len(records) > 0 {
+		report.ChainHead = prev
+	}
+	if report.DrawCount != manifest.DrawCount || report.ChainHead != manifest.ChainHead {
+		report.addf("manifest draw count/chain head does not match records")
+	}
+
+	// 3. Ledgers, listed from format version 2
+	ledgers := []struct {
+		name  string
+		want  int
+		count *int
+	}{
+		{BundleGames, manifest.GameCount, &report.GameCount},
+		{BundleAdjustments, manifest.AdjustmentCount, &report.AdjustmentCount},
+	}
+	for _, ledger := range ledgers {
+		if _, ok := manifest.Files[ledger.name]; !ok {
+			if manifest.FormatVersion >= 2 {
+				report.addf("%s: missing from the manifest", ledger.name)
+			}
+			continue
+		}
+		n, err := countLines(files[ledger.name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", ledger.name, err)
+		}
+		*ledger.count = n
+		if n != ledger.want {
+			report.addf("%s: manifest says %d rows, file has %d", ledger.name, ledger.want, n)
+		}
+	}
+
+	// 4. Checkpoint roots
+	var checkpoints []model.DrawCheckpoint
+	if err := json.Unmarshal(files[BundleCheckpoints], &checkpoints); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", BundleCheckpoints, err)
+	}
+	report.CheckpointCount = len(checkpoints)
+
+	for _, cp := range checkpoints {
+		var leaves []string
+		for _, r := range records {
+			if !r.CreatedAt.Before(cp.PeriodStart) && r.CreatedAt.Before(cp.PeriodEnd) {
+				leaves = append(leaves, r.FinalHash)
+			}
+		}
+		if len(leaves) != cp.LeafCount {
+			report.addf("checkpoint #%d: expected %d draws, bundle has %d", cp.ID, cp.LeafCount, len(leaves))
+			continue
+		}
+		if BuildMerkleRoot(leaves) != cp.MerkleRoot {
+			report.addf("checkpoint #%d: merkle root mismatch", cp.ID)
+		}
+	}
+
+	return report, nil
+}
+
+// countLines counts the JSON values in a JSONL file
+func countLines(data []byte) (int, error) {
+	n := 0
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for dec.More() {
+		var row json.RawMessage
+		if err := dec.Decode(&row); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,158 @@
+package logic
+
+import (
+	"bytes"
+	"happynewyear/internal/model"
+	"io"
+	"testing"
+	"time"
+)
+
+// mapArchive keeps a bundle in memory, the way auditverify reads it
+type mapArchive map[string][]byte
+
+func (a mapArchive) Add(name string, r io.Reader, size int64) error {
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r); err != nil {
+		return err
+	}
+	a[name] = buf.Bytes()
+	return nil
+}
+
+func (a mapArchive) Close() error { return nil }
+
+func buildTestBundle(t *testing.T, records []model.DrawRecord, checkpoints []model.DrawCheckpoint, games []model.GameRecord) map[string][]byte {
+	t.Helper()
+	files := mapArchive{}
+	b, err := newBundleWriter(files, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.cleanup()
+
+	steps := []func() error{
+		func() error { return b.jsonFile(BundleAwards, []model.Award{}) },
+		func() error { return b.jsonFile(BundleRevisions, []model.AwardRevision{}) },
+		func() error { return b.checkpoints(checkpoints) },
+		func() error {
+			return b.draws(func(emit func(*model.DrawRecord) error) error {
+				for i := range records {
+					if err := emit(&records[i]); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		},
+		func() error {
+			return b.ledger(BundleGames, &b.manifest.GameCount, func(emit func(interface{}) error) error {
+				for i := range games {
+					if err := emit(&games[i]); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		},
+		func() error {
+			return b.ledger(BundleAdjustments, &b.manifest.AdjustmentCount, func(func(interface{}) error) error { return nil })
+		},
+		b.close,
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+func buildTestChain(start time.Time, n int) []model.DrawRecord {
+	var records []model.DrawRecord
+	prev := GenesisHash
+	for i := 0; i < n; i++ {
+		r := model.DrawRecord{
+			ID:        int64(i + 1),
+			UserID:    "u1",
+			AwardID:   8,
+			AwardName: "新春快乐：马到成功",
+			Message:   "马到成功",
+			PrevHash:  prev,
+			CreatedAt: start.Add(time.Duration(i) * 10 * time.Minute),
+		}
+		r.DataHash = DrawDataHash(&r)
+		r.FinalHash = sha256Sum(r.DataHash + r.PrevHash)
+		records = append(records, r)
+		prev = r.FinalHash
+	}
+	return records
+}
+
+func TestVerifyBundle(t *testing.T) {
+	start := time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC)
+	records := buildTestChain(start, 5)
+
+	var leaves []string
+	for _, r := range records {
+		leaves = append(leaves, r.FinalHash)
+	}
+	checkpoints := []model.DrawCheckpoint{{
+		ID: 1, PeriodStart: start, PeriodEnd: start.Add(time.Hour),
+		FirstRecordID: 1, LastRecordID: 5, LeafCount: 5, MerkleRoot: BuildMerkleRoot(leaves),
+	}}
+
+	games := []model.GameRecord{{ID: 1, UserID: "u1", GameID: "g1", Score: 420}, {ID: 2, UserID: "u1", GameID: "g2", Score: 80}}
+	files := buildTestBundle(t, records, checkpoints, games)
+	report, err := VerifyBundle(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Fatalf("clean bundle reported problems: %v", report.Problems)
+	}
+	if report.DrawCount != 5 || report.GameCount != 2 || report.AdjustmentCount != 0 {
+		t.Errorf("report counts: %+v", report)
+	}
+
+	// Rewriting a record (even with a fresh manifest) breaks the chain
+	records[2].DataHash = sha256Sum("forged")
+	files = buildTestBundle(t, records, checkpoints, games)
+	report, _ = VerifyBundle(files)
+	if report.OK() {
+		t.Error("forged record not detected")
+	}
+
+	// Editing a column keeps every link intact but no longer matches data_hash
+	for name, edit := range map[string]func(r *model.DrawRecord){
+		"award_id":   func(r *model.DrawRecord) { r.AwardID = 1 },
+		"award_name": func(r *model.DrawRecord) { r.AwardName = "一等奖：神秘大奖" },
+		"user_id":    func(r *model.DrawRecord) { r.UserID = "u2" },
+		"message":    func(r *model.DrawRecord) { r.Message = "恭喜" },
+		"created_at": func(r *model.DrawRecord) { r.CreatedAt = r.CreatedAt.Add(time.Hour) },
+	} {
+		records = buildTestChain(start, 5)
+		edit(&records[2])
+		report, _ = VerifyBundle(buildTestBundle(t, records, checkpoints, games))
+		if report.OK() {
+			t.Errorf("tampered %s not detected", name)
+		}
+	}
+
+	// Editing a file after export breaks the checksum
+	records = buildTestChain(start, 5)
+	files = buildTestBundle(t, records, checkpoints, games)
+	files[BundleAwards] = []byte(`[{"id": 1, "name": "一等奖"}]`)
+	report, _ = VerifyBundle(files)
+	if report.OK() {
+		t.Error("modified file not detected")
+	}
+
+	// A version 2 bundle without its ledgers is incomplete
+	files = buildTestBundle(t, records, checkpoints, games)
+	delete(files, BundleGames)
+	report, _ = VerifyBundle(files)
+	if report.OK() {
+		t.Error("missing game ledger not detected")
+	}
+}
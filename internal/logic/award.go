@@ -0,0 +1,332 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxTotalProbability is the weight budget shared by all active awards (Weight / 10000)
+const MaxTotalProbability = 10000
+
+var (
+	ErrAwardNotFound = errors.New("award not found")
+	ErrAwardRetired  = errors.New("award is retired")
+)
+
+type AwardLogic struct {
+	ctx *svc.ServiceContext
+}
+
+func NewAwardLogic(ctx *svc.ServiceContext) *AwardLogic {
+	return &AwardLogic{ctx: ctx}
+}
+
+type AwardRequest struct {
+	Name        string          `json:"name"`
+	Type        model.AwardType `json:"type"`
+	TotalCount  int             `json:"total_count"`
+	Probability int             `json:"probability"`
+	Value       int             `json:"value"`
+	ImageURL    string          `json:"image_url"`
+	ThumbURL    string          `json:"thumb_url"`
+}
+
+// Validate checks the fields of a single award on their own
+func (r *AwardRequest) Validate() error {
+	if r.Name == "" || utf8.RuneCountInString(r.Name) > 64 {
+		return errors.New("name must be 1-64 characters")
+	}
+	kind, ok := AwardKindOf(r.Type)
+	if !ok {
+		return errors.New("invalid award type")
+	}
+	if kind.NeedsValue() && r.Value <= 0 {
+		return fmt.Errorf("%s awards need a positive value", kind.Name())
+	}
+	if r.TotalCount < 0 {
+		return errors.New("total_count must not be negative")
+	}
+	if r.Probability < 0 || r.Probability > MaxTotalProbability {
+		return fmt.Errorf("probability must be between 0 and %d", MaxTotalProbability)
+	}
+	if r.Value < 0 {
+		return errors.New("value must not be negative")
+	}
+	if len(r.ImageURL) > 255 {
+		return errors.New("image_url too long")
+	}
+	if len(r.ThumbURL) > 255 {
+		return errors.New("thumb_url too long")
+	}
+	return nil
+}
+
+func (l *AwardLogic) CreateAward(req AwardRequest) (*model.Award, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	award := model.Award{
+		Name:        req.Name,
+		Type:        req.Type,
+		TotalCount:  req.TotalCount,
+		Remaining:   req.TotalCount,
+		Probability: req.Probability,
+		Value:       req.Value,
+		ImageURL:    req.ImageURL,
+		ThumbURL:    req.ThumbURL,
+	}
+
+	err := l.ctx.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkProbabilityBudget(tx, 0, req.Probability); err != nil {
+			return err
+		}
+		if err := tx.Create(&award).Error; err != nil {
+			return err
+		}
+		return recordRevision(tx, &award, "create")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &award, nil
+}
+
+// UpdateAward replaces the award configuration. Stock already won is kept:
+// remaining = total_count - won, so total_count can never drop below won.
+func (l *AwardLogic) UpdateAward(id int, req AwardRequest) (*model.Award, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	var award model.Award
+	err := l.ctx.DB.Transaction(func(tx *gorm.DB) error {
+		// Row lock so concurrent draws cannot change remaining underneath us
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&award, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrAwardNotFound
+			}
+			return err
+		}
+		if award.Retired {
+			return ErrAwardRetired
+		}
+
+		won := award.TotalCount - award.Remaining
+		if req.TotalCount < won {
+			return fmt.Errorf("total_count %d is below the %d already won", req.TotalCount, won)
+		}
+		if err := checkProbabilityBudget(tx, award.ID, req.Probability); err != nil {
+			return err
+		}
+
+		award.Name = req.Name
+		award.Type = req.Type
+		award.TotalCount = req.TotalCount
+		award.Remaining = req.TotalCount - won
+		award.Probability = req.Probability
+		award.Value = req.Value
+		// A thumbnail left out of the request stays only while it still matches the image
+		if req.ThumbURL != "" || req.ImageURL != award.ImageURL {
+			award.ThumbURL = req.ThumbURL
+		}
+		award.ImageURL = req.ImageURL
+		award.Version++
+		if err := tx.Save(&award).Error; err != nil {
+			return err
+		}
+		return recordRevision(tx, &award, "update")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &award, nil
+}
+
+// RetireAward removes an award from future draws while keeping it for history
+func (l *AwardLogic) RetireAward(id int) (*model.Award, error) {
+	var award model.Award
+	err := l.ctx.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&award, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrAwardNotFound
+			}
+			return err
+		}
+		if award.Retired {
+			return ErrAwardRetired
+		}
+
+		award.Retired = true
+		award.Version++
+		if err := tx.Model(&award).Updates(map[string]interface{}{
+			"retired": true,
+			"version": award.Version,
+		}).Error; err != nil {
+			return err
+		}
+
+		// At least one active award must remain drawable
+		var active int64
+		if err := tx.Model(&model.Award{}).Where("retired = ? AND probability > 0", false).Count(&active).Error; err != nil {
+			return err
+		}
+		if active == 0 {
+			return errors.New("cannot retire the last active award")
+		}
+		return recordRevision(tx, &award, "retire")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &award, nil
+}
+
+// EnsureBaselineRevisions records revision 1 for awards that have none, such as
+// rows created by AutoMigrate deployments before the revision log existed
+func (l *AwardLogic) EnsureBaselineRevisions() (int, error) {
+	seeded := 0
+	err := l.ctx.DB.Transaction(func(tx *gorm.DB) error {
+		var awards []model.Award
+		if err := unrevisedAwards(tx).Find(&awards).Error; err != nil {
+			return err
+		}
+		for i := range awards {
+			if err := recordRevision(tx, &awards[i], "create"); err != nil {
+				return err
+			}
+		}
+		seeded = len(awards)
+		return nil
+	})
+	return seeded, err
+}
+
+// unrevisedAwards selects and locks the awards missing from the revision log
+func unrevisedAwards(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id NOT IN (?)", tx.Session(&gorm.Session{NewDB: true}).Model(&model.AwardRevision{}).Select("award_id")).
+		Order("id asc")
+}
+
+// legacyVacationCardName is the award that was a plain prize before the vacation card kind existed
+const legacyVacationCardName = "休假奖励卡"
+
+// MigrateLegacyTypes moves awards created before their kind existed onto it,
+// recording a revision so OddsAt and the audit trail see the change
+func (l *AwardLogic) MigrateLegacyTypes() (int, error) {
+	migrated := 0
+	err := l.ctx.DB.Transaction(func(tx *gorm.DB) error {
+		var awards []model.Award
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("name = ? AND type = ?", legacyVacationCardName, model.AwardTypePrize).
+			Find(&awards).Error; err != nil {
+			return err
+		}
+		for i := range awards {
+			award := &awards[i]
+			award.Type = model.AwardTypeVacationCard
+			award.Version++
+			if err := tx.Model(award).Updates(map[string]interface{}{
+				"type":    award.Type,
+				"version": award.Version,
+			}).Error; err != nil {
+				return err
+			}
+			if err := recordRevision(tx, award, "migrate"); err != nil {
+				return err
+			}
+		}
+		migrated = len(awards)
+		return nil
+	})
+	return migrated, err
+}
+
+func (l *AwardLogic) ListRevisions(awardID int) ([]model.AwardRevision, error) {
+	var list []model.AwardRevision
+	err := l.ctx.DB.Where("award_id = ?", awardID).Order("revision asc").Find(&list).Error
+	return list, err
+}
+
+// OddsAt rebuilds the award table that was in effect at time t from the revision log
+func (l *AwardLogic) OddsAt(t time.Time) ([]model.AwardRevision, error) {
+	var revisions []model.AwardRevision
+	err := l.ctx.DB.Where("created_at <= ?", t).Order("award_id asc, revision asc").Find(&revisions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[int]model.AwardRevision)
+	var order []int
+	for _, r := range revisions {
+		if _, seen := latest[r.AwardID]; !seen {
+			order = append(order, r.AwardID)
+		}
+		latest[r.AwardID] = r
+	}
+
+	var result []model.AwardRevision
+	for _, id := range order {
+		if r := latest[id]; !r.Retired {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+// checkProbabilityBudget ensures active weights (with exclude replaced by newWeight) stay in budget.
+// The active rows are locked first, so two concurrent edits cannot each fit
+// under the budget on their own and overshoot it together.
+func checkProbabilityBudget(tx *gorm.DB, excludeID int, newWeight int) error {
+	var active []model.Award
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "probability").
+		Where("retired = ?", false).
+		Find(&active).Error
+	if err != nil {
+		return err
+	}
+	total := int64(newWeight)
+	for _, a := range active {
+		if a.ID != excludeID {
+			total += int64(a.Probability)
+		}
+	}
+	if total > MaxTotalProbability {
+		return fmt.Errorf("total probability %d exceeds %d", total, MaxTotalProbability)
+	}
+	if total <= 0 {
+		return errors.New("total probability must be positive")
+	}
+	return nil
+}
+
+func recordRevision(tx *gorm.DB, award *model.Award, action string) error {
+	var last int
+	if err := tx.Model(&model.AwardRevision{}).
+		Where("award_id = ?", award.ID).
+		Select("COALESCE(MAX(revision), 0)").Scan(&last).Error; err != nil {
+		return err
+	}
+
+	return tx.Create(&model.AwardRevision{
+		AwardID:     award.ID,
+		Revision:    last + 1,
+		Action:      action,
+		Name:        award.Name,
+		Type:        award.Type,
+		TotalCount:  award.TotalCount,
+		Probability: award.Probability,
+		Value:       award.Value,
+		ImageURL:    award.ImageURL,
+		Retired:     award.Retired,
+	}).Error
+}
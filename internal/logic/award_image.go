@@ -0,0 +1,143 @@
+package logic
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"happynewyear/internal/model"
+	"image"
+	_ "image/gif" // register decoder
+	_ "image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	defaultMaxImageKB = 2048
+	thumbnailSize     = 256
+	maxImagePixels    = 4096 * 4096
+)
+
+var allowedImageTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+}
+
+type AwardImage struct {
+	ImageURL string `json:"image_url"`
+	ThumbURL string `json:"thumb_url"`
+}
+
+// UploadAwardImage validates an image, stores it with a thumbnail and points the award at it
+func (l *AwardLogic) UploadAwardImage(awardID int, data []byte) (*AwardImage, error) {
+	maxKB := l.ctx.Config.Storage.MaxImageKB
+	if maxKB <= 0 {
+		maxKB = defaultMaxImageKB
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty file")
+	}
+	if len(data) > maxKB*1024 {
+		return nil, fmt.Errorf("image larger than %d KB", maxKB)
+	}
+
+	// Sniff the content instead of trusting the client's filename or header
+	contentType := http.DetectContentType(data)
+	ext, ok := allowedImageTypes[contentType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported image type: %s", contentType)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New("invalid image")
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, errors.New("image dimensions too large")
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New("invalid image")
+	}
+
+	var thumb bytes.Buffer
+	if err := png.Encode(&thumb, Thumbnail(img, thumbnailSize)); err != nil {
+		return nil, err
+	}
+
+	var award model.Award
+	if err := l.ctx.DB.First(&award, awardID).Error; err != nil {
+		return nil, ErrAwardNotFound
+	}
+
+	// Content-addressed keys, so the files can be cached forever
+	sum := sha256.Sum256(data)
+	name := hex.EncodeToString(sum[:16])
+	imageURL, err := l.ctx.Storage.Put("awards/"+name+ext, bytes.NewReader(data), contentType)
+	if err != nil {
+		return nil, err
+	}
+	thumbURL, err := l.ctx.Storage.Put("awards/"+name+"_thumb.png", &thumb, "image/png")
+	if err != nil {
+		return nil, err
+	}
+
+	req := AwardRequest{
+		Name:        award.Name,
+		Type:        award.Type,
+		TotalCount:  award.TotalCount,
+		Probability: award.Probability,
+		Value:       award.Value,
+		ImageURL:    imageURL,
+		ThumbURL:    thumbURL,
+	}
+	if _, err := l.UpdateAward(awardID, req); err != nil {
+		return nil, err
+	}
+
+	return &AwardImage{ImageURL: imageURL, ThumbURL: thumbURL}, nil
+}
+
+// Thumbnail scales img to fit within size x size using box averaging
+func Thumbnail(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		size = max(w, h)
+	}
+
+	tw, th := size, size
+	if w > h {
+		th = max(1, h*size/w)
+	} else {
+		tw = max(1, w*size/h)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0 := b.Min.Y + y*h/th
+		y1 := max(y0+1, b.Min.Y+(y+1)*h/th)
+		for x := 0; x < tw; x++ {
+			x0 := b.Min.X + x*w/tw
+			x1 := max(x0+1, b.Min.X+(x+1)*w/tw)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(bl / n >> 8)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
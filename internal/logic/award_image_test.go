@@ -0,0 +1,49 @@
+package logic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestThumbnail(t *testing.T) {
+	cases := []struct {
+		w, h, size int
+		tw, th     int
+	}{
+		{1024, 512, 256, 256, 128}, // Landscape keeps its aspect ratio
+		{300, 1200, 256, 64, 256},  // Portrait
+		{100, 50, 256, 100, 50},    // Small images are never scaled up
+		{2000, 1, 256, 256, 1},     // A sliver keeps at least one pixel
+	}
+	for _, c := range cases {
+		src := image.NewRGBA(image.Rect(0, 0, c.w, c.h))
+		got := Thumbnail(src, c.size).Bounds()
+		if got.Dx() != c.tw || got.Dy() != c.th {
+			t.Errorf("%dx%d in %d: got %dx%d, want %dx%d", c.w, c.h, c.size, got.Dx(), got.Dy(), c.tw, c.th)
+		}
+	}
+}
+
+func TestThumbnailAverages(t *testing.T) {
+	// Alternating black and white columns average to grey, and a source
+	// that does not start at the origin is read from its own bounds
+	src := image.NewRGBA(image.Rect(10, 10, 14, 12))
+	for y := 10; y < 12; y++ {
+		for x := 10; x < 14; x++ {
+			v := uint8(0)
+			if x%2 == 1 {
+				v = 0xff
+			}
+			src.Set(x, y, color.RGBA{v, v, v, 0xff})
+		}
+	}
+
+	thumb := Thumbnail(src, 2) // 2x1, each pixel covering one black and one white column pair
+	for x := 0; x < 2; x++ {
+		r, _, _, a := thumb.At(x, 0).RGBA()
+		if r>>8 != 0x7f || a>>8 != 0xff {
+			t.Errorf("pixel %d = %x/%x, want grey and opaque", x, r>>8, a>>8)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package logic
+
+import (
+	"happynewyear/internal/model"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// AwardKind is the behavior behind an award type. Draw only talks to this
+// interface, so a new kind is one RegisterAwardKind call away.
+type AwardKind interface {
+	Name() string
+	// NeedsValue reports whether Award.Value is required (points, chances ...)
+	NeedsValue() bool
+	// OncePerUser awards are skipped for users who already won the same award
+	OncePerUser() bool
+	// Fallback kinds are handed out when the selected award runs out of stock
+	Fallback() bool
+	// Grant runs inside the draw transaction after stock has been deducted
+	Grant(tx *gorm.DB, userID string, award *model.Award) error
+}
+
+var awardKinds = map[model.AwardType]AwardKind{}
+
+func RegisterAwardKind(t model.AwardType, k AwardKind) {
+	awardKinds[t] = k
+}
+
+func AwardKindOf(t model.AwardType) (AwardKind, bool) {
+	k, ok := awardKinds[t]
+	return k, ok
+}
+
+// FallbackAwardTypes lists the types that may replace a sold-out award
+func FallbackAwardTypes() []model.AwardType {
+	var types []model.AwardType
+	for t, k := range awardKinds {
+		if k.Fallback() {
+			types = append(types, t)
+		}
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+func init() {
+	RegisterAwardKind(model.AwardTypeGrandPrize, physicalKind{})
+	RegisterAwardKind(model.AwardTypePrize, physicalKind{})
+	RegisterAwardKind(model.AwardTypeBlessing, blessingKind{})
+	RegisterAwardKind(model.AwardTypePoints, pointsKind{})
+	RegisterAwardKind(model.AwardTypeChances, chancesKind{})
+	RegisterAwardKind(model.AwardTypeVacationCard, vacationCardKind{})
+}
+
+// physicalKind is fulfilled offline by the admin office; nothing to credit
+type physicalKind struct{}
+
+func (physicalKind) Name() string      { return "physical" }
+func (physicalKind) NeedsValue() bool  { return false }
+func (physicalKind) OncePerUser() bool { return false }
+func (physicalKind) Fallback() bool    { return false }
+func (physicalKind) Grant(tx *gorm.DB, userID string, award *model.Award) error {
+	return nil
+}
+
+type blessingKind struct{}
+
+func (blessingKind) Name() string      { return "blessing" }
+func (blessingKind) NeedsValue() bool  { return false }
+func (blessingKind) OncePerUser() bool { return false }
+func (blessingKind) Fallback() bool    { return true }
+func (blessingKind) Grant(tx *gorm.DB, userID string, award *model.Award) error {
+	return nil
+}
+
+type pointsKind struct{}
+
+func (pointsKind) Name() string      { return "points" }
+func (pointsKind) NeedsValue() bool  { return true }
+func (pointsKind) OncePerUser() bool { return false }
+func (pointsKind) Fallback() bool    { return false }
+func (pointsKind) Grant(tx *gorm.DB, userID string, award *model.Award) error {
+	return tx.Model(&model.User{}).
+		Where("user_id = ?", userID).
+		Update("total_score", gorm.Expr("total_score + ?", award.Value)).Error
+}
+
+type chancesKind struct{}
+
+func (chancesKind) Name() string      { return "chances" }
+func (chancesKind) NeedsValue() bool  { return true }
+func (chancesKind) OncePerUser() bool { return false }
+func (chancesKind) Fallback() bool    { return false }
+func (chancesKind) Grant(tx *gorm.DB, userID string, award *model.Award) error {
+	return tx.Model(&model.User{}).
+		Where("user_id = ?", userID).
+		Update("chances", gorm.Expr("chances + ?", award.Value)).Error
+}
+
+type vacationCardKind struct{}
+
+func (vacationCardKind) Name() string      { return "vacation_card" }
+func (vacationCardKind) NeedsValue() bool  { return false }
+func (vacationCardKind) OncePerUser() bool { return true }
+func (vacationCardKind) Fallback() bool    { return false }
+func (vacationCardKind) Grant(tx *gorm.DB, userID string, award *model.Award) error {
+	return nil
+}
@@ -0,0 +1,85 @@
+package logic
+
+import (
+	"context"
+	"happynewyear/internal/model"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// sqlRecorder is a gorm logger that keeps the SQL of every statement
+type sqlRecorder struct {
+	logger.Interface
+	statements []string
+}
+
+func (r *sqlRecorder) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	r.statements = append(r.statements, sql)
+}
+
+// dryRunDB builds MySQL statements without a server, so tests can check the
+// SQL a piece of logic issues
+func dryRunDB(t *testing.T) (*gorm.DB, *sqlRecorder) {
+	t.Helper()
+	rec := &sqlRecorder{Interface: logger.Discard}
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "dry:run@tcp(127.0.0.1:1)/dry", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, SkipDefaultTransaction: true, DisableAutomaticPing: true, Logger: rec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, rec
+}
+
+func TestAwardKindGrant(t *testing.T) {
+	cases := []struct {
+		award model.Award
+		want  string // Expected UPDATE, "" for kinds that credit nothing
+	}{
+		{model.Award{Type: model.AwardTypeGrandPrize}, ""},
+		{model.Award{Type: model.AwardTypePrize}, ""},
+		{model.Award{Type: model.AwardTypeBlessing}, ""},
+		{model.Award{Type: model.AwardTypePoints, Value: 50}, "SET `total_score`=total_score + 50"},
+		{model.Award{Type: model.AwardTypeChances, Value: 2}, "SET `chances`=chances + 2"},
+		{model.Award{Type: model.AwardTypeVacationCard}, ""},
+	}
+	for _, c := range cases {
+		kind, ok := AwardKindOf(c.award.Type)
+		if !ok {
+			t.Fatalf("type %d is not registered", c.award.Type)
+		}
+		db, rec := dryRunDB(t)
+		if err := kind.Grant(db, "zhangsan", &c.award); err != nil {
+			t.Fatalf("%s: %v", kind.Name(), err)
+		}
+		if c.want == "" {
+			if len(rec.statements) != 0 {
+				t.Errorf("%s credited something: %v", kind.Name(), rec.statements)
+			}
+			continue
+		}
+		if len(rec.statements) != 1 || !strings.Contains(rec.statements[0], c.want) ||
+			!strings.Contains(rec.statements[0], "WHERE user_id = 'zhangsan'") {
+			t.Errorf("%s: got %v, want %q for zhangsan", kind.Name(), rec.statements, c.want)
+		}
+	}
+}
+
+func TestAwardKindFallback(t *testing.T) {
+	// Only blessings may stand in for a sold-out award: anything else would
+	// hand out stock, points or chances nobody configured the odds for
+	got := FallbackAwardTypes()
+	if len(got) != 1 || got[0] != model.AwardTypeBlessing {
+		t.Errorf("FallbackAwardTypes = %v", got)
+	}
+	for _, k := range awardKinds {
+		if _, ok := k.(Redeemable); ok && k.Fallback() {
+			t.Errorf("%s is redeemable offline and a fallback", k.Name())
+		}
+	}
+}
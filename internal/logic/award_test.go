@@ -0,0 +1,83 @@
+package logic
+
+import (
+	"happynewyear/internal/model"
+	"strings"
+	"testing"
+)
+
+func TestAwardRequestValidate(t *testing.T) {
+	valid := AwardRequest{Name: "幸运奖：100 积分", Type: model.AwardTypePoints, TotalCount: 10, Probability: 100, Value: 100}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid request rejected: %v", err)
+	}
+
+	cases := map[string]func(r *AwardRequest){
+		"empty name":           func(r *AwardRequest) { r.Name = "" },
+		"long name":            func(r *AwardRequest) { r.Name = strings.Repeat("奖", 65) },
+		"unknown type":         func(r *AwardRequest) { r.Type = 99 },
+		"points without value": func(r *AwardRequest) { r.Value = 0 },
+		"negative stock":       func(r *AwardRequest) { r.TotalCount = -1 },
+		"negative weight":      func(r *AwardRequest) { r.Probability = -1 },
+		"weight over budget":   func(r *AwardRequest) { r.Probability = MaxTotalProbability + 1 },
+		"negative value":       func(r *AwardRequest) { r.Type = model.AwardTypePrize; r.Value = -1 },
+		"long image url":       func(r *AwardRequest) { r.ImageURL = strings.Repeat("a", 256) },
+		"long thumb url":       func(r *AwardRequest) { r.ThumbURL = strings.Repeat("a", 256) },
+	}
+	for name, mutate := range cases {
+		r := valid
+		mutate(&r)
+		if err := r.Validate(); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+
+	// Chances need a value too, other kinds do not
+	chances := AwardRequest{Name: "再来一次", Type: model.AwardTypeChances, Probability: 1}
+	if err := chances.Validate(); err == nil {
+		t.Error("chances award without value accepted")
+	}
+	card := AwardRequest{Name: "休假奖励卡", Type: model.AwardTypeVacationCard, TotalCount: 1, Probability: 1}
+	if err := card.Validate(); err != nil {
+		t.Errorf("vacation card rejected: %v", err)
+	}
+}
+
+func TestCheckProbabilityBudgetLocksActiveAwards(t *testing.T) {
+	db, rec := dryRunDB(t)
+	if err := checkProbabilityBudget(db, 3, 100); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.statements) != 1 {
+		t.Fatalf("statements = %v", rec.statements)
+	}
+	sql := rec.statements[0]
+	if !strings.HasSuffix(sql, "FOR UPDATE") || !strings.Contains(sql, "WHERE retired = false") {
+		t.Errorf("active awards not locked: %s", sql)
+	}
+	if strings.Contains(sql, "SUM(") {
+		t.Errorf("summed in SQL, which would lock nothing: %s", sql)
+	}
+
+	// The dry run sees no rows, so only the new weight counts
+	db, _ = dryRunDB(t)
+	if err := checkProbabilityBudget(db, 0, MaxTotalProbability+1); err == nil {
+		t.Error("weight over budget accepted")
+	}
+	if err := checkProbabilityBudget(db, 0, 0); err == nil {
+		t.Error("zero total accepted")
+	}
+}
+
+func TestUnrevisedAwards(t *testing.T) {
+	db, rec := dryRunDB(t)
+	var awards []model.Award
+	unrevisedAwards(db).Find(&awards)
+	if len(rec.statements) != 1 {
+		t.Fatalf("statements = %v", rec.statements)
+	}
+	want := "SELECT * FROM `awards` WHERE id NOT IN (SELECT `award_id` FROM `award_revisions`) ORDER BY id asc FOR UPDATE"
+	if rec.statements[0] != want {
+		t.Errorf("got  %s\nwant %s", rec.statements[0], want)
+	}
+}
@@ -0,0 +1,168 @@
+package logic
+
+import (
+	"errors"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"math/rand"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+var ErrBlessingNotFound = errors.New("blessing not found")
+
+// AwardMessenger is an optional AwardKind extension for kinds that attach a
+// per-win message to the draw record.
+type AwardMessenger interface {
+	Message(tx *gorm.DB, userID string, award *model.Award) (blessingID int, message string, err error)
+}
+
+// Message picks a weighted blessing among those the user has received the
+// fewest times, so the pool goes round in full cycles.
+func (blessingKind) Message(tx *gorm.DB, userID string, award *model.Award) (int, string, error) {
+	var pool []model.Blessing
+	if err := tx.Where("enabled = ?", true).Order("id asc").Find(&pool).Error; err != nil {
+		return 0, "", err
+	}
+	if len(pool) == 0 {
+		return 0, award.Name, nil
+	}
+
+	var shown []struct {
+		BlessingID int
+		Times      int
+	}
+	if err := tx.Model(&model.DrawRecord{}).
+		Select("blessing_id, COUNT(*) AS times").
+		Where("user_id = ? AND blessing_id > 0", userID).
+		Group("blessing_id").Scan(&shown).Error; err != nil {
+		return 0, "", err
+	}
+	seen := make(map[int]int, len(shown))
+	for _, s := range shown {
+		seen[s.BlessingID] = s.Times
+	}
+
+	picked := PickBlessing(pool, seen, rand.Intn)
+
+	var user model.User
+	tx.Where("user_id = ?", userID).First(&user)
+	return picked.ID, RenderBlessing(picked.Template, &user), nil
+}
+
+// PickBlessing does a weighted pick over the least-seen blessings of pool;
+// seen counts how often the user got each blessing id. Weights only order
+// the picks within a cycle, so a heavy blessing never comes round twice
+// before a light one comes round once.
+func PickBlessing(pool []model.Blessing, seen map[int]int, intn func(int) int) *model.Blessing {
+	least := seen[pool[0].ID]
+	for _, b := range pool[1:] {
+		least = min(least, seen[b.ID])
+	}
+
+	var fresh []model.Blessing
+	for _, b := range pool {
+		if seen[b.ID] == least {
+			fresh = append(fresh, b)
+		}
+	}
+
+	total := 0
+	for _, b := range fresh {
+		total += max(b.Weight, 1)
+	}
+	r := intn(total)
+	for i := range fresh {
+		r -= max(fresh[i].Weight, 1)
+		if r < 0 {
+			return &fresh[i]
+		}
+	}
+	return &fresh[len(fresh)-1]
+}
+
+// RenderBlessing fills in {name} and {department}
+func RenderBlessing(template string, user *model.User) string {
+	name := user.Name
+	if name == "" {
+		name = user.UserID
+	}
+	dept := user.Department.Names()
+	if dept == "" {
+		dept = "神州云服"
+	}
+	return strings.NewReplacer("{name}", name, "{department}", dept).Replace(template)
+}
+
+type BlessingLogic struct {
+	ctx *svc.ServiceContext
+}
+
+func NewBlessingLogic(ctx *svc.ServiceContext) *BlessingLogic {
+	return &BlessingLogic{ctx: ctx}
+}
+
+type BlessingRequest struct {
+	Template string `json:"template"`
+	Weight   int    `json:"weight"`
+	Enabled  *bool  `json:"enabled"`
+}
+
+func (r *BlessingRequest) Validate() error {
+	if r.Template == "" || utf8.RuneCountInString(r.Template) > 100 {
+		return errors.New("template must be 1-100 characters")
+	}
+	if r.Weight <= 0 || r.Weight > 10000 {
+		return errors.New("weight must be between 1 and 10000")
+	}
+	return nil
+}
+
+func (l *BlessingLogic) ListBlessings() ([]model.Blessing, error) {
+	var list []model.Blessing
+	err := l.ctx.DB.Order("id asc").Find(&list).Error
+	return list, err
+}
+
+func (l *BlessingLogic) CreateBlessing(req BlessingRequest) (*model.Blessing, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	b := model.Blessing{Template: req.Template, Weight: req.Weight, Enabled: true}
+	if err := l.ctx.DB.Create(&b).Error; err != nil {
+		return nil, err
+	}
+	if req.Enabled != nil && !*req.Enabled {
+		// GORM skips false for columns with a default, so disable explicitly
+		if err := l.ctx.DB.Model(&b).Update("enabled", false).Error; err != nil {
+			return nil, err
+		}
+		b.Enabled = false
+	}
+	return &b, nil
+}
+
+func (l *BlessingLogic) UpdateBlessing(id int, req BlessingRequest) (*model.Blessing, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	var b model.Blessing
+	if err := l.ctx.DB.First(&b, id).Error; err != nil {
+		return nil, ErrBlessingNotFound
+	}
+
+	updates := map[string]interface{}{
+		"template": req.Template,
+		"weight":   req.Weight,
+	}
+	if req.Enabled != nil {
+		updates["enabled"] = *req.Enabled
+	}
+	if err := l.ctx.DB.Model(&b).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return &b, l.ctx.DB.First(&b, id).Error
+}
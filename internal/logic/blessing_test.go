@@ -0,0 +1,47 @@
+package logic
+
+import (
+	"happynewyear/internal/model"
+	"math/rand"
+	"testing"
+)
+
+func TestPickBlessingFullCycles(t *testing.T) {
+	pool := []model.Blessing{
+		{ID: 1, Template: "a", Weight: 100},
+		{ID: 2, Template: "b", Weight: 1},
+		{ID: 3, Template: "c", Weight: 1},
+	}
+
+	seen := map[int]int{}
+	for cycle := 1; cycle <= 5; cycle++ {
+		inCycle := map[int]bool{}
+		for i := 0; i < len(pool); i++ {
+			b := PickBlessing(pool, seen, rand.Intn)
+			if inCycle[b.ID] {
+				t.Fatalf("cycle %d: blessing %d repeated before the pool went round", cycle, b.ID)
+			}
+			inCycle[b.ID] = true
+			seen[b.ID]++
+		}
+		for _, b := range pool {
+			if seen[b.ID] != cycle {
+				t.Fatalf("after cycle %d: blessing %d shown %d times", cycle, b.ID, seen[b.ID])
+			}
+		}
+	}
+
+	// A blessing added mid-event is shown before the others come round again
+	pool = append(pool, model.Blessing{ID: 4, Template: "d", Weight: 1})
+	if b := PickBlessing(pool, seen, rand.Intn); b.ID != 4 {
+		t.Errorf("picked %d instead of the new blessing", b.ID)
+	}
+}
+
+func TestRenderBlessing(t *testing.T) {
+	user := &model.User{UserID: "zhangsan", Name: "张三", Department: model.Departments{{ID: 2, Name: "研发部"}}}
+	got := RenderBlessing("祝{department}的{name}新春快乐", user)
+	if got != "祝研发部的张三新春快乐" {
+		t.Errorf("unexpected render: %s", got)
+	}
+}
@@ -0,0 +1,322 @@
+package logic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"happynewyear/internal/config"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	checkpointPeriod        = time.Hour
+	defaultCheckpointSettle = 5 * time.Minute
+)
+
+type CheckpointLogic struct {
+	ctx  *svc.ServiceContext
+	sink CheckpointSink
+}
+
+func NewCheckpointLogic(ctx *svc.ServiceContext) *CheckpointLogic {
+	return &CheckpointLogic{ctx: ctx, sink: NewCheckpointSink(ctx.Config)}
+}
+
+// CheckpointSink publishes a Merkle root somewhere outside our own database
+type CheckpointSink interface {
+	Name() string
+	Publish(cp *model.DrawCheckpoint) error
+}
+
+func NewCheckpointSink(cfg config.Config) CheckpointSink {
+	switch cfg.Checkpoint.Sink {
+	case "file":
+		return &FileCheckpointSink{Path: cfg.Checkpoint.FilePath}
+	case "wecom":
+		return &WeComWebhookSink{URL: cfg.Checkpoint.WebhookURL}
+	default:
+		return nil
+	}
+}
+
+// FileCheckpointSink appends one JSON line per checkpoint
+type FileCheckpointSink struct {
+	Path string
+}
+
+func (s *FileCheckpointSink) Name() string { return "file" }
+
+func (s *FileCheckpointSink) Publish(cp *model.DrawCheckpoint) error {
+	if dir := filepath.Dir(s.Path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	line, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// WeComWebhookSink posts the root to a WeCom group robot
+type WeComWebhookSink struct {
+	URL string
+}
+
+func (s *WeComWebhookSink) Name() string { return "wecom" }
+
+func (s *WeComWebhookSink) Publish(cp *model.DrawCheckpoint) error {
+	if s.URL == "" {
+		return errors.New("checkpoint webhook url not configured")
+	}
+	content := fmt.Sprintf("抽奖记录存证 %s ~ %s\n记录 #%d - #%d (%d 条)\nMerkle Root: %s",
+		cp.PeriodStart.Format("2006-01-02 15:04"), cp.PeriodEnd.Format("15:04"),
+		cp.FirstRecordID, cp.LastRecordID, cp.LeafCount, cp.MerkleRoot)
+	body, _ := json.Marshal(map[string]interface{}{
+		"msgtype": "text",
+		"text":    map[string]string{"content": content},
+	})
+
+	resp, err := http.Post(s.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("webhook error: %d %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+// Run anchors every finished hour on a ticker until ctx is cancelled, and
+// retries publishing roots the sink did not take
+func (l *CheckpointLogic) Run(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		if n, err := l.AnchorPending(time.Now()); err != nil {
+			log.Printf("Checkpoint: anchoring failed: %v", err)
+		} else if n > 0 {
+			log.Printf("Checkpoint: anchored %d period(s)", n)
+		}
+		if err := l.PublishPending(); err != nil {
+			log.Printf("Checkpoint: publishing failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *CheckpointLogic) settle() time.Duration {
+	if m := l.ctx.Config.Checkpoint.SettleMinutes; m > 0 {
+		return time.Duration(m) * time.Minute
+	}
+	return defaultCheckpointSettle
+}
+
+// openPeriodStart is the start of the first period that may still get draws
+// at now: a draw stamps created_at inside its transaction, so the hour before
+// stays open until those transactions have had settle to commit. Sealing it
+// earlier would leave such a draw out of the root for good.
+func openPeriodStart(now time.Time, settle time.Duration) time.Time {
+	return now.Add(-settle).Truncate(checkpointPeriod)
+}
+
+// AnchorPending creates checkpoints for all settled periods before now
+// that have draws but no checkpoint yet. Empty periods are skipped.
+func (l *CheckpointLogic) AnchorPending(now time.Time) (int, error) {
+	current := openPeriodStart(now, l.settle())
+
+	var last model.DrawCheckpoint
+	cursor := time.Time{}
+	if err := l.ctx.DB.Order("period_start desc").Limit(1).Find(&last).Error; err != nil {
+		return 0, err
+	}
+	if last.ID > 0 {
+		cursor = last.PeriodEnd
+	}
+
+	anchored := 0
+	for {
+		var next model.DrawRecord
+		q := l.ctx.DB.Order("created_at asc, id asc").Limit(1)
+		if !cursor.IsZero() {
+			q = q.Where("created_at >= ?", cursor)
+		}
+		res := q.Find(&next)
+		if res.Error != nil {
+			return anchored, res.Error
+		}
+		if res.RowsAffected == 0 {
+			return anchored, nil
+		}
+
+		start := next.CreatedAt.Truncate(checkpointPeriod)
+		if !start.Before(current) {
+			// Period still open
+			return anchored, nil
+		}
+
+		cp, err := l.anchorPeriod(start)
+		if err != nil {
+			return anchored, err
+		}
+		anchored++
+		cursor = cp.PeriodEnd
+	}
+}
+
+func (l *CheckpointLogic) anchorPeriod(start time.Time) (*model.DrawCheckpoint, error) {
+	end := start.Add(checkpointPeriod)
+	records, err := l.periodRecords(start, end)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("empty checkpoint period")
+	}
+
+	leaves := make([]string, len(records))
+	for i, r := range records {
+		leaves[i] = r.FinalHash
+	}
+
+	cp := model.DrawCheckpoint{
+		PeriodStart:   start,
+		PeriodEnd:     end,
+		FirstRecordID: records[0].ID,
+		LastRecordID:  records[len(records)-1].ID,
+		LeafCount:     len(leaves),
+		MerkleRoot:    BuildMerkleRoot(leaves),
+	}
+	if err := l.ctx.DB.Create(&cp).Error; err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// PublishPending sends new checkpoints to the sink, oldest first, and retries
+// the ones it did not take before
+func (l *CheckpointLogic) PublishPending() error {
+	if l.sink == nil {
+		return nil
+	}
+	var pending []model.DrawCheckpoint
+	if err := l.ctx.DB.Where("published_to = ?", "").Order("id asc").Find(&pending).Error; err != nil {
+		return err
+	}
+	for i := range pending {
+		if !l.publish(&pending[i]) {
+			// Keep the order: a later root never goes out before an earlier one
+			break
+		}
+	}
+	return nil
+}
+
+// publish sends cp to the sink and records where it went. A failure leaves
+// published_to empty for the next PublishPending.
+func (l *CheckpointLogic) publish(cp *model.DrawCheckpoint) bool {
+	if err := l.sink.Publish(cp); err != nil {
+		log.Printf("Checkpoint: publish #%d to %s failed: %v", cp.ID, l.sink.Name(), err)
+		return false
+	}
+	cp.PublishedTo = l.sink.Name()
+	if err := l.ctx.DB.Model(cp).Update("published_to", cp.PublishedTo).Error; err != nil {
+		log.Printf("Checkpoint: published #%d but could not record it: %v", cp.ID, err)
+	}
+	return true
+}
+
+func (l *CheckpointLogic) periodRecords(start, end time.Time) ([]model.DrawRecord, error) {
+	var records []model.DrawRecord
+	err := l.ctx.DB.Where("created_at >= ? AND created_at < ?", start, end).Order("id asc").Find(&records).Error
+	return records, err
+}
+
+func (l *CheckpointLogic) ListCheckpoints() ([]model.DrawCheckpoint, error) {
+	var list []model.DrawCheckpoint
+	err := l.ctx.DB.Order("period_start desc").Find(&list).Error
+	return list, err
+}
+
+type DrawProof struct {
+	DrawID     int64                 `json:"draw_id"`
+	Leaf       string                `json:"leaf"` // FinalHash of the draw
+	Index      int                   `json:"index"`
+	Proof      []ProofStep           `json:"proof"`
+	Checkpoint *model.DrawCheckpoint `json:"checkpoint"`
+}
+
+// GetInclusionProof proves that one of the user's own draws is under an anchored root
+func (l *CheckpointLogic) GetInclusionProof(userID string, drawID int64) (*DrawProof, error) {
+	var record model.DrawRecord
+	if err := l.ctx.DB.Where("id = ? AND user_id = ?", drawID, userID).First(&record).Error; err != nil {
+		return nil, errors.New("draw record not found")
+	}
+
+	start := record.CreatedAt.Truncate(checkpointPeriod)
+	var cp model.DrawCheckpoint
+	if err := l.ctx.DB.Where("period_start = ?", start).First(&cp).Error; err != nil {
+		return nil, errors.New("draw not anchored yet")
+	}
+
+	records, err := l.periodRecords(cp.PeriodStart, cp.PeriodEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	index := -1
+	leaves := make([]string, len(records))
+	for i, r := range records {
+		leaves[i] = r.FinalHash
+		if r.ID == record.ID {
+			index = i
+		}
+	}
+	if index < 0 || BuildMerkleRoot(leaves) != cp.MerkleRoot {
+		return nil, errors.New("checkpoint mismatch")
+	}
+
+	proof, err := BuildMerkleProof(leaves, index)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DrawProof{
+		DrawID:     record.ID,
+		Leaf:       record.FinalHash,
+		Index:      index,
+		Proof:      proof,
+		Checkpoint: &cp,
+	}, nil
+}
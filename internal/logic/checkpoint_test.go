@@ -0,0 +1,75 @@
+package logic
+
+import (
+	"errors"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenPeriodStart(t *testing.T) {
+	settle := 5 * time.Minute
+	cases := []struct {
+		now  string
+		want string
+	}{
+		{"10:00:00", "09:00:00"}, // The hour just closed may still have draws committing
+		{"10:04:59", "09:00:00"},
+		{"10:05:00", "10:00:00"}, // Settled: 09:00 can be sealed
+		{"10:59:59", "10:00:00"},
+	}
+	for _, c := range cases {
+		now, _ := time.Parse("15:04:05", c.now)
+		want, _ := time.Parse("15:04:05", c.want)
+		if got := openPeriodStart(now, settle); !got.Equal(want) {
+			t.Errorf("at %s: open period starts %s, want %s", c.now, got.Format("15:04:05"), c.want)
+		}
+	}
+}
+
+// stubSink records what it was asked to publish and fails on demand
+type stubSink struct {
+	err       error
+	published []int64
+}
+
+func (s *stubSink) Name() string { return "stub" }
+
+func (s *stubSink) Publish(cp *model.DrawCheckpoint) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.published = append(s.published, cp.ID)
+	return nil
+}
+
+func TestCheckpointPublish(t *testing.T) {
+	db, rec := dryRunDB(t)
+	sink := &stubSink{err: errors.New("webhook down")}
+	l := &CheckpointLogic{ctx: &svc.ServiceContext{DB: db}, sink: sink}
+
+	// A failed publish leaves published_to empty, so PublishPending retries it
+	cp := &model.DrawCheckpoint{ID: 3}
+	if l.publish(cp) || cp.PublishedTo != "" || len(rec.statements) != 0 {
+		t.Fatalf("failed publish recorded: %+v, %v", cp, rec.statements)
+	}
+
+	sink.err = nil
+	if !l.publish(cp) || cp.PublishedTo != "stub" || len(sink.published) != 1 {
+		t.Fatalf("publish: %+v, sink got %v", cp, sink.published)
+	}
+	if len(rec.statements) != 1 || !strings.Contains(rec.statements[0], "SET `published_to`='stub'") {
+		t.Errorf("statements = %v", rec.statements)
+	}
+
+	// PublishPending picks up every checkpoint without a sink, oldest first
+	rec.statements = nil
+	if err := l.PublishPending(); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.statements) != 1 || !strings.Contains(rec.statements[0], "WHERE published_to = '' ORDER BY id asc") {
+		t.Errorf("statements = %v", rec.statements)
+	}
+}
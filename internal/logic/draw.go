@@ -3,6 +3,7 @@ package logic
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"happynewyear/internal/model"
@@ -13,6 +14,9 @@ import (
 	"gorm.io/gorm"
 )
 
+// GenesisHash is the PrevHash of the first record in the draw chain
+const GenesisHash = "GENESIS_HASH_2026"
+
 type DrawLogic struct {
 	ctx *svc.ServiceContext
 }
@@ -21,8 +25,18 @@ func NewDrawLogic(ctx *svc.ServiceContext) *DrawLogic {
 	return &DrawLogic{ctx: ctx}
 }
 
-func (l *DrawLogic) Draw(userID string) (*model.Award, error) {
+// DrawResult is what the player sees after a draw
+type DrawResult struct {
+	Award    model.Award
+	Message  string // Per-win message, e.g. a rendered blessing
+	RecordID int64
+	// RedemptionCode is set for prizes collected offline
+	RedemptionCode string
+}
+
+func (l *DrawLogic) Draw(userID string) (*DrawResult, error) {
 	var wonAward model.Award
+	var result DrawResult
 
 	err := l.ctx.DB.Transaction(func(tx *gorm.DB) error {
 		// 1. Deduct Chance
@@ -41,35 +55,38 @@ func (l *DrawLogic) Draw(userID string) (*model.Award, error) {
 		// 2. Select Prize
 		// Fetch available prizes
 		var candidates []model.Award
-		if err := tx.Where("remaining > 0").Find(&candidates).Error; err != nil {
+		if err := tx.Where("remaining > 0 AND retired = ?", false).Find(&candidates).Error; err != nil {
 			return err
 		}
 
-		// Filter: One of each special card per person
-		var wonPrizes []string
+		// Filter: once-per-user kinds (e.g. vacation card) the user already holds
+		var wonAwardIDs []int
 		tx.Model(&model.DrawRecord{}).
-			Where("user_id = ? AND award_name = ?", userID, "休假奖励卡").
-			Pluck("award_name", &wonPrizes)
+			Where("user_id = ?", userID).
+			Distinct().Pluck("award_id", &wonAwardIDs)
 
-		if len(wonPrizes) > 0 {
-			prizeMap := make(map[string]bool)
-			for _, p := range wonPrizes {
-				prizeMap[p] = true
+		if len(wonAwardIDs) > 0 {
+			wonMap := make(map[int]bool)
+			for _, id := range wonAwardIDs {
+				wonMap[id] = true
 			}
 			var filtered []model.Award
 			for _, a := range candidates {
-				if !prizeMap[a.Name] {
-					filtered = append(filtered, a)
+				if kind, ok := AwardKindOf(a.Type); ok && kind.OncePerUser() && wonMap[a.ID] {
+					continue
 				}
+				filtered = append(filtered, a)
 			}
 			candidates = filtered
 		}
 
 		selected := l.selectAward(candidates)
 		if selected == nil {
-			// Fallback to Sunshine (Type=3 or 4) if configured, or error
-			// Assume ID 999 or find a type=3
-			tx.Where("type >= 3").First(&selected)
+			// Nothing drawable left: fall back to a blessing-type award
+			var fallback model.Award
+			if err := tx.Where("type IN ? AND retired = ?", FallbackAwardTypes(), false).First(&fallback).Error; err == nil {
+				selected = &fallback
+			}
 		}
 		
 		if selected == nil {
@@ -86,7 +103,7 @@ func (l *DrawLogic) Draw(userID string) (*model.Award, error) {
 			// Collision! Retry or fallback.
 			// For MVP simplicity: Fallback to Sunshine
 			var sunshine model.Award
-			if err := tx.Where("type >= 3").First(&sunshine).Error; err == nil {
+			if err := tx.Where("type IN ? AND retired = ?", FallbackAwardTypes(), false).First(&sunshine).Error; err == nil {
 				selected = &sunshine
 				// Sunshine usually has unlimited (or huge) stock, but we should decr it too
 				tx.Model(&sunshine).Update("remaining", gorm.Expr("remaining - 1"))
@@ -97,13 +114,23 @@ func (l *DrawLogic) Draw(userID string) (*model.Award, error) {
 
 		wonAward = *selected
 
-		// 3.5. If Point-based Award (Type=4), credit User Total Score
-		if wonAward.Type == 4 && wonAward.Value > 0 {
-			if err := tx.Model(&model.User{}).
-				Where("user_id = ?", userID).
-				Update("total_score", gorm.Expr("total_score + ?", wonAward.Value)).Error; err != nil {
+		// 3.5. Apply the award's effect (points, chances ...)
+		kind, ok := AwardKindOf(wonAward.Type)
+		if !ok {
+			return fmt.Errorf("unknown award type %d", wonAward.Type)
+		}
+		if err := kind.Grant(tx, userID, &wonAward); err != nil {
+			return err
+		}
+
+		var blessingID int
+		message := wonAward.Name
+		if m, ok := kind.(AwardMessenger); ok {
+			id, msg, err := m.Message(tx, userID, &wonAward)
+			if err != nil {
 				return err
 			}
+			blessingID, message = id, msg
 		}
 
 		// 4. Audit Log (Chain Hash)
@@ -113,34 +140,51 @@ func (l *DrawLogic) Draw(userID string) (*model.Award, error) {
 		
 		prevHash := lastRecord.FinalHash
 		if prevHash == "" {
-			prevHash = "GENESIS_HASH_2026"
+			prevHash = GenesisHash
 		}
 
-		dataStr := fmt.Sprintf("%s%d%d", userID, wonAward.ID, time.Now().UnixNano())
-		dataHash := sha256Sum(dataStr)
-		finalHash := sha256Sum(dataHash + prevHash)
-
 		record := model.DrawRecord{
-			UserID:    userID,
-			AwardID:   wonAward.ID,
-			AwardName: wonAward.Name,
-			PrevHash:  prevHash,
-			DataHash:  dataHash,
-			FinalHash: finalHash,
+			UserID:     userID,
+			AwardID:    wonAward.ID,
+			AwardName:  wonAward.Name,
+			BlessingID: blessingID,
+			Message:    message,
+			PrevHash:   prevHash,
+			CreatedAt:  time.Now().UTC().Truncate(time.Second), // TIMESTAMP keeps whole seconds
+		}
+		record.DataHash = DrawDataHash(&record)
+		record.FinalHash = sha256Sum(record.DataHash + record.PrevHash)
+		redeemable, _ := kind.(Redeemable)
+		if redeemable != nil && redeemable.Redeemable() {
+			record.RedeemSecret = newRedeemSecret()
 		}
 		
 		if err := tx.Create(&record).Error; err != nil {
 			return err
 		}
 
+		result = DrawResult{Award: wonAward, Message: message, RecordID: record.ID}
+
+		// 5. Redemption code, and the winner's WeCom card in the same transaction
+		if record.RedeemSecret != "" {
+			result.RedemptionCode = RedemptionCode(&record)
+			if l.ctx.Config.Notify.Enabled {
+				msg := PrizeWinMessage(l.ctx.Config.Notify.AppURL, &record)
+				if _, err := NewNotifyLogic(l.ctx).Enqueue(tx, msg); err != nil {
+					return err
+				}
+			}
+		}
+
 		return nil
 	})
 
 	if err != nil {
 		return nil, err
 	}
+	NewStatsLogic(l.ctx).Drew(userID, &wonAward)
 
-	return &wonAward, nil
+	return &result, nil
 }
 
 func (l *DrawLogic) selectAward(candidates []model.Award) *model.Award {
@@ -168,6 +212,31 @@ func (l *DrawLogic) selectAward(candidates []model.Award) *model.Award {
 	return &candidates[len(candidates)-1]
 }
 
+// drawPayload is what DataHash covers: the stored columns of a draw except
+// the id, the chain hashes and the redemption secret. Its field order is
+// fixed, so the JSON is canonical and a verifier can recompute it.
+type drawPayload struct {
+	UserID     string `json:"user_id"`
+	AwardID    int    `json:"award_id"`
+	AwardName  string `json:"award_name"`
+	BlessingID int    `json:"blessing_id"`
+	Message    string `json:"message"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+// DrawDataHash hashes the content of one draw
+func DrawDataHash(r *model.DrawRecord) string {
+	raw, _ := json.Marshal(drawPayload{
+		UserID:     r.UserID,
+		AwardID:    r.AwardID,
+		AwardName:  r.AwardName,
+		BlessingID: r.BlessingID,
+		Message:    r.Message,
+		CreatedAt:  r.CreatedAt.Unix(),
+	})
+	return sha256Sum(string(raw))
+}
+
 func sha256Sum(s string) string {
 	h := sha256.Sum256([]byte(s))
 	return hex.EncodeToString(h[:])
@@ -0,0 +1,468 @@
+package logic
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"happynewyear/internal/xlsx"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Export formats
+const (
+	ExportCSV  = "csv"
+	ExportXLSX = "xlsx"
+)
+
+// Export kinds
+const (
+	ExportUsers       = "users"
+	ExportDraws       = "draws"
+	ExportWinners     = "winners"
+	ExportFulfillment = "fulfillment"
+	ExportDepartments = "departments"
+)
+
+var ErrUnknownExport = errors.New("unknown export")
+
+// Fulfillment statuses, for ExportFilter.Status
+const (
+	FulfillmentPending  = "pending"
+	FulfillmentRedeemed = "redeemed"
+	FulfillmentVoided   = "voided"
+)
+
+var awardTypeTitles = map[model.AwardType]string{
+	model.AwardTypeGrandPrize:   "大奖",
+	model.AwardTypePrize:        "奖品",
+	model.AwardTypeBlessing:     "祝福",
+	model.AwardTypePoints:       "积分",
+	model.AwardTypeChances:      "抽奖次数",
+	model.AwardTypeVacationCard: "假期卡",
+}
+
+// ExportFilter narrows an export. Since and Until apply to the time column of
+// each export: registration for users, the draw for draws, winners and
+// fulfillment, games and draws for departments.
+type ExportFilter struct {
+	Since     time.Time
+	Until     time.Time
+	AwardType int    // draws, winners and fulfillment
+	Status    string // fulfillment only: pending, redeemed or voided
+}
+
+// ExportWriter receives rows one at a time; Close finishes the file
+type ExportWriter interface {
+	WriteRow(cells ...interface{}) error
+	Close() error
+}
+
+// NewExportWriter writes format to w. The sheet name is only used by XLSX.
+func NewExportWriter(w io.Writer, format, sheet string) (ExportWriter, error) {
+	switch format {
+	case ExportCSV:
+		// Excel only reads a CSV as UTF-8 when it starts with a BOM
+		if _, err := io.WriteString(w, "\ufeff"); err != nil {
+			return nil, err
+		}
+		return &csvExportWriter{w: csv.NewWriter(w)}, nil
+	case ExportXLSX:
+		return xlsx.NewWriter(w, sheet)
+	default:
+		return nil, fmt.Errorf("format must be %s or %s", ExportCSV, ExportXLSX)
+	}
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (e *csvExportWriter) WriteRow(cells ...interface{}) error {
+	record := make([]string, len(cells))
+	for i, v := range cells {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			record[i] = csvText(v)
+		case time.Time:
+			record[i] = v.Format("2006-01-02 15:04:05")
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return e.w.Write(record)
+}
+
+func (e *csvExportWriter) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// csvText keeps Excel from running names like "=HYPERLINK(...)" as formulas
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+type exportSpec struct {
+	Sheet      string     // Sheet name in the workbook
+	Permission Permission // Needed beyond the route's PermRead, if any
+	Header     []string
+	Rows       func(l *ExportLogic, f ExportFilter, emit func(cells ...interface{}) error) error
+}
+
+var exportSpecs = map[string]exportSpec{
+	ExportUsers: {
+		Sheet:  "参与人员",
+		Header: []string{"ID", "企业微信ID", "姓名", "部门", "职位", "总得分", "剩余抽奖次数", "等级", "状态", "注册时间"},
+		Rows:   (*ExportLogic).userRows,
+	},
+	ExportDraws: {
+		Sheet:  "抽奖记录",
+		Header: []string{"记录ID", "企业微信ID", "姓名", "部门", "奖品ID", "奖品", "奖品类型", "状态", "抽奖时间", "审计哈希"},
+		Rows:   (*ExportLogic).drawRows,
+	},
+	ExportWinners: {
+		// Redemption codes hand out prizes, so only the prize desk gets them
+		Sheet:      "中奖名单",
+		Permission: PermRedeem,
+		Header:     []string{"奖品类型", "奖品", "记录ID", "兑奖码", "企业微信ID", "姓名", "部门", "职位", "中奖时间"},
+		Rows:       (*ExportLogic).winnerRows,
+	},
+	ExportFulfillment: {
+		Sheet:      "奖品发放",
+		Permission: PermRedeem,
+		Header:     []string{"记录ID", "兑奖码", "企业微信ID", "姓名", "部门", "奖品", "中奖时间", "发放状态", "发放人", "发放时间", "备注"},
+		Rows:       (*ExportLogic).fulfillmentRows,
+	},
+	ExportDepartments: {
+		Sheet:  "部门参与情况",
+		Header: []string{"部门", "人数", "参与游戏人数", "参与率", "游戏局数", "抽奖人数", "抽奖次数", "总得分"},
+		Rows:   (*ExportLogic).departmentRows,
+	},
+}
+
+// ExportSheet returns the sheet name for kind, false for an unknown kind
+func ExportSheet(kind string) (string, bool) {
+	spec, ok := exportSpecs[kind]
+	return spec.Sheet, ok
+}
+
+// ExportPermission is what a role needs to download kind
+func ExportPermission(kind string) Permission {
+	if p := exportSpecs[kind].Permission; p != "" {
+		return p
+	}
+	return PermRead
+}
+
+type ExportLogic struct {
+	ctx *svc.ServiceContext
+}
+
+func NewExportLogic(ctx *svc.ServiceContext) *ExportLogic {
+	return &ExportLogic{ctx: ctx}
+}
+
+// Export streams kind into w row by row; rows are never all in memory. It
+// does not close w.
+func (l *ExportLogic) Export(kind string, f ExportFilter, w ExportWriter) error {
+	spec, ok := exportSpecs[kind]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownExport, kind)
+	}
+	header := make([]interface{}, len(spec.Header))
+	for i, h := range spec.Header {
+		header[i] = h
+	}
+	if err := w.WriteRow(header...); err != nil {
+		return err
+	}
+	return spec.Rows(l, f, w.WriteRow)
+}
+
+// streamRows scans q one row at a time
+func streamRows[T any](q *gorm.DB, fn func(*T) error) error {
+	rows, err := q.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v T
+		if err := q.ScanRows(rows, &v); err != nil {
+			return err
+		}
+		if err := fn(&v); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func timeRange(q *gorm.DB, column string, f ExportFilter) *gorm.DB {
+	if !f.Since.IsZero() {
+		q = q.Where(column+" >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		q = q.Where(column+" < ?", f.Until)
+	}
+	return q
+}
+
+func (l *ExportLogic) userRows(f ExportFilter, emit func(cells ...interface{}) error) error {
+	type row struct {
+		ID         int64
+		UserID     string
+		Name       string
+		Department string
+		Position   string
+		TotalScore int64
+		Chances    int
+		Disabled   bool
+		CreatedAt  time.Time
+	}
+	q := l.ctx.DB.Table("users").
+		Select("id, user_id, name, department, position, total_score, chances, disabled, created_at").
+		Order("id")
+	return streamRows(timeRange(q, "created_at", f), func(r *row) error {
+		status := "正常"
+		if r.Disabled {
+			status = "已停用"
+		}
+		return emit(r.ID, r.UserID, r.Name, departmentNames(r.Department), r.Position,
+			r.TotalScore, r.Chances, CalculateLevel(r.TotalScore), status, r.CreatedAt)
+	})
+}
+
+// drawRow is the joined draw shared by the draw, winner and fulfillment exports
+type drawRow struct {
+	ID           int64
+	UserID       string
+	Name         string
+	Department   string
+	Position     string
+	AwardID      int
+	AwardType    model.AwardType
+	AwardName    string
+	FinalHash    string
+	DataHash     string
+	RedeemSecret string
+	Voided       bool
+	CreatedAt    time.Time
+	RedeemedBy   *string
+	RedeemedAt   *time.Time
+	Note         *string
+}
+
+func (r *drawRow) code() string {
+	return RedemptionCode(&model.DrawRecord{ID: r.ID, RedeemSecret: r.RedeemSecret})
+}
+
+func (l *ExportLogic) drawQuery(f ExportFilter) *gorm.DB {
+	q := l.ctx.DB.Table("draw_records").
+		Select("draw_records.id, draw_records.user_id, COALESCE(users.name, '') AS name, " +
+			"COALESCE(users.department, '') AS department, COALESCE(users.position, '') AS position, " +
+			"draw_records.award_id, COALESCE(awards.type, 0) AS award_type, draw_records.award_name, " +
+			"draw_records.final_hash, draw_records.data_hash, draw_records.redeem_secret, voided_draws.id IS NOT NULL AS voided, " +
+			"draw_records.created_at, prize_redemptions.redeemed_by, prize_redemptions.created_at AS redeemed_at, " +
+			"prize_redemptions.note").
+		Joins("LEFT JOIN users ON users.user_id = draw_records.user_id").
+		Joins("LEFT JOIN awards ON awards.id = draw_records.award_id").
+		Joins("LEFT JOIN voided_draws ON voided_draws.draw_record_id = draw_records.id").
+		Joins("LEFT JOIN prize_redemptions ON prize_redemptions.draw_record_id = draw_records.id")
+	if f.AwardType > 0 {
+		q = q.Where("awards.type = ?", f.AwardType)
+	}
+	return timeRange(q, "draw_records.created_at", f)
+}
+
+func (l *ExportLogic) drawRows(f ExportFilter, emit func(cells ...interface{}) error) error {
+	q := l.drawQuery(f).Order("draw_records.id")
+	return streamRows(q, func(r *drawRow) error {
+		status := "有效"
+		if r.Voided {
+			status = "已作废"
+		}
+		return emit(r.ID, r.UserID, r.Name, departmentNames(r.Department), r.AwardID, r.AwardName,
+			awardTypeTitles[r.AwardType], status, r.CreatedAt, r.DataHash)
+	})
+}
+
+// winnerRows lists the prizes collected offline, unless f.AwardType asks for
+// another type, grouped by type and award. Voided draws are left out.
+func (l *ExportLogic) winnerRows(f ExportFilter, emit func(cells ...interface{}) error) error {
+	q := l.drawQuery(f).Where("voided_draws.id IS NULL").
+		Order("awards.type").Order("draw_records.award_id").Order("draw_records.id")
+	if f.AwardType == 0 {
+		q = q.Where("awards.type IN ?", redeemableAwardTypes())
+	}
+	return streamRows(q, func(r *drawRow) error {
+		return emit(awardTypeTitles[r.AwardType], r.AwardName, r.ID, r.code(), r.UserID, r.Name,
+			departmentNames(r.Department), r.Position, r.CreatedAt)
+	})
+}
+
+// fulfillmentRows tracks every prize collected offline: handed out, still
+// waiting, or voided by a reset
+func (l *ExportLogic) fulfillmentRows(f ExportFilter, emit func(cells ...interface{}) error) error {
+	q := l.drawQuery(f).Where("awards.type IN ?", redeemableAwardTypes()).Order("draw_records.id")
+	switch f.Status {
+	case "":
+	case FulfillmentPending:
+		q = q.Where("prize_redemptions.id IS NULL AND voided_draws.id IS NULL")
+	case FulfillmentRedeemed:
+		q = q.Where("prize_redemptions.id IS NOT NULL")
+	case FulfillmentVoided:
+		q = q.Where("voided_draws.id IS NOT NULL")
+	default:
+		return fmt.Errorf("status must be %s, %s or %s", FulfillmentPending, FulfillmentRedeemed, FulfillmentVoided)
+	}
+	return streamRows(q, func(r *drawRow) error {
+		status, by, note := "待发放", "", ""
+		var at interface{}
+		switch {
+		case r.RedeemedBy != nil:
+			status, by, at = "已发放", *r.RedeemedBy, *r.RedeemedAt
+			if r.Note != nil {
+				note = *r.Note
+			}
+		case r.Voided:
+			status = "已作废"
+		}
+		return emit(r.ID, r.code(), r.UserID, r.Name, departmentNames(r.Department), r.AwardName,
+			r.CreatedAt, status, by, at, note)
+	})
+}
+
+// departmentStats counts one department. A user in two departments counts
+// in both, so the rows can add up to more than the total.
+type departmentStats struct {
+	Name    string
+	Users   int
+	Players int
+	Games   int64
+	Drawers int
+	Draws   int64
+	Score   int64
+}
+
+func (s *departmentStats) add(games, draws, score int64) {
+	s.Users++
+	if games > 0 {
+		s.Players++
+	}
+	if draws > 0 {
+		s.Drawers++
+	}
+	s.Games += games
+	s.Draws += draws
+	s.Score += score
+}
+
+func (s *departmentStats) cells() []interface{} {
+	rate := "0.0%"
+	if s.Users > 0 {
+		rate = strconv.FormatFloat(float64(s.Players)*100/float64(s.Users), 'f', 1, 64) + "%"
+	}
+	return []interface{}{s.Name, s.Users, s.Players, rate, s.Games, s.Drawers, s.Draws, s.Score}
+}
+
+// departmentRows streams users with their game and draw counts and adds them
+// up per department; only the per-department totals are held in memory.
+func (l *ExportLogic) departmentRows(f ExportFilter, emit func(cells ...interface{}) error) error {
+	games := timeRange(l.ctx.DB.Table("game_records").Select("user_id, COUNT(*) AS n"), "created_at", f).Group("user_id")
+	draws := timeRange(l.ctx.DB.Table("draw_records").Select("user_id, COUNT(*) AS n"), "created_at", f).Group("user_id")
+	q := l.ctx.DB.Table("users").
+		Select("users.department, users.total_score, COALESCE(g.n, 0) AS games, COALESCE(d.n, 0) AS draws").
+		Joins("LEFT JOIN (?) AS g ON g.user_id = users.user_id", games).
+		Joins("LEFT JOIN (?) AS d ON d.user_id = users.user_id", draws).
+		Where("users.user_id NOT LIKE 'ext:%' AND users.user_id NOT LIKE 'guest:%'")
+
+	type row struct {
+		Department string
+		TotalScore int64
+		Games      int64
+		Draws      int64
+	}
+	depts := map[string]*departmentStats{}
+	total := &departmentStats{Name: "合计"}
+	err := streamRows(q, func(r *row) error {
+		total.add(r.Games, r.Draws, r.TotalScore)
+		for _, name := range departmentList(r.Department) {
+			s, ok := depts[name]
+			if !ok {
+				s = &departmentStats{Name: name}
+				depts[name] = s
+			}
+			s.add(r.Games, r.Draws, r.TotalScore)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(depts))
+	for name := range depts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := emit(depts[name].cells()...); err != nil {
+			return err
+		}
+	}
+	return emit(total.cells()...)
+}
+
+// departmentList decodes the users.department JSON into display names
+func departmentList(raw string) []string {
+	var deps model.Departments
+	if raw != "" {
+		json.Unmarshal([]byte(raw), &deps)
+	}
+	var names []string
+	for _, d := range deps {
+		if d.Name != "" {
+			names = append(names, d.Name)
+		} else {
+			names = append(names, "部门 "+strconv.Itoa(d.ID))
+		}
+	}
+	if len(names) == 0 {
+		return []string{"未分配部门"}
+	}
+	return names
+}
+
+func departmentNames(raw string) string {
+	var deps model.Departments
+	if raw != "" {
+		json.Unmarshal([]byte(raw), &deps)
+	}
+	return deps.Names()
+}
+
+// redeemableAwardTypes lists the types handed out by the admin office
+func redeemableAwardTypes() []model.AwardType {
+	var types []model.AwardType
+	for t, k := range awardKinds {
+		if r, ok := k.(Redeemable); ok && r.Redeemable() {
+			types = append(types, t)
+		}
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
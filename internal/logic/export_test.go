@@ -0,0 +1,104 @@
+package logic
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSVExportWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewExportWriter(&buf, ExportCSV, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteRow("姓名", "积分", "时间")
+	w.WriteRow("=HYPERLINK(\"x\")", int64(-5), time.Date(2026, 2, 1, 20, 0, 0, 0, time.Local))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if !strings.HasPrefix(out, "\ufeff姓名,") {
+		t.Fatalf("missing BOM: %q", out[:10])
+	}
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(out, "\ufeff"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"'=HYPERLINK(\"x\")", "-5", "2026-02-01 20:00:00"}
+	for i, v := range want {
+		if records[1][i] != v {
+			t.Errorf("cell %d = %q, want %q", i, records[1][i], v)
+		}
+	}
+
+	if _, err := NewExportWriter(&buf, "pdf", ""); err == nil {
+		t.Error("pdf accepted")
+	}
+}
+
+func TestExportUnknownKind(t *testing.T) {
+	err := NewExportLogic(&svc.ServiceContext{}).Export("salaries", ExportFilter{}, nil)
+	if !errors.Is(err, ErrUnknownExport) {
+		t.Errorf("err = %v", err)
+	}
+	for _, kind := range []string{ExportUsers, ExportDraws, ExportWinners, ExportFulfillment, ExportDepartments} {
+		if _, ok := ExportSheet(kind); !ok {
+			t.Errorf("%s is not registered", kind)
+		}
+	}
+	// Redemption codes stay with the prize desk
+	for kind, want := range map[string]Permission{ExportDraws: PermRead, ExportWinners: PermRedeem, ExportFulfillment: PermRedeem} {
+		if got := ExportPermission(kind); got != want {
+			t.Errorf("%s needs %s, want %s", kind, got, want)
+		}
+	}
+	if HasPermission(RoleViewer, ExportPermission(ExportWinners)) {
+		t.Error("a viewer can download redemption codes")
+	}
+}
+
+func TestDepartmentList(t *testing.T) {
+	got := departmentList(`[{"id":2,"name":"研发部"},{"id":7,"name":""}]`)
+	if len(got) != 2 || got[0] != "研发部" || got[1] != "部门 7" {
+		t.Errorf("departmentList = %v", got)
+	}
+	for _, raw := range []string{"", "[]", "not json"} {
+		if got := departmentList(raw); len(got) != 1 || got[0] != "未分配部门" {
+			t.Errorf("departmentList(%q) = %v", raw, got)
+		}
+	}
+}
+
+func TestDepartmentStats(t *testing.T) {
+	s := &departmentStats{Name: "研发部"}
+	s.add(3, 1, 120)
+	s.add(0, 0, 0)
+	s.add(0, 2, 10)
+	cells := s.cells()
+	if cells[1] != 3 || cells[2] != 1 || cells[3] != "33.3%" || cells[4] != int64(3) || cells[5] != 2 || cells[7] != int64(130) {
+		t.Errorf("cells = %v", cells)
+	}
+	if (&departmentStats{}).cells()[3] != "0.0%" {
+		t.Error("empty department rate")
+	}
+}
+
+func TestRedeemableAwardTypes(t *testing.T) {
+	got := redeemableAwardTypes()
+	want := []model.AwardType{model.AwardTypeGrandPrize, model.AwardTypePrize, model.AwardTypeVacationCard}
+	if len(got) != len(want) {
+		t.Fatalf("redeemableAwardTypes = %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("redeemableAwardTypes = %v, want %v", got, want)
+		}
+	}
+}
@@ -24,29 +24,36 @@ func (l *GameLogic) StartGame(userID string) (string, string, error) {
 
 	// Optionally record game start in Redis/DB to enforce "Must Start to End"
 	// For MVP, we trust the signature/nonce on EndGame
+	NewStatsLogic(l.ctx).GameStarted(userID)
 	return gameID, nonce, nil
 }
 
 func (l *GameLogic) EndGame(userID string, score, duration int, nonce, sign, timestamp string) (int, error) {
+	stats := NewStatsLogic(l.ctx)
+
 	// 1. Security Checks
 	if !CheckAndSetNonce(l.ctx, nonce, userID) {
+		stats.GameRejected(RejectReplay)
 		return 0, errors.New("start game again") // Replay attack or used nonce
 	}
 
 	// 2. Validate Signature
 	if len(sign) > 0 { // Allow skipping sign check if empty during dev/test if needed? No, enforce.
 		// NOTE: For MVP debugging, you might want to log the expected string
-		if !VerifySignature(l.ctx.Config.Game.AppSecret, nonce, score, duration, timestamp, sign) {
+		if !l.verifyWithKeyring(nonce, score, duration, timestamp, sign) {
+			stats.GameRejected(RejectSignature)
 			return 0, errors.New("invalid signature")
 		}
 	}
 
 	// 3. Logic Validation
 	if duration <= 0 || score < 0 {
+		stats.GameRejected(RejectInvalidData)
 		return 0, errors.New("invalid game data")
 	}
 	// Speed check: e.g., max 50 points per second
 	if float64(score)/float64(duration) > 50.0 {
+		stats.GameRejected(RejectSpeed)
 		return 0, errors.New("abnormal game behavior")
 	}
 
@@ -93,6 +100,20 @@ func (l *GameLogic) EndGame(userID string, score, duration int, nonce, sign, tim
 
 		return nil
 	})
+	if err == nil {
+		stats.GameFinished(userID, score, earnedChances)
+	}
 
 	return earnedChances, err
 }
+
+// verifyWithKeyring accepts the current game key and the previous one during
+// its grace period, so games started before a rotation can still finish
+func (l *GameLogic) verifyWithKeyring(nonce string, score, duration int, timestamp, sign string) bool {
+	for _, key := range l.ctx.GameKeys.Verifying(time.Now()) {
+		if VerifySignature(string(key.Secret), nonce, score, duration, timestamp, sign) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package logic
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"happynewyear/internal/svc"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var ErrJSSDKURLNotAllowed = errors.New("url is not on the JS-SDK domain allowlist")
+
+type JSAPITicketResp struct {
+	WeComBaseResp
+	Ticket    string `json:"ticket"`
+	ExpiresIn int    `json:"expires_in"`
+}
+
+// GetJSAPITicket returns the corp jsapi_ticket used by wx.config
+func (c *WeComClient) GetJSAPITicket() (string, error) {
+	return c.jsapiTicket.Get(context.Background())
+}
+
+// GetAgentTicket returns the agent jsapi_ticket used by wx.agentConfig
+func (c *WeComClient) GetAgentTicket() (string, error) {
+	return c.agentTicket.Get(context.Background())
+}
+
+func (c *WeComClient) fetchJSAPITicket() (string, int, error) {
+	var result JSAPITicketResp
+	if err := c.get("/cgi-bin/get_jsapi_ticket", nil, &result); err != nil {
+		return "", 0, err
+	}
+	return result.Ticket, result.ExpiresIn, nil
+}
+
+func (c *WeComClient) fetchAgentTicket() (string, int, error) {
+	var result JSAPITicketResp
+	if err := c.get("/cgi-bin/ticket/get", url.Values{"type": {"agent_config"}}, &result); err != nil {
+		return "", 0, err
+	}
+	return result.Ticket, result.ExpiresIn, nil
+}
+
+// JSSDKSignature is what the page passes to wx.config / wx.agentConfig
+type JSSDKSignature struct {
+	CorpID    string `json:"corpid"`
+	AgentID   int    `json:"agentid,omitempty"` // agentConfig only
+	Timestamp int64  `json:"timestamp"`
+	NonceStr  string `json:"nonceStr"`
+	Signature string `json:"signature"`
+}
+
+type JSSDKConfig struct {
+	Config      JSSDKSignature `json:"config"`
+	AgentConfig JSSDKSignature `json:"agent_config"`
+}
+
+type JSSDKLogic struct {
+	ctx *svc.ServiceContext
+}
+
+func NewJSSDKLogic(ctx *svc.ServiceContext) *JSSDKLogic {
+	return &JSSDKLogic{ctx: ctx}
+}
+
+// Sign returns both signatures for the page at pageURL
+func (l *JSSDKLogic) Sign(pageURL string) (*JSSDKConfig, error) {
+	pageURL, err := NormalizeJSSDKURL(pageURL, l.ctx.Config.WeCom.JSSDKDomains)
+	if err != nil {
+		return nil, err
+	}
+
+	client := NewWeComClient(l.ctx)
+	jsapiTicket, err := client.GetJSAPITicket()
+	if err != nil {
+		return nil, fmt.Errorf("jsapi ticket: %v", err)
+	}
+	agentTicket, err := client.GetAgentTicket()
+	if err != nil {
+		return nil, fmt.Errorf("agent ticket: %v", err)
+	}
+
+	now := time.Now().Unix()
+	config := JSSDKSignature{CorpID: client.CorpID, Timestamp: now, NonceStr: randomHex(8)}
+	config.Signature = SignJSSDK(jsapiTicket, config.NonceStr, now, pageURL)
+
+	agent := JSSDKSignature{CorpID: client.CorpID, AgentID: client.AgentID, Timestamp: now, NonceStr: randomHex(8)}
+	agent.Signature = SignJSSDK(agentTicket, agent.NonceStr, now, pageURL)
+
+	return &JSSDKConfig{Config: config, AgentConfig: agent}, nil
+}
+
+// SignJSSDK is WeCom's sha1 over the fields in ascii order
+func SignJSSDK(ticket, nonceStr string, timestamp int64, pageURL string) string {
+	raw := fmt.Sprintf("jsapi_ticket=%s&noncestr=%s&timestamp=%d&url=%s", ticket, nonceStr, timestamp, pageURL)
+	sum := sha1.Sum([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeJSSDKURL drops the #fragment (WeCom signs without it) and checks
+// the host against the allowlist so we never sign for someone else's page.
+func NormalizeJSSDKURL(pageURL string, allowed []string) (string, error) {
+	u, err := url.Parse(pageURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil {
+		return "", ErrJSSDKURLNotAllowed
+	}
+
+	host := strings.ToLower(u.Hostname())
+	ok := false
+	for _, d := range allowed {
+		if host == strings.ToLower(strings.TrimSpace(d)) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return "", ErrJSSDKURLNotAllowed
+	}
+
+	if i := strings.IndexByte(pageURL, '#'); i >= 0 {
+		pageURL = pageURL[:i]
+	}
+	return pageURL, nil
+}
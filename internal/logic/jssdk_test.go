@@ -0,0 +1,33 @@
+package logic
+
+import "testing"
+
+func TestSignJSSDK(t *testing.T) {
+	// Example from the WeCom JS-SDK signature docs
+	got := SignJSSDK("sM4AOVdWfPE4DxkXGEs8VMCPGGVi4C3VM0P37wVUCFvkVAy_90u5h9nbSlYy3-Sl-HhTdfl2fzFy1AOcHKP7qg",
+		"Wm3WZYTPz0wzccnW", 1414587457, "http://mp.weixin.qq.com?params=value")
+	if want := "0f9de62fce790f9a083d5c99e95740ceb90c27ed"; got != want {
+		t.Fatalf("signature = %s, want %s", got, want)
+	}
+}
+
+func TestNormalizeJSSDKURL(t *testing.T) {
+	allowed := []string{"happynewyear.ilinkedge.cn"}
+	cases := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"https://happynewyear.ilinkedge.cn/draw?x=1#/home", "https://happynewyear.ilinkedge.cn/draw?x=1", true},
+		{"https://HappyNewYear.ilinkedge.cn:443/", "https://HappyNewYear.ilinkedge.cn:443/", true},
+		{"https://evil.example.com/?u=happynewyear.ilinkedge.cn", "", false},
+		{"https://happynewyear.ilinkedge.cn.evil.example.com/", "", false},
+		{"https://happynewyear.ilinkedge.cn@evil.example.com/", "", false},
+		{"javascript:alert(1)", "", false},
+	}
+	for _, tc := range cases {
+		got, err := NormalizeJSSDKURL(tc.in, allowed)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("NormalizeJSSDKURL(%q) = %q, %v", tc.in, got, err)
+		}
+	}
+}
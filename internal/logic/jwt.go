@@ -2,6 +2,7 @@ package logic
 
 import (
 	"errors"
+	"happynewyear/internal/keyring"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -13,29 +14,41 @@ var (
 )
 
 type Claims struct {
-	UserID string `json:"uid"`
-	Name   string `json:"name"`
+	UserID      string `json:"uid"`
+	Name        string `json:"name"`
+	SessionID   string `json:"sid"`  // Redis session; checked against the revocation list
+	Fingerprint string `json:"fp"`   // DeviceFingerprint of the User-Agent that logged in
+	CSRF        string `json:"csrf"` // Cookie sessions must echo this in X-CSRF-Token
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(secret string, userID, name string, duration time.Duration) (string, error) {
-	claims := Claims{
-		UserID: userID,
-		Name:   name,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "happynewyear",
-		},
+// GenerateToken signs claims with key, filling in the registered fields. The
+// key id goes in the kid header so ValidateToken can pick it after a rotation.
+func GenerateToken(key keyring.Key, claims Claims, duration time.Duration) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		Issuer:    "happynewyear",
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Secret)
 }
 
-func ValidateToken(secret, tokenString string) (*Claims, error) {
+// ValidateToken accepts tokens signed by the current key, a staged one, or
+// the previous one during its grace period
+func ValidateToken(keys *keyring.Keyring, tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ErrInvalidToken
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys.Lookup(kid, time.Now())
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+		return key.Secret, nil
 	})
 
 	if err != nil {
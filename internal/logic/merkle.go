@@ -0,0 +1,99 @@
+package logic
+
+import "errors"
+
+var ErrProofIndex = errors.New("proof index out of range")
+
+// ProofStep is one sibling hash on the path from a leaf to the Merkle root.
+// Position tells the verifier which side the sibling sits on.
+type ProofStep struct {
+	Hash     string `json:"hash"`
+	Position string `json:"position"` // "left" or "right"
+}
+
+// Leaf and node hashes are domain separated so an inner node can never be
+// passed off as a leaf. An odd node at the end of a level is promoted as-is
+// instead of being paired with itself.
+func merkleLeaf(data string) string {
+	return sha256Sum("\x00" + data)
+}
+
+func merkleNode(left, right string) string {
+	return sha256Sum("\x01" + left + right)
+}
+
+// BuildMerkleRoot returns the root over the given leaf data (e.g. FinalHash of each draw)
+func BuildMerkleRoot(leaves []string) string {
+	if len(leaves) == 0 {
+		return ""
+	}
+
+	level := make([]string, len(leaves))
+	for i, l := range leaves {
+		level[i] = merkleLeaf(l)
+	}
+
+	for len(level) > 1 {
+		var next []string
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				next = append(next, merkleNode(level[i], level[i+1]))
+			} else {
+				next = append(next, level[i])
+			}
+		}
+		level = next
+	}
+	return level[0]
+}
+
+// BuildMerkleProof returns the sibling path for leaves[index]
+func BuildMerkleProof(leaves []string, index int) ([]ProofStep, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, ErrProofIndex
+	}
+
+	level := make([]string, len(leaves))
+	for i, l := range leaves {
+		level[i] = merkleLeaf(l)
+	}
+
+	var proof []ProofStep
+	for len(level) > 1 {
+		if index%2 == 0 {
+			if index+1 < len(level) {
+				proof = append(proof, ProofStep{Hash: level[index+1], Position: "right"})
+			}
+		} else {
+			proof = append(proof, ProofStep{Hash: level[index-1], Position: "left"})
+		}
+
+		var next []string
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				next = append(next, merkleNode(level[i], level[i+1]))
+			} else {
+				next = append(next, level[i])
+			}
+		}
+		level = next
+		index /= 2
+	}
+	return proof, nil
+}
+
+// VerifyMerkleProof recomputes the root from a leaf and its proof
+func VerifyMerkleProof(leaf string, proof []ProofStep, root string) bool {
+	h := merkleLeaf(leaf)
+	for _, step := range proof {
+		switch step.Position {
+		case "left":
+			h = merkleNode(step.Hash, h)
+		case "right":
+			h = merkleNode(h, step.Hash)
+		default:
+			return false
+		}
+	}
+	return h == root
+}
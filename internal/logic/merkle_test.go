@@ -0,0 +1,44 @@
+package logic
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMerkleProofRoundTrip(t *testing.T) {
+	// Odd and even leaf counts exercise the promoted-node path
+	for _, n := range []int{1, 2, 3, 5, 8, 13} {
+		var leaves []string
+		for i := 0; i < n; i++ {
+			leaves = append(leaves, sha256Sum(fmt.Sprintf("draw-%d", i)))
+		}
+		root := BuildMerkleRoot(leaves)
+
+		for i := range leaves {
+			proof, err := BuildMerkleProof(leaves, i)
+			if err != nil {
+				t.Fatalf("n=%d i=%d: %v", n, i, err)
+			}
+			if !VerifyMerkleProof(leaves[i], proof, root) {
+				t.Errorf("n=%d i=%d: valid proof rejected", n, i)
+			}
+			if VerifyMerkleProof(sha256Sum("forged"), proof, root) {
+				t.Errorf("n=%d i=%d: forged leaf accepted", n, i)
+			}
+		}
+	}
+}
+
+func TestMerkleRootDetectsTamper(t *testing.T) {
+	leaves := []string{"a", "b", "c", "d"}
+	root := BuildMerkleRoot(leaves)
+
+	leaves[2] = "x"
+	if BuildMerkleRoot(leaves) == root {
+		t.Error("root unchanged after tampering with a leaf")
+	}
+
+	if _, err := BuildMerkleProof(leaves, 4); err != ErrProofIndex {
+		t.Errorf("expected ErrProofIndex, got %v", err)
+	}
+}
@@ -0,0 +1,477 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Notification kinds
+const (
+	NotifyKindPrizeWin          = "prize_win"
+	NotifyKindChanceReminder    = "chance_reminder"
+	NotifyKindLeaderboardFrozen = "leaderboard_frozen"
+	NotifyKindBroadcast         = "broadcast"
+)
+
+const (
+	notifyPollEvery     = 2 * time.Second
+	notifyBatchSize     = 20
+	notifyStaleAfter    = 5 * time.Minute // A "sending" row this old belongs to a dead worker
+	notifyMaxRecipients = 1000            // WeCom's touser limit per message/send
+	notifyBaseBackoff   = 30 * time.Second
+	notifyMaxBackoff    = 30 * time.Minute
+)
+
+// WeCom errcodes that will not get better with a retry
+var permanentSendErrCodes = map[int]bool{
+	40003: true, // invalid userid
+	44004: true, // empty content
+	81013: true, // every recipient is invalid
+}
+
+// Redeemable is an optional AwardKind extension for prizes collected offline
+// with a redemption code.
+type Redeemable interface {
+	Redeemable() bool
+}
+
+func (physicalKind) Redeemable() bool     { return true }
+func (vacationCardKind) Redeemable() bool { return true }
+
+// RedemptionCode is shown to the winner and checked by the admin office
+// against the draw record. Draws without a redeem secret have no code.
+func RedemptionCode(record *model.DrawRecord) string {
+	if record.RedeemSecret == "" {
+		return ""
+	}
+	return fmt.Sprintf("%d-%s", record.ID, record.RedeemSecret)
+}
+
+// newRedeemSecret is the random part of a redemption code: 40 bits, so a
+// code can't be guessed from the public draw hashes or by trying a few
+func newRedeemSecret() string {
+	return strings.ToUpper(randomHex(5))
+}
+
+type NotifyLogic struct {
+	ctx *svc.ServiceContext
+}
+
+func NewNotifyLogic(ctx *svc.ServiceContext) *NotifyLogic {
+	return &NotifyLogic{ctx: ctx}
+}
+
+// NotifyMessage is an app message before it is queued
+type NotifyMessage struct {
+	Kind      string
+	DedupKey  string
+	ToUser    []string // "@all" for everyone
+	ToParty   []int
+	MsgType   string      // text, textcard, template_card ...
+	Content   interface{} // Marshalled under the msgtype key
+	CreatedBy string
+}
+
+// Enqueue queues msg for the sender. db may be a transaction so the message
+// commits together with whatever caused it. A repeated DedupKey is a no-op.
+func (l *NotifyLogic) Enqueue(db *gorm.DB, msg NotifyMessage) (*model.Notification, error) {
+	if len(msg.ToUser) == 0 && len(msg.ToParty) == 0 {
+		return nil, errors.New("message has no recipients")
+	}
+	payload, err := json.Marshal(msg.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	parties := make([]string, len(msg.ToParty))
+	for i, id := range msg.ToParty {
+		parties[i] = strconv.Itoa(id)
+	}
+
+	n := model.Notification{
+		Kind:          msg.Kind,
+		DedupKey:      msg.DedupKey,
+		ToUser:        strings.Join(msg.ToUser, "|"),
+		ToParty:       strings.Join(parties, "|"),
+		MsgType:       msg.MsgType,
+		Payload:       string(payload),
+		Status:        model.NotificationPending,
+		NextAttemptAt: time.Now(),
+		CreatedBy:     msg.CreatedBy,
+	}
+	err = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&n).Error
+	return &n, err
+}
+
+// PrizeWinMessage is the template card a winner gets with their redemption code
+func PrizeWinMessage(appURL string, record *model.DrawRecord) NotifyMessage {
+	card := map[string]interface{}{
+		"card_type": "text_notice",
+		"source":    map[string]string{"desc": "新春好运大作战"},
+		"main_title": map[string]string{
+			"title": "恭喜抽中 " + record.AwardName,
+			"desc":  "请凭兑换码联系行政老师线下兑换",
+		},
+		"emphasis_content": map[string]string{
+			"title": RedemptionCode(record),
+			"desc":  "兑换码",
+		},
+		"horizontal_content_list": []map[string]string{
+			{"keyname": "奖品", "value": record.AwardName},
+			{"keyname": "抽奖编号", "value": fmt.Sprintf("#%d", record.ID)},
+			{"keyname": "中奖时间", "value": record.CreatedAt.Format("2006-01-02 15:04")},
+		},
+		"card_action": map[string]interface{}{"type": 1, "url": appURL},
+	}
+	return NotifyMessage{
+		Kind:     NotifyKindPrizeWin,
+		DedupKey: fmt.Sprintf("%s:%d", NotifyKindPrizeWin, record.ID),
+		ToUser:   []string{record.UserID},
+		MsgType:  "template_card",
+		Content:  card,
+	}
+}
+
+// BroadcastRequest is an admin-composed message to departments or everyone
+type BroadcastRequest struct {
+	Title         string `json:"title"`
+	Content       string `json:"content"`
+	URL           string `json:"url"` // Defaults to Notify.AppURL
+	DepartmentIDs []int  `json:"department_ids"`
+	ToAll         bool   `json:"to_all"`
+}
+
+func (r *BroadcastRequest) Validate() error {
+	if r.Title == "" || utf8.RuneCountInString(r.Title) > 128 {
+		return errors.New("title must be 1-128 characters")
+	}
+	if r.Content == "" || utf8.RuneCountInString(r.Content) > 512 {
+		return errors.New("content must be 1-512 characters")
+	}
+	if !r.ToAll && len(r.DepartmentIDs) == 0 {
+		return errors.New("choose department_ids or to_all")
+	}
+	if r.ToAll && len(r.DepartmentIDs) > 0 {
+		return errors.New("department_ids and to_all are exclusive")
+	}
+	if len(r.DepartmentIDs) > 100 {
+		return errors.New("at most 100 departments per broadcast")
+	}
+	return nil
+}
+
+func (l *NotifyLogic) Broadcast(req BroadcastRequest, createdBy string) (*model.Notification, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if req.URL == "" {
+		req.URL = l.ctx.Config.Notify.AppURL
+	}
+
+	msg := NotifyMessage{
+		Kind:      NotifyKindBroadcast,
+		DedupKey:  NotifyKindBroadcast + ":" + randomHex(8),
+		ToParty:   req.DepartmentIDs,
+		CreatedBy: createdBy,
+	}
+	if req.ToAll {
+		msg.ToUser = []string{"@all"}
+	}
+	if req.URL != "" {
+		msg.MsgType = "textcard"
+		msg.Content = map[string]string{"title": req.Title, "description": req.Content, "url": req.URL, "btntxt": "查看"}
+	} else {
+		msg.MsgType = "text"
+		msg.Content = map[string]string{"content": req.Title + "\n" + req.Content}
+	}
+	return l.Enqueue(l.ctx.DB, msg)
+}
+
+func (l *NotifyLogic) ListNotifications(status, kind string, limit int) ([]model.Notification, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	q := l.ctx.DB.Order("id desc").Limit(limit)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if kind != "" {
+		q = q.Where("kind = ?", kind)
+	}
+	var list []model.Notification
+	err := q.Find(&list).Error
+	return list, err
+}
+
+// Run schedules the periodic messages and drains the queue until ctx is cancelled
+func (l *NotifyLogic) Run(ctx context.Context) {
+	ticker := time.NewTicker(notifyPollEvery)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		if err := l.EnqueueChanceReminders(now); err != nil {
+			log.Printf("Notify: chance reminders failed: %v", err)
+		}
+		if err := l.EnqueueLeaderboardFrozen(now); err != nil {
+			log.Printf("Notify: leaderboard broadcast failed: %v", err)
+		}
+		if err := l.SendPending(ctx, now); err != nil {
+			log.Printf("Notify: send failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// EnqueueChanceReminders queues the daily "chances waiting" message during
+// ReminderHour, batched by WeCom's recipient limit.
+func (l *NotifyLogic) EnqueueChanceReminders(now time.Time) error {
+	hour := l.ctx.Config.Notify.ReminderHour
+	if hour <= 0 || now.Hour() != hour {
+		return nil
+	}
+	day := now.Format("2006-01-02")
+	rctx := context.Background()
+	lockKey := "notify:reminder:" + day
+	if ok, err := l.ctx.Redis.SetNX(rctx, lockKey, "1", 25*time.Hour).Result(); err != nil || !ok {
+		return err
+	}
+
+	var userIDs []string
+	err := l.ctx.DB.Model(&model.User{}).
+		Where("chances > 0 AND disabled = ? AND user_id NOT LIKE 'ext:%' AND user_id NOT LIKE 'guest:%'", false).
+		Order("id asc").Pluck("user_id", &userIDs).Error
+	if err != nil {
+		l.ctx.Redis.Del(rctx, lockKey)
+		return err
+	}
+
+	for i, batch := range chunkStrings(userIDs, notifyMaxRecipients) {
+		msg := NotifyMessage{
+			Kind:     NotifyKindChanceReminder,
+			DedupKey: fmt.Sprintf("%s:%s:%d", NotifyKindChanceReminder, day, i),
+			ToUser:   batch,
+			MsgType:  "textcard",
+			Content: map[string]string{
+				"title":       "你还有抽奖机会未使用",
+				"description": "新春好运大作战进行中，快来抽取今日好运吧！",
+				"url":         l.ctx.Config.Notify.AppURL,
+				"btntxt":      "去抽奖",
+			},
+		}
+		if _, err := l.Enqueue(l.ctx.DB, msg); err != nil {
+			l.ctx.Redis.Del(rctx, lockKey)
+			return err
+		}
+	}
+	return nil
+}
+
+// EnqueueLeaderboardFrozen announces the final top 3 to everyone once
+// Game.LeaderboardFreezeAt has passed.
+func (l *NotifyLogic) EnqueueLeaderboardFrozen(now time.Time) error {
+	freezeAt := l.ctx.Config.Game.LeaderboardFreezeAt
+	if freezeAt == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, freezeAt)
+	if err != nil {
+		return fmt.Errorf("invalid LeaderboardFreezeAt: %v", err)
+	}
+	if now.Before(t) {
+		return nil
+	}
+
+	dedupKey := NotifyKindLeaderboardFrozen + ":" + t.Format(time.RFC3339)
+	var count int64
+	if err := l.ctx.DB.Model(&model.Notification{}).Where("dedup_key = ?", dedupKey).Count(&count).Error; err != nil || count > 0 {
+		return err
+	}
+
+	ranks, err := NewRankLogic(l.ctx).GetRankList()
+	if err != nil {
+		return err
+	}
+	var lines []string
+	for _, r := range ranks {
+		if r.Rank > 3 {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("第 %d 名 %s（%d 云力值）", r.Rank, r.Name, r.TotalScore))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "本次活动暂无上榜选手")
+	}
+
+	_, err = l.Enqueue(l.ctx.DB, NotifyMessage{
+		Kind:     NotifyKindLeaderboardFrozen,
+		DedupKey: dedupKey,
+		ToUser:   []string{"@all"},
+		MsgType:  "textcard",
+		Content: map[string]string{
+			"title":       "云力值排行榜已封榜",
+			"description": strings.Join(lines, "\n"),
+			"url":         l.ctx.Config.Notify.AppURL,
+			"btntxt":      "查看榜单",
+		},
+	})
+	return err
+}
+
+// SendPending claims due messages and sends them within the rate limit
+func (l *NotifyLogic) SendPending(ctx context.Context, now time.Time) error {
+	// Rows a crashed worker left in "sending" go back to the queue
+	l.ctx.DB.Model(&model.Notification{}).
+		Where("status = ? AND updated_at < ?", model.NotificationSending, now.Add(-notifyStaleAfter)).
+		Update("status", model.NotificationPending)
+
+	var due []model.Notification
+	err := l.ctx.DB.Where("status = ? AND next_attempt_at <= ?", model.NotificationPending, now).
+		Order("id asc").Limit(notifyBatchSize).Find(&due).Error
+	if err != nil {
+		return err
+	}
+
+	client := NewWeComClient(l.ctx)
+	for i := range due {
+		n := &due[i]
+		// Claim it so another replica doesn't send the same row
+		res := l.ctx.DB.Model(&model.Notification{}).
+			Where("id = ? AND status = ?", n.ID, model.NotificationPending).
+			Updates(map[string]interface{}{"status": model.NotificationSending, "attempts": gorm.Expr("attempts + 1")})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			continue
+		}
+		n.Attempts++
+
+		if err := l.waitRateSlot(ctx); err != nil {
+			return err
+		}
+		l.ctx.DB.Model(n).Updates(l.send(client, n))
+	}
+	return nil
+}
+
+// send makes one delivery attempt and returns the row updates
+func (l *NotifyLogic) send(client *WeComClient, n *model.Notification) map[string]interface{} {
+	body := map[string]interface{}{
+		"msgtype":                  n.MsgType,
+		n.MsgType:                  json.RawMessage(n.Payload),
+		"enable_duplicate_check":   1,
+		"duplicate_check_interval": 1800,
+	}
+	if n.ToUser != "" {
+		body["touser"] = n.ToUser
+	}
+	if n.ToParty != "" {
+		body["toparty"] = n.ToParty
+	}
+
+	resp, err := client.SendMessage(body)
+	if err == nil {
+		return map[string]interface{}{
+			"status":       model.NotificationSent,
+			"sent_at":      time.Now(),
+			"msg_id":       resp.MsgID,
+			"invalid_user": truncate(resp.InvalidUser, 1024),
+			"last_error":   "",
+		}
+	}
+
+	updates := map[string]interface{}{"last_error": truncate(err.Error(), 512)}
+	var wecomErr *WeComError
+	permanent := errors.As(err, &wecomErr) && permanentSendErrCodes[wecomErr.Code]
+	if permanent || n.Attempts >= l.maxAttempts() {
+		updates["status"] = model.NotificationFailed
+	} else {
+		updates["status"] = model.NotificationPending
+		updates["next_attempt_at"] = time.Now().Add(notifyBackoff(n.Attempts))
+	}
+	return updates
+}
+
+// waitRateSlot blocks until this second's shared budget has room. The counter
+// lives in Redis so the limit holds across replicas.
+func (l *NotifyLogic) waitRateSlot(ctx context.Context) error {
+	rate := l.ctx.Config.Notify.RatePerSecond
+	if rate <= 0 {
+		rate = 10
+	}
+	for {
+		now := time.Now()
+		key := fmt.Sprintf("notify:rate:%d", now.Unix())
+		n, err := l.ctx.Redis.Incr(ctx, key).Result()
+		if err != nil {
+			// Redis is down: fall back to pacing this process alone
+			time.Sleep(time.Second / time.Duration(rate))
+			return nil
+		}
+		if n == 1 {
+			l.ctx.Redis.Expire(ctx, key, 2*time.Second)
+		}
+		if n <= int64(rate) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(now.Truncate(time.Second).Add(time.Second).Sub(now)):
+		}
+	}
+}
+
+func (l *NotifyLogic) maxAttempts() int {
+	if n := l.ctx.Config.Notify.MaxAttempts; n > 0 {
+		return n
+	}
+	return 5
+}
+
+// notifyBackoff doubles from 30s per attempt, capped at 30 minutes
+func notifyBackoff(attempts int) time.Duration {
+	d := notifyBaseBackoff
+	for i := 1; i < attempts && d < notifyMaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, notifyMaxBackoff)
+}
+
+func chunkStrings(s []string, size int) [][]string {
+	var chunks [][]string
+	for len(s) > size {
+		chunks = append(chunks, s[:size])
+		s = s[size:]
+	}
+	if len(s) > 0 {
+		chunks = append(chunks, s)
+	}
+	return chunks
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
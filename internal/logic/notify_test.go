@@ -0,0 +1,72 @@
+package logic
+
+import (
+	"happynewyear/internal/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifyBackoff(t *testing.T) {
+	cases := map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		3:  2 * time.Minute,
+		7:  30 * time.Minute,
+		20: 30 * time.Minute,
+	}
+	for attempts, want := range cases {
+		if got := notifyBackoff(attempts); got != want {
+			t.Errorf("notifyBackoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestChunkStrings(t *testing.T) {
+	ids := make([]string, 2500)
+	chunks := chunkStrings(ids, notifyMaxRecipients)
+	if len(chunks) != 3 || len(chunks[0]) != 1000 || len(chunks[2]) != 500 {
+		t.Fatalf("unexpected chunks: %d", len(chunks))
+	}
+	if chunkStrings(nil, 10) != nil {
+		t.Fatal("expected no chunks for no ids")
+	}
+}
+
+func TestRedemptionCode(t *testing.T) {
+	record := &model.DrawRecord{ID: 42, DataHash: "9f86d081884c7d65", FinalHash: "ab12cdef0000"}
+	if got := RedemptionCode(record); got != "" {
+		t.Fatalf("draw without a secret has code %s", got)
+	}
+
+	record.RedeemSecret = newRedeemSecret()
+	code := RedemptionCode(record)
+	id, secret, _ := strings.Cut(code, "-")
+	if id != "42" || len(secret) != 10 || secret != strings.ToUpper(secret) {
+		t.Fatalf("RedemptionCode = %s", code)
+	}
+	// Nothing public about the draw gives the code away
+	for _, hash := range []string{record.DataHash, record.FinalHash} {
+		if strings.Contains(strings.ToLower(hash), strings.ToLower(secret[:6])) {
+			t.Errorf("code %s derived from hash %s", code, hash)
+		}
+	}
+	if other := newRedeemSecret(); other == record.RedeemSecret {
+		t.Errorf("two draws got the same secret %s", other)
+	}
+}
+
+func TestBroadcastRequestValidate(t *testing.T) {
+	ok := BroadcastRequest{Title: "封榜通知", Content: "排行榜将于今晚 18:00 封榜", DepartmentIDs: []int{2}}
+	if err := ok.Validate(); err != nil {
+		t.Fatalf("valid request rejected: %v", err)
+	}
+	noTarget := BroadcastRequest{Title: "t", Content: "c"}
+	if noTarget.Validate() == nil {
+		t.Fatal("expected error without recipients")
+	}
+	both := BroadcastRequest{Title: "t", Content: "c", ToAll: true, DepartmentIDs: []int{1}}
+	if both.Validate() == nil {
+		t.Fatal("expected error for to_all with departments")
+	}
+}
@@ -0,0 +1,182 @@
+package logic
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"happynewyear/internal/svc"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OAuth modes: in-app authorize for the WeCom client, QR web login for desktop browsers
+const (
+	OAuthModeApp = "oauth"
+	OAuthModeQR  = "qr"
+)
+
+const (
+	DefaultWeComAuthorizeURL = "https://open.weixin.qq.com/connect/oauth2/authorize"
+	DefaultWeComQRLoginURL   = "https://login.work.weixin.qq.com/wwlogin/sso/login"
+
+	// OAuthNonceCookie binds a login attempt to the browser that started it
+	OAuthNonceCookie = "wecom_oauth"
+	OAuthStateTTL    = 10 * time.Minute
+)
+
+var ErrOAuthState = errors.New("login link is invalid or expired")
+
+type OAuthLogic struct {
+	ctx *svc.ServiceContext
+}
+
+func NewOAuthLogic(ctx *svc.ServiceContext) *OAuthLogic {
+	return &OAuthLogic{ctx: ctx}
+}
+
+// oauthPending is kept in Redis under the state nonce. WeCom caps state at
+// 128 bytes, so the return path can't travel inside it.
+type oauthPending struct {
+	Redirect string `json:"redirect"`
+	Mode     string `json:"mode"`
+}
+
+// OAuthStart is where to send the browser, plus the nonce for its cookie
+type OAuthStart struct {
+	URL   string
+	Nonce string
+}
+
+// Begin records a login attempt and builds the WeCom URL for mode. After
+// login the user is sent back to redirect, which must be a local path.
+func (l *OAuthLogic) Begin(mode, redirect, callbackURL string) (*OAuthStart, error) {
+	if mode != OAuthModeApp && mode != OAuthModeQR {
+		return nil, errors.New("unknown login mode")
+	}
+	nonce := randomHex(16)
+	pending, _ := json.Marshal(oauthPending{Redirect: SafeRedirectPath(redirect), Mode: mode})
+	if err := l.ctx.Redis.Set(context.Background(), oauthStateKey(nonce), pending, OAuthStateTTL).Err(); err != nil {
+		return nil, err
+	}
+	sig, err := l.signState(nonce)
+	if err != nil {
+		return nil, err
+	}
+	state := nonce + "." + sig
+
+	wecom := l.ctx.Config.WeCom
+	q := url.Values{}
+	q.Set("appid", wecom.CorpID)
+	q.Set("agentid", strconv.Itoa(wecom.AgentID))
+	q.Set("redirect_uri", callbackURL)
+	q.Set("state", state)
+
+	var target string
+	if mode == OAuthModeQR {
+		q.Set("login_type", "CorpApp")
+		target = l.endpoint(DefaultWeComQRLoginURL, "/wwlogin/sso/login") + "?" + q.Encode()
+	} else {
+		scope := wecom.OAuthScope
+		if scope == "" {
+			scope = "snsapi_base"
+		}
+		q.Set("response_type", "code")
+		q.Set("scope", scope)
+		// The authorize page requires the #wechat_redirect fragment
+		target = l.endpoint(DefaultWeComAuthorizeURL, "/connect/oauth2/authorize") + "?" + q.Encode() + "#wechat_redirect"
+	}
+	return &OAuthStart{URL: target, Nonce: nonce}, nil
+}
+
+// Complete checks state against its signature and the browser's nonce
+// cookie, and consumes it so a callback URL can't be replayed.
+func (l *OAuthLogic) Complete(state, cookieNonce string) (redirect string, err error) {
+	nonce, sig, ok := strings.Cut(state, ".")
+	if !ok || nonce == "" || !l.checkState(nonce, sig) {
+		return "", ErrOAuthState
+	}
+	if subtle.ConstantTimeCompare([]byte(nonce), []byte(cookieNonce)) != 1 {
+		return "", ErrOAuthState
+	}
+
+	raw, err := l.ctx.Redis.GetDel(context.Background(), oauthStateKey(nonce)).Result()
+	if err != nil {
+		return "", ErrOAuthState
+	}
+	var pending oauthPending
+	if err := json.Unmarshal([]byte(raw), &pending); err != nil {
+		return "", ErrOAuthState
+	}
+	return pending.Redirect, nil
+}
+
+// signState uses the JWT keyring; a login started just before a rotation
+// still completes with the previous key
+func (l *OAuthLogic) signState(nonce string) (string, error) {
+	key, err := l.ctx.JWTKeys.Signing(time.Now())
+	if err != nil {
+		return "", err
+	}
+	return stateMAC(key.Secret, nonce), nil
+}
+
+func (l *OAuthLogic) checkState(nonce, sig string) bool {
+	for _, key := range l.ctx.JWTKeys.Verifying(time.Now()) {
+		if hmac.Equal([]byte(sig), []byte(stateMAC(key.Secret, nonce))) {
+			return true
+		}
+	}
+	return false
+}
+
+func stateMAC(secret []byte, nonce string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("wecom-oauth:" + nonce))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// endpoint points the browser at cmd/wecommock when WeCom.BaseURL is overridden
+func (l *OAuthLogic) endpoint(real, path string) string {
+	base := strings.TrimRight(l.ctx.Config.WeCom.BaseURL, "/")
+	if base == "" || base == DefaultWeComBaseURL {
+		return real
+	}
+	return base + path
+}
+
+func oauthStateKey(nonce string) string {
+	return "oauth:state:" + nonce
+}
+
+// DetectOAuthMode picks QR login for desktop browsers outside the WeCom client
+func DetectOAuthMode(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	if strings.Contains(ua, "wxwork") || strings.Contains(ua, "micromessenger") {
+		return OAuthModeApp
+	}
+	for _, m := range []string{"android", "iphone", "ipad", "mobile"} {
+		if strings.Contains(ua, m) {
+			return OAuthModeApp
+		}
+	}
+	return OAuthModeQR
+}
+
+// SafeRedirectPath only allows same-origin paths, so the callback can't be
+// turned into an open redirect.
+func SafeRedirectPath(p string) string {
+	if p == "" || p[0] != '/' || strings.HasPrefix(p, "//") || strings.ContainsAny(p, "\\\r\n") {
+		return "/"
+	}
+	u, err := url.Parse(p)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return "/"
+	}
+	return p
+}
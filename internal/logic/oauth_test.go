@@ -0,0 +1,64 @@
+package logic
+
+import (
+	"happynewyear/internal/keyring"
+	"happynewyear/internal/svc"
+	"testing"
+)
+
+func TestSafeRedirectPath(t *testing.T) {
+	cases := map[string]string{
+		"":                       "/",
+		"/draw":                  "/draw",
+		"/rank?tab=dept":         "/rank?tab=dept",
+		"//evil.example.com":     "/",
+		"/\\evil.example.com":    "/",
+		"https://evil.example":   "/",
+		"draw":                   "/",
+		"/ok\r\nSet-Cookie: x=y": "/",
+	}
+	for in, want := range cases {
+		if got := SafeRedirectPath(in); got != want {
+			t.Errorf("SafeRedirectPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestDetectOAuthMode(t *testing.T) {
+	cases := map[string]string{
+		"Mozilla/5.0 (Windows NT 10.0) AppleWebKit/537.36 Chrome/120.0":                   OAuthModeQR,
+		"Mozilla/5.0 (Windows NT 10.0) wxwork/4.1.0 MicroMessenger/7.0.1":                 OAuthModeApp,
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148 wxwork/4.1": OAuthModeApp,
+		"Mozilla/5.0 (Linux; Android 14) Mobile Safari/537.36":                            OAuthModeApp,
+	}
+	for ua, want := range cases {
+		if got := DetectOAuthMode(ua); got != want {
+			t.Errorf("DetectOAuthMode(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
+
+func TestOAuthStateRejectedBeforeLookup(t *testing.T) {
+	keys, err := keyring.New([]keyring.Key{{ID: "k1", Secret: []byte("test-secret")}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewOAuthLogic(&svc.ServiceContext{JWTKeys: keys})
+
+	nonce := "0123456789abcdef"
+	sig, err := l.signState(nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := nonce + "." + sig
+
+	if _, err := l.Complete(nonce+".forged", nonce); err != ErrOAuthState {
+		t.Errorf("forged signature: err = %v", err)
+	}
+	if _, err := l.Complete(state, "another-browser"); err != ErrOAuthState {
+		t.Errorf("cookie mismatch: err = %v", err)
+	}
+	if _, err := l.Complete("no-dot", "no-dot"); err != ErrOAuthState {
+		t.Errorf("malformed state: err = %v", err)
+	}
+}
@@ -0,0 +1,361 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"log"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	orgSyncLockKey = "orgsync:lock"
+	orgSyncLockTTL = 10 * time.Minute
+	// A sync that would disable more than this share of active members is
+	// more likely a visibility misconfiguration than a mass exodus
+	orgSyncMaxDisableRatio = 0.2
+)
+
+var ErrOrgSyncRunning = errors.New("org sync already running")
+
+type DepartmentListResp struct {
+	WeComBaseResp
+	Department []WeComDepartment `json:"department"`
+}
+
+type UserListResp struct {
+	WeComBaseResp
+	UserList []WeComUser `json:"userlist"`
+}
+
+// ListDepartments returns every department visible to the app
+func (c *WeComClient) ListDepartments() ([]WeComDepartment, error) {
+	var result DepartmentListResp
+	if err := c.get("/cgi-bin/department/list", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Department, nil
+}
+
+// ListDepartmentUsers returns the direct members of one department
+func (c *WeComClient) ListDepartmentUsers(departmentID int) ([]WeComUser, error) {
+	var result UserListResp
+	if err := c.get("/cgi-bin/user/list", url.Values{"department_id": {strconv.Itoa(departmentID)}}, &result); err != nil {
+		return nil, err
+	}
+	return result.UserList, nil
+}
+
+// OrgSyncReport lists what a sync changed (or would change, for a dry run)
+type OrgSyncReport struct {
+	DryRun             bool      `json:"dry_run"`
+	Departments        int       `json:"departments"`
+	Members            int       `json:"members"`
+	DepartmentsAdded   []string  `json:"departments_added"`
+	DepartmentsChanged []string  `json:"departments_changed"`
+	DepartmentsRemoved []string  `json:"departments_removed"`
+	UsersAdded         []string  `json:"users_added"`
+	UsersUpdated       []string  `json:"users_updated"`
+	UsersDisabled      []string  `json:"users_disabled"`
+	UsersEnabled       []string  `json:"users_enabled"`
+	StartedAt          time.Time `json:"started_at"`
+	FinishedAt         time.Time `json:"finished_at"`
+}
+
+func (r *OrgSyncReport) Summary() string {
+	return fmt.Sprintf("%d departments (+%d ~%d -%d), %d members (+%d ~%d, %d disabled, %d re-enabled)",
+		r.Departments, len(r.DepartmentsAdded), len(r.DepartmentsChanged), len(r.DepartmentsRemoved),
+		r.Members, len(r.UsersAdded), len(r.UsersUpdated), len(r.UsersDisabled), len(r.UsersEnabled))
+}
+
+type OrgSyncLogic struct {
+	ctx *svc.ServiceContext
+}
+
+func NewOrgSyncLogic(ctx *svc.ServiceContext) *OrgSyncLogic {
+	return &OrgSyncLogic{ctx: ctx}
+}
+
+// Run syncs on start and then every interval until ctx is cancelled. A run
+// that finds another replica, the console or the CLI syncing is skipped.
+func (l *OrgSyncLogic) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if report, err := l.Sync(false, false); errors.Is(err, ErrOrgSyncRunning) {
+			log.Printf("OrgSync: skipped, another sync is running")
+		} else if err != nil {
+			log.Printf("OrgSync: failed: %v", err)
+		} else {
+			log.Printf("OrgSync: %s", report.Summary())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync pulls the department tree and members from WeCom and upserts them.
+// force allows disabling more than orgSyncMaxDisableRatio of active members.
+// Every entry point comes through here, so one Redis lock keeps the scheduled
+// run, the console and the CLI from writing at the same time; a second sync
+// gets ErrOrgSyncRunning. Dry runs write nothing and take no lock.
+func (l *OrgSyncLogic) Sync(dryRun, force bool) (*OrgSyncReport, error) {
+	if dryRun {
+		return l.sync(dryRun, force)
+	}
+	rctx := context.Background()
+	owner := GenerateNonce()
+	ok, err := l.ctx.Redis.SetNX(rctx, orgSyncLockKey, owner, orgSyncLockTTL).Result()
+	if err != nil {
+		return nil, fmt.Errorf("org sync lock: %v", err)
+	}
+	if !ok {
+		return nil, ErrOrgSyncRunning
+	}
+	defer compareAndDeleteScript.Run(rctx, l.ctx.Redis, []string{orgSyncLockKey}, owner)
+	return l.sync(dryRun, force)
+}
+
+func (l *OrgSyncLogic) sync(dryRun, force bool) (*OrgSyncReport, error) {
+	report := &OrgSyncReport{DryRun: dryRun, StartedAt: time.Now()}
+	client := NewWeComClient(l.ctx)
+
+	depts, err := client.ListDepartments()
+	if err != nil {
+		return nil, fmt.Errorf("list departments: %v", err)
+	}
+	deptNames := make(map[int]string, len(depts))
+	for _, d := range depts {
+		deptNames[d.ID] = d.Name
+	}
+
+	// user/list is per department; people in several departments show up once each
+	members := make(map[string]WeComUser)
+	memberCount := make(map[int]int)
+	for _, d := range depts {
+		users, err := client.ListDepartmentUsers(d.ID)
+		if err != nil {
+			return nil, fmt.Errorf("list users of department %d: %v", d.ID, err)
+		}
+		memberCount[d.ID] = len(users)
+		for _, u := range users {
+			members[u.UserID] = u
+		}
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("wecom returned no members; check the app's visible range")
+	}
+	report.Departments, report.Members = len(depts), len(members)
+
+	var existingDepts []model.Department
+	if err := l.ctx.DB.Find(&existingDepts).Error; err != nil {
+		return nil, err
+	}
+	var existingUsers []model.User
+	if err := l.ctx.DB.Where("user_id NOT LIKE 'ext:%' AND user_id NOT LIKE 'guest:%'").Find(&existingUsers).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	deptRows, deptRemoved := diffDepartments(report, existingDepts, depts, memberCount)
+	newUsers, changedUsers := diffUsers(report, existingUsers, members, deptNames, now)
+
+	active := 0
+	for _, u := range existingUsers {
+		if !u.Disabled {
+			active++
+		}
+	}
+	if !force && active > 0 && float64(len(report.UsersDisabled)) > float64(active)*orgSyncMaxDisableRatio {
+		return report, fmt.Errorf("sync would disable %d of %d active members; rerun with force if that is expected",
+			len(report.UsersDisabled), active)
+	}
+
+	if !dryRun {
+		err := l.ctx.DB.Transaction(func(tx *gorm.DB) error {
+			for i := range deptRows {
+				if err := tx.Save(&deptRows[i]).Error; err != nil {
+					return err
+				}
+			}
+			if len(deptRemoved) > 0 {
+				if err := tx.Delete(&model.Department{}, deptRemoved).Error; err != nil {
+					return err
+				}
+			}
+			for i := range newUsers {
+				if err := tx.Create(&newUsers[i]).Error; err != nil {
+					return err
+				}
+			}
+			for i := range changedUsers {
+				// Struct update so the JSON serializer on Department applies
+				if err := tx.Model(&changedUsers[i]).
+					Select("name", "department", "position", "avatar", "disabled", "profile_synced_at").
+					Updates(&changedUsers[i]).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// People who left shouldn't keep a session until it expires
+		sessions := NewSessionLogic(l.ctx)
+		for _, id := range report.UsersDisabled {
+			if _, err := sessions.RevokeUser(id); err != nil {
+				log.Printf("OrgSync: revoke sessions of %s: %v", id, err)
+			}
+		}
+
+		// Warm the cache Login uses to resolve department names
+		for id, name := range deptNames {
+			l.ctx.Redis.Set(context.Background(), fmt.Sprintf("wecom:dept:%s:%d", client.CorpID, id), name, 24*time.Hour)
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// diffDepartments returns the rows to save and the ids to delete
+func diffDepartments(report *OrgSyncReport, existing []model.Department, depts []WeComDepartment, memberCount map[int]int) ([]model.Department, []int) {
+	old := make(map[int]model.Department, len(existing))
+	for _, d := range existing {
+		old[d.ID] = d
+	}
+
+	var rows []model.Department
+	seen := make(map[int]bool, len(depts))
+	for _, d := range depts {
+		seen[d.ID] = true
+		row, ok := old[d.ID]
+		switch {
+		case !ok:
+			report.DepartmentsAdded = append(report.DepartmentsAdded, fmt.Sprintf("%d %s", d.ID, d.Name))
+		case row.Name != d.Name || row.ParentID != d.ParentID:
+			report.DepartmentsChanged = append(report.DepartmentsChanged, fmt.Sprintf("%d %s -> %s", d.ID, row.Name, d.Name))
+		}
+		row.ID, row.Name, row.ParentID, row.SortOrder = d.ID, d.Name, d.ParentID, d.Order
+		row.MemberCount = memberCount[d.ID]
+		rows = append(rows, row)
+	}
+
+	var removed []int
+	for _, d := range existing {
+		if !seen[d.ID] {
+			removed = append(removed, d.ID)
+			report.DepartmentsRemoved = append(report.DepartmentsRemoved, fmt.Sprintf("%d %s", d.ID, d.Name))
+		}
+	}
+	return rows, removed
+}
+
+// diffUsers returns users to create and users whose profile or status changed.
+// Members missing from the directory are disabled, never deleted: their draw
+// records and scores stay.
+func diffUsers(report *OrgSyncReport, existing []model.User, members map[string]WeComUser, deptNames map[int]string, now time.Time) ([]model.User, []model.User) {
+	known := make(map[string]bool, len(existing))
+	var changed []model.User
+
+	for _, u := range existing {
+		known[u.UserID] = true
+		m, ok := members[u.UserID]
+		if !ok {
+			if !u.Disabled {
+				u.Disabled = true
+				report.UsersDisabled = append(report.UsersDisabled, u.UserID)
+				changed = append(changed, u)
+			}
+			continue
+		}
+
+		depts := departmentRefs(m.Department, deptNames)
+		disabled := m.Inactive()
+		profileChanged := u.Name != m.Name || u.Position != m.Position ||
+			u.Department.Names() != depts.Names() || (m.Avatar != "" && u.Avatar != m.Avatar)
+
+		switch {
+		case disabled && !u.Disabled:
+			report.UsersDisabled = append(report.UsersDisabled, u.UserID)
+		case !disabled && u.Disabled:
+			report.UsersEnabled = append(report.UsersEnabled, u.UserID)
+		case profileChanged:
+			report.UsersUpdated = append(report.UsersUpdated, u.UserID)
+		default:
+			continue
+		}
+
+		if m.Name != "" {
+			u.Name = m.Name
+		}
+		u.Department = depts
+		u.Position = m.Position
+		if m.Avatar != "" {
+			u.Avatar = m.Avatar
+		}
+		u.Disabled = disabled
+		u.ProfileSyncedAt = &now
+		changed = append(changed, u)
+	}
+
+	var added []model.User
+	for _, id := range sortedKeys(members) {
+		if known[id] {
+			continue
+		}
+		m := members[id]
+		name := m.Name
+		if name == "" {
+			name = m.UserID
+		}
+		added = append(added, model.User{
+			UserID:          m.UserID,
+			Name:            name,
+			Department:      departmentRefs(m.Department, deptNames),
+			Position:        m.Position,
+			Avatar:          m.Avatar,
+			Disabled:        m.Inactive(),
+			ProfileSyncedAt: &now,
+		})
+		report.UsersAdded = append(report.UsersAdded, m.UserID)
+	}
+	return added, changed
+}
+
+func departmentRefs(ids []int, names map[int]string) model.Departments {
+	refs := make(model.Departments, 0, len(ids))
+	for _, id := range ids {
+		refs = append(refs, model.DepartmentRef{ID: id, Name: names[id]})
+	}
+	return refs
+}
+
+func sortedKeys(m map[string]WeComUser) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (l *OrgSyncLogic) ListDepartments() ([]model.Department, error) {
+	var list []model.Department
+	err := l.ctx.DB.Order("parent_id asc, sort_order asc, id asc").Find(&list).Error
+	return list, err
+}
@@ -0,0 +1,92 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffUsers(t *testing.T) {
+	names := map[int]string{2: "研发部", 3: "产品部"}
+	existing := []model.User{
+		{UserID: "zhangsan", Name: "张三", Department: model.Departments{{ID: 2, Name: "研发部"}}},
+		{UserID: "lisi", Name: "lisi"}, // Placeholder profile from an early login
+		{UserID: "gone", Name: "离职员工"},
+		{UserID: "back", Name: "回归员工", Disabled: true},
+	}
+	members := map[string]WeComUser{
+		"zhangsan": {UserID: "zhangsan", Name: "张三", Department: []int{2}, Status: WeComUserActive},
+		"lisi":     {UserID: "lisi", Name: "李四", Department: []int{2, 3}, Status: WeComUserActive},
+		"back":     {UserID: "back", Name: "回归员工", Status: WeComUserActive},
+		"wangwu":   {UserID: "wangwu", Name: "王五", Department: []int{3}, Status: WeComUserActive},
+		"zhaoliu":  {UserID: "zhaoliu", Name: "赵六", Status: WeComUserResigned},
+	}
+
+	report := &OrgSyncReport{}
+	added, changed := diffUsers(report, existing, members, names, time.Now())
+
+	check := func(name string, got, want []string) {
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+	check("added", report.UsersAdded, []string{"wangwu", "zhaoliu"})
+	check("updated", report.UsersUpdated, []string{"lisi"})
+	check("disabled", report.UsersDisabled, []string{"gone"})
+	check("enabled", report.UsersEnabled, []string{"back"})
+
+	if len(added) != 2 || !added[1].Disabled {
+		t.Fatalf("resigned member should be added disabled: %+v", added)
+	}
+	if len(changed) != 3 {
+		t.Fatalf("changed = %d, want 3", len(changed))
+	}
+	if got := changed[0].Department.Names(); got != "研发部/产品部" {
+		t.Errorf("lisi departments = %q", got)
+	}
+}
+
+func TestDiffDepartments(t *testing.T) {
+	existing := []model.Department{{ID: 1, Name: "神州云服"}, {ID: 2, Name: "技术部", ParentID: 1}, {ID: 9, Name: "旧部门"}}
+	depts := []WeComDepartment{{ID: 1, Name: "神州云服"}, {ID: 2, Name: "研发部", ParentID: 1}, {ID: 3, Name: "产品部", ParentID: 1}}
+
+	report := &OrgSyncReport{}
+	rows, removed := diffDepartments(report, existing, depts, map[int]int{2: 5})
+	if len(rows) != 3 || rows[1].MemberCount != 5 {
+		t.Fatalf("rows = %+v", rows)
+	}
+	if !reflect.DeepEqual(removed, []int{9}) {
+		t.Errorf("removed = %v", removed)
+	}
+	if len(report.DepartmentsAdded) != 1 || len(report.DepartmentsChanged) != 1 || len(report.DepartmentsRemoved) != 1 {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestOrgSyncNeedsLock(t *testing.T) {
+	// Without the lock store a sync must not run unguarded
+	l := NewOrgSyncLogic(&svc.ServiceContext{Redis: downRedis(t)})
+	if _, err := l.Sync(false, false); err == nil || errors.Is(err, ErrOrgSyncRunning) {
+		t.Errorf("err = %v, want a lock error", err)
+	}
+}
+
+func TestOrgSyncFailsFastWhileRunning(t *testing.T) {
+	ctx := testRedis(t)
+	rctx := context.Background()
+	if err := ctx.Redis.Set(rctx, orgSyncLockKey, "scheduled", orgSyncLockTTL).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The lock is checked before WeCom or the database are touched
+	if _, err := NewOrgSyncLogic(ctx).Sync(false, true); !errors.Is(err, ErrOrgSyncRunning) {
+		t.Errorf("err = %v, want ErrOrgSyncRunning", err)
+	}
+	if owner, _ := ctx.Redis.Get(rctx, orgSyncLockKey).Result(); owner != "scheduled" {
+		t.Errorf("lock owner = %q, the running sync lost its lock", owner)
+	}
+}
@@ -0,0 +1,97 @@
+package logic
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort")
+)
+
+// pageCursor is the position after the last row of a page: that row's sort
+// value and id. Handing out the value rather than an offset keeps pages
+// stable while draws are being inserted, and each page is an index range
+// scan instead of a growing OFFSET.
+type pageCursor struct {
+	Sort string  `json:"k"`
+	Asc  bool    `json:"a,omitempty"`
+	N    int64   `json:"n,omitempty"` // Numeric sort value
+	S    *string `json:"s,omitempty"` // String sort value
+	ID   int64   `json:"id"`
+}
+
+func (c pageCursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodePageCursor rejects cursors from a list sorted another way
+func decodePageCursor(s, sort string, asc bool) (pageCursor, error) {
+	var c pageCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(raw, &c) != nil || c.ID <= 0 {
+		return c, ErrInvalidCursor
+	}
+	if c.Sort != sort || c.Asc != asc {
+		return c, fmt.Errorf("%w: it belongs to a different sort order", ErrInvalidCursor)
+	}
+	return c, nil
+}
+
+func (c pageCursor) value() interface{} {
+	if c.S != nil {
+		return *c.S
+	}
+	return c.N
+}
+
+// where keeps the rows after the cursor. column "" pages by id alone.
+func (c pageCursor) where(q *gorm.DB, column, idColumn string, asc bool) *gorm.DB {
+	op := "<"
+	if asc {
+		op = ">"
+	}
+	if column == "" {
+		return q.Where(idColumn+" "+op+" ?", c.ID)
+	}
+	return q.Where("("+column+" "+op+" ? OR ("+column+" = ? AND "+idColumn+" "+op+" ?))", c.value(), c.value(), c.ID)
+}
+
+// orderPage orders by the sort column with id as the tie breaker
+func orderPage(q *gorm.DB, column, idColumn string, asc bool) *gorm.DB {
+	dir := " desc"
+	if asc {
+		dir = " asc"
+	}
+	if column != "" {
+		q = q.Order(column + dir)
+	}
+	return q.Order(idColumn + dir)
+}
+
+func pageLimit(n int) int {
+	if n <= 0 {
+		return defaultPageSize
+	}
+	if n > maxPageSize {
+		return maxPageSize
+	}
+	return n
+}
+
+// escapeLike makes s match literally inside a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,57 @@
+package logic
+
+import (
+	"errors"
+	"happynewyear/internal/svc"
+	"testing"
+)
+
+func TestPageCursorRoundTrip(t *testing.T) {
+	name := "张三"
+	for _, want := range []pageCursor{
+		{Sort: UserSortScore, N: 420, ID: 17},
+		{Sort: UserSortName, Asc: true, S: &name, ID: 3},
+		{Sort: "id", ID: 99},
+	} {
+		got, err := decodePageCursor(want.encode(), want.Sort, want.Asc)
+		if err != nil {
+			t.Fatalf("decode %+v: %v", want, err)
+		}
+		if got.value() != want.value() || got.ID != want.ID {
+			t.Errorf("round trip: got %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestPageCursorRejects(t *testing.T) {
+	cur := pageCursor{Sort: UserSortScore, N: 10, ID: 5}.encode()
+	if _, err := decodePageCursor(cur, UserSortChances, false); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("other sort: err = %v", err)
+	}
+	if _, err := decodePageCursor(cur, UserSortScore, true); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("other direction: err = %v", err)
+	}
+	for _, bad := range []string{"not-base64!", "e30", pageCursor{Sort: "id"}.encode()} {
+		if _, err := decodePageCursor(bad, "id", false); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestListUsersRejectsUnknownSort(t *testing.T) {
+	_, _, err := NewAdminLogic(&svc.ServiceContext{}).ListUsers(UserFilter{Sort: "salary"})
+	if !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestPageLimitAndEscapeLike(t *testing.T) {
+	for in, want := range map[int]int{0: defaultPageSize, -1: defaultPageSize, 20: 20, 10000: maxPageSize} {
+		if got := pageLimit(in); got != want {
+			t.Errorf("pageLimit(%d) = %d, want %d", in, got, want)
+		}
+	}
+	if got := escapeLike(`100%_a\b`); got != `100\%\_a\\b` {
+		t.Errorf("escapeLike = %q", got)
+	}
+}
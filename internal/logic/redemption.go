@@ -0,0 +1,112 @@
+package logic
+
+import (
+	"errors"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRedemptionCode  = errors.New("unknown redemption code")
+	ErrNotRedeemable   = errors.New("this prize is not collected offline")
+	ErrAlreadyRedeemed = errors.New("this prize has already been handed out")
+	ErrDrawVoided      = errors.New("this draw was voided by a reset")
+)
+
+// Redemption is what the prize desk sees for a code
+type Redemption struct {
+	Code       string                 `json:"code"`
+	DrawRecord model.DrawRecord       `json:"draw_record"`
+	Name       string                 `json:"name"`
+	Department string                 `json:"department"`
+	Redeemed   *model.PrizeRedemption `json:"redeemed"` // nil until handed out
+	Voided     *model.VoidedDraw      `json:"voided"`   // Set for test users' draws; not redeemable
+}
+
+type RedemptionLogic struct {
+	ctx *svc.ServiceContext
+}
+
+func NewRedemptionLogic(ctx *svc.ServiceContext) *RedemptionLogic {
+	return &RedemptionLogic{ctx: ctx}
+}
+
+// Lookup finds the draw behind a code shown by a winner
+func (l *RedemptionLogic) Lookup(code string) (*Redemption, error) {
+	return l.lookup(l.ctx.DB, code)
+}
+
+func (l *RedemptionLogic) lookup(db *gorm.DB, code string) (*Redemption, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	idPart, secret, ok := strings.Cut(code, "-")
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if !ok || err != nil || secret == "" {
+		return nil, ErrRedemptionCode
+	}
+
+	var record model.DrawRecord
+	if err := db.Where("id = ? AND redeem_secret = ?", id, secret).First(&record).Error; err != nil {
+		return nil, ErrRedemptionCode
+	}
+	var award model.Award
+	if err := db.First(&award, record.AwardID).Error; err != nil {
+		return nil, err
+	}
+	kind, _ := AwardKindOf(award.Type)
+	if r, ok := kind.(Redeemable); !ok || !r.Redeemable() {
+		return nil, ErrNotRedeemable
+	}
+
+	result := &Redemption{Code: code, DrawRecord: record}
+	var user model.User
+	if err := db.Where("user_id = ?", record.UserID).First(&user).Error; err == nil {
+		result.Name, result.Department = user.Name, user.Department.Names()
+	}
+	var redeemed model.PrizeRedemption
+	if err := db.Where("draw_record_id = ?", record.ID).First(&redeemed).Error; err == nil {
+		result.Redeemed = &redeemed
+	}
+	var voided model.VoidedDraw
+	if err := db.Where("draw_record_id = ?", record.ID).First(&voided).Error; err == nil {
+		result.Voided = &voided
+	}
+	return result, nil
+}
+
+// Redeem records that the prize behind code was handed out by admin
+func (l *RedemptionLogic) Redeem(code, admin, note string) (*Redemption, error) {
+	var result *Redemption
+	err := l.ctx.DB.Transaction(func(tx *gorm.DB) error {
+		r, err := l.lookup(tx, code)
+		if err != nil {
+			return err
+		}
+		if r.Voided != nil {
+			return ErrDrawVoided
+		}
+		row := model.PrizeRedemption{
+			DrawRecordID: r.DrawRecord.ID,
+			UserID:       r.DrawRecord.UserID,
+			AwardName:    r.DrawRecord.AwardName,
+			RedeemedBy:   admin,
+			Note:         note,
+		}
+		// The unique draw_record_id decides between two desks scanning the same code
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&row)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrAlreadyRedeemed
+		}
+		r.Redeemed = &row
+		result = r
+		return nil
+	})
+	return result, err
+}
@@ -1,6 +1,7 @@
 package logic
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -36,3 +37,10 @@ func CheckAndSetNonce(ctx *svc.ServiceContext, nonce string, userID string) bool
 func GenerateNonce() string {
 	return fmt.Sprintf("%d", time.Now().UnixNano()) // Simple nonce for MVP
 }
+
+// randomHex returns n random bytes hex encoded, for values that must not be guessable
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
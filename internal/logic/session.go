@@ -0,0 +1,342 @@
+package logic
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Session cookies. The access and refresh cookies are HttpOnly; the CSRF
+// cookie is readable by the SPA so it can echo the value in X-CSRF-Token.
+const (
+	SessionCookie = "hny_session"
+	RefreshCookie = "hny_refresh"
+	CSRFCookie    = "hny_csrf"
+	CSRFHeader    = "X-CSRF-Token"
+
+	// The admin console has its own pair, so signing in there doesn't
+	// replace the player session in the same browser
+	AdminSessionCookie = "hny_admin"
+	AdminCSRFCookie    = "hny_admin_csrf"
+
+	// RefreshPath is the only path the refresh cookie is sent to
+	RefreshPath = "/api/user/refresh"
+
+	defaultAccessTTL  = 15 * time.Minute
+	defaultSessionTTL = 24 * time.Hour
+
+	defaultAdminSessionTTL = 8 * time.Hour
+	// Two tabs refreshing at once both present the same token; the loser
+	// gets ErrRefreshRaced instead of tripping reuse detection
+	refreshGrace = 30 * time.Second
+)
+
+var (
+	ErrSessionRevoked = errors.New("session has been revoked or expired")
+	ErrSessionDevice  = errors.New("session belongs to another device")
+	ErrRefreshReuse   = errors.New("refresh token reused")
+	ErrRefreshRaced   = errors.New("refresh token was just rotated")
+	ErrSessionStore   = errors.New("session store unavailable")
+)
+
+// rotateRefreshScript swaps the current refresh hash for a new one. It
+// returns "raced" for the previous token within the grace period, and
+// "reuse" for anything else that doesn't match.
+var rotateRefreshScript = redis.NewScript(`
+local cur = redis.call("HGET", KEYS[1], "refresh")
+if not cur then
+	return "missing"
+end
+if cur == ARGV[1] then
+	redis.call("HSET", KEYS[1], "refresh", ARGV[2], "prev", cur, "rotated_at", ARGV[3])
+	return "ok"
+end
+local prev = redis.call("HGET", KEYS[1], "prev")
+local rotated = tonumber(redis.call("HGET", KEYS[1], "rotated_at") or "0")
+if prev == ARGV[1] and tonumber(ARGV[3]) - rotated <= tonumber(ARGV[4]) then
+	return "raced"
+end
+return "reuse"`)
+
+// DeviceFingerprint hashes the User-Agent with version numbers removed, so a
+// session stays bound to the browser/device but survives a WeCom auto-update.
+func DeviceFingerprint(userAgent string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(userAgent) {
+		if unicode.IsDigit(r) || r == '.' || r == '_' {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Session is what a login or refresh hands to the client
+type Session struct {
+	ID               string
+	Token            string // Short-lived access JWT
+	RefreshToken     string // "<session id>.<secret>", single use
+	CSRF             string
+	ExpiresAt        time.Time // Access token
+	RefreshExpiresAt time.Time
+}
+
+// SessionLogic keeps sessions in Redis:
+//
+//	session:<sid>        hash of uid, name, fp, csrf and the current refresh hash
+//	user_sessions:<uid>  set of the user's session ids
+//	revoked:session:<sid>, revoked:user:<uid>
+//	                     revocation list for access tokens still in flight
+type SessionLogic struct {
+	ctx *svc.ServiceContext
+}
+
+func NewSessionLogic(ctx *svc.ServiceContext) *SessionLogic {
+	return &SessionLogic{ctx: ctx}
+}
+
+func (l *SessionLogic) accessTTL() time.Duration {
+	if m := l.ctx.Config.Auth.AccessMinutes; m > 0 {
+		return time.Duration(m) * time.Minute
+	}
+	return defaultAccessTTL
+}
+
+func (l *SessionLogic) sessionTTL() time.Duration {
+	if h := l.ctx.Config.Auth.SessionHours; h > 0 {
+		return time.Duration(h) * time.Hour
+	}
+	return defaultSessionTTL
+}
+
+func (l *SessionLogic) adminSessionTTL() time.Duration {
+	if h := l.ctx.Config.Auth.AdminSessionHours; h > 0 {
+		return time.Duration(h) * time.Hour
+	}
+	return defaultAdminSessionTTL
+}
+
+// revocationTTL keeps revocation markers as long as any access token could
+// have been issued for: admin console tokens live for the whole session.
+func (l *SessionLogic) revocationTTL() time.Duration {
+	ttl := l.accessTTL()
+	if a := l.adminSessionTTL(); a > ttl {
+		ttl = a
+	}
+	return ttl
+}
+
+// Create starts a session bound to userAgent
+func (l *SessionLogic) Create(userID, name, userAgent string) (*Session, error) {
+	return l.create(userID, name, userAgent, l.accessTTL(), l.sessionTTL())
+}
+
+// CreateAdmin starts an admin console session. It has no refresh cookie: the
+// one token lives as long as the session, and revocation still applies.
+func (l *SessionLogic) CreateAdmin(account *model.AdminAccount, userAgent string) (*Session, error) {
+	ttl := l.adminSessionTTL()
+	return l.create(AdminSubject(account.ID), account.Username, userAgent, ttl, ttl)
+}
+
+func (l *SessionLogic) create(userID, name, userAgent string, accessTTL, ttl time.Duration) (*Session, error) {
+	rctx := context.Background()
+	sid := randomHex(16)
+	secret := randomHex(32)
+	csrf := randomHex(16)
+	now := time.Now()
+
+	pipe := l.ctx.Redis.TxPipeline()
+	pipe.HSet(rctx, sessionKey(sid), map[string]interface{}{
+		"uid":        userID,
+		"name":       name,
+		"fp":         DeviceFingerprint(userAgent),
+		"csrf":       csrf,
+		"refresh":    hashSecret(secret),
+		"created_at": now.Unix(),
+		"created_ms": now.UnixMilli(),
+	})
+	pipe.Expire(rctx, sessionKey(sid), ttl)
+	pipe.SAdd(rctx, userSessionsKey(userID), sid)
+	pipe.Expire(rctx, userSessionsKey(userID), ttl)
+	if _, err := pipe.Exec(rctx); err != nil {
+		return nil, fmt.Errorf("create session: %v", err)
+	}
+
+	s := &Session{ID: sid, RefreshToken: sid + "." + secret, CSRF: csrf, RefreshExpiresAt: now.Add(ttl)}
+	return s, l.issueAccess(s, userID, name, userAgent, accessTTL)
+}
+
+func (l *SessionLogic) issueAccess(s *Session, userID, name, userAgent string, ttl time.Duration) error {
+	key, err := l.ctx.JWTKeys.Signing(time.Now())
+	if err != nil {
+		return err
+	}
+	token, err := GenerateToken(key, Claims{
+		UserID:      userID,
+		Name:        name,
+		SessionID:   s.ID,
+		Fingerprint: DeviceFingerprint(userAgent),
+		CSRF:        s.CSRF,
+	}, ttl)
+	if err != nil {
+		return err
+	}
+	s.Token = token
+	s.ExpiresAt = time.Now().Add(ttl)
+	return nil
+}
+
+// Refresh rotates the refresh token and issues a new access token. A token
+// that was already rotated away, or one replayed from another device, revokes
+// the whole session. Cookie callers must pass the session's CSRF token.
+func (l *SessionLogic) Refresh(refreshToken, userAgent, csrf string, checkCSRF bool) (*Session, error) {
+	rctx := context.Background()
+	sid, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || sid == "" || secret == "" {
+		return nil, ErrSessionRevoked
+	}
+
+	fields, err := l.ctx.Redis.HGetAll(rctx, sessionKey(sid)).Result()
+	if err != nil {
+		return nil, ErrSessionStore
+	}
+	if len(fields) == 0 {
+		return nil, ErrSessionRevoked
+	}
+	if checkCSRF && subtle.ConstantTimeCompare([]byte(csrf), []byte(fields["csrf"])) != 1 {
+		return nil, ErrSessionRevoked
+	}
+	if fields["fp"] != DeviceFingerprint(userAgent) {
+		// A refresh cookie replayed from somewhere else: assume it leaked
+		log.Printf("Session %s of %s refreshed from another device; revoking", sid, fields["uid"])
+		l.Revoke(sid)
+		return nil, ErrSessionDevice
+	}
+
+	newSecret := randomHex(32)
+	res, err := rotateRefreshScript.Run(rctx, l.ctx.Redis, []string{sessionKey(sid)},
+		hashSecret(secret), hashSecret(newSecret), time.Now().Unix(), int(refreshGrace.Seconds())).Text()
+	if err != nil {
+		return nil, ErrSessionStore
+	}
+	switch res {
+	case "ok":
+	case "raced":
+		return nil, ErrRefreshRaced
+	case "reuse":
+		log.Printf("Refresh token reuse on session %s of %s; revoking", sid, fields["uid"])
+		l.Revoke(sid)
+		return nil, ErrRefreshReuse
+	default:
+		return nil, ErrSessionRevoked
+	}
+
+	createdAt, _ := strconv.ParseInt(fields["created_at"], 10, 64)
+	s := &Session{
+		ID:               sid,
+		RefreshToken:     sid + "." + newSecret,
+		CSRF:             fields["csrf"],
+		RefreshExpiresAt: time.Unix(createdAt, 0).Add(l.sessionTTL()),
+	}
+	return s, l.issueAccess(s, fields["uid"], fields["name"], userAgent, l.accessTTL())
+}
+
+// CheckAccess rejects access tokens whose session is gone (logout, expiry,
+// revocation) or whose user was revoked after the session started.
+func (l *SessionLogic) CheckAccess(claims *Claims) error {
+	if claims.SessionID == "" {
+		return ErrSessionRevoked
+	}
+	rctx := context.Background()
+	pipe := l.ctx.Redis.Pipeline()
+	fields := pipe.HMGet(rctx, sessionKey(claims.SessionID), "uid", "created_ms", "created_at")
+	markers := pipe.MGet(rctx, revokedSessionKey(claims.SessionID), revokedUserKey(claims.UserID))
+	if _, err := pipe.Exec(rctx); err != nil && !errors.Is(err, redis.Nil) {
+		return ErrSessionStore
+	}
+	// The session hash is the source of truth; the markers only cover the
+	// moment between a revocation and the hash being deleted
+	session := fields.Val()
+	if stringVal(session[0]) != claims.UserID {
+		return ErrSessionRevoked
+	}
+	vals := markers.Val()
+	if vals[0] != nil {
+		return ErrSessionRevoked
+	}
+	if s, ok := vals[1].(string); ok {
+		revokedMs, _ := strconv.ParseInt(s, 10, 64)
+		if sessionCreatedMs(stringVal(session[1]), stringVal(session[2])) <= revokedMs {
+			return ErrSessionRevoked
+		}
+	}
+	return nil
+}
+
+// sessionCreatedMs reads a session's start in milliseconds. Sessions from
+// before created_ms only have seconds; those round down, so a session started
+// in the same second as a user revocation counts as revoked.
+func sessionCreatedMs(ms, secs string) int64 {
+	if n, err := strconv.ParseInt(ms, 10, 64); err == nil {
+		return n
+	}
+	n, _ := strconv.ParseInt(secs, 10, 64)
+	return n * 1000
+}
+
+// Revoke ends one session (logout)
+func (l *SessionLogic) Revoke(sid string) error {
+	rctx := context.Background()
+	uid, _ := l.ctx.Redis.HGet(rctx, sessionKey(sid), "uid").Result()
+
+	pipe := l.ctx.Redis.TxPipeline()
+	pipe.Set(rctx, revokedSessionKey(sid), "1", l.revocationTTL())
+	pipe.Del(rctx, sessionKey(sid))
+	if uid != "" {
+		pipe.SRem(rctx, userSessionsKey(uid), sid)
+	}
+	_, err := pipe.Exec(rctx)
+	return err
+}
+
+// RevokeUser ends every session of userID: "log out everywhere" and the
+// admin kill switch. Access tokens already issued stop working at once.
+func (l *SessionLogic) RevokeUser(userID string) (int, error) {
+	rctx := context.Background()
+	sids, err := l.ctx.Redis.SMembers(rctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	pipe := l.ctx.Redis.TxPipeline()
+	pipe.Set(rctx, revokedUserKey(userID), time.Now().UnixMilli(), l.revocationTTL())
+	for _, sid := range sids {
+		pipe.Del(rctx, sessionKey(sid))
+	}
+	pipe.Del(rctx, userSessionsKey(userID))
+	_, err = pipe.Exec(rctx)
+	return len(sids), err
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func sessionKey(sid string) string        { return "session:" + sid }
+func userSessionsKey(uid string) string   { return "user_sessions:" + uid }
+func revokedSessionKey(sid string) string { return "revoked:session:" + sid }
+func revokedUserKey(userID string) string { return "revoked:user:" + userID } // Unix milliseconds
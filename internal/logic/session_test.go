@@ -0,0 +1,174 @@
+package logic
+
+import (
+	"context"
+	"happynewyear/internal/svc"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// testRedis returns a service context on the Redis at TEST_REDIS_ADDR, using
+// DB 15 and flushing it first. Tests that need Redis skip without it.
+func testRedis(t *testing.T) *svc.ServiceContext {
+	t.Helper()
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("TEST_REDIS_ADDR not set")
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr, DB: 15})
+	if err := rdb.FlushDB(context.Background()).Err(); err != nil {
+		t.Fatalf("redis: %v", err)
+	}
+	t.Cleanup(func() { rdb.Close() })
+	return &svc.ServiceContext{Redis: rdb}
+}
+
+// putSession writes a session hash the way create does, without signing a token
+func putSession(t *testing.T, ctx *svc.ServiceContext, sid, uid string) {
+	t.Helper()
+	rctx := context.Background()
+	now := time.Now()
+	if err := ctx.Redis.HSet(rctx, sessionKey(sid), "uid", uid, "created_at", now.Unix(), "created_ms", now.UnixMilli()).Err(); err != nil {
+		t.Fatal(err)
+	}
+	ctx.Redis.SAdd(rctx, userSessionsKey(uid), sid)
+}
+
+func TestDeviceFingerprint(t *testing.T) {
+	v1 := "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148 wxwork/4.1.10 MicroMessenger/7.0.1"
+	v2 := "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) Mobile/15E148 wxwork/4.1.16 MicroMessenger/7.0.1"
+	desktop := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) wxwork/4.1.16 Chrome/120.0"
+
+	if DeviceFingerprint(v1) != DeviceFingerprint(v2) {
+		t.Error("an app or OS update should keep the fingerprint")
+	}
+	if DeviceFingerprint(v1) == DeviceFingerprint(desktop) {
+		t.Error("phone and desktop should differ")
+	}
+	if len(DeviceFingerprint("")) != 32 {
+		t.Error("fingerprint should be 16 bytes hex")
+	}
+}
+
+func TestSessionRejectsMalformedTokens(t *testing.T) {
+	l := &SessionLogic{}
+
+	// Tokens from before server-side sessions carry no session id
+	if err := l.CheckAccess(&Claims{UserID: "zhangsan"}); err != ErrSessionRevoked {
+		t.Errorf("claims without sid: got %v", err)
+	}
+	for _, tok := range []string{"", "nodot", ".secret", "sid."} {
+		if _, err := l.Refresh(tok, "ua", "", false); err != ErrSessionRevoked {
+			t.Errorf("refresh %q: got %v", tok, err)
+		}
+	}
+}
+
+func TestHashSecret(t *testing.T) {
+	if hashSecret("a") == hashSecret("b") || len(hashSecret("a")) != 64 {
+		t.Error("refresh secrets should be stored as distinct sha256 hex")
+	}
+}
+
+func TestCheckAccessRequiresLiveSession(t *testing.T) {
+	ctx := testRedis(t)
+	l := NewSessionLogic(ctx)
+	uid := AdminSubject(1)
+	putSession(t, ctx, "s1", uid)
+	claims := &Claims{UserID: uid, SessionID: "s1"}
+
+	if err := l.CheckAccess(claims); err != nil {
+		t.Fatalf("live session: %v", err)
+	}
+	if err := l.CheckAccess(&Claims{UserID: "someone-else", SessionID: "s1"}); err != ErrSessionRevoked {
+		t.Errorf("session of another user: got %v", err)
+	}
+
+	if err := l.Revoke("s1"); err != nil {
+		t.Fatal(err)
+	}
+	ttl := ctx.Redis.TTL(context.Background(), revokedSessionKey("s1")).Val()
+	if ttl < defaultAdminSessionTTL-time.Minute {
+		t.Errorf("revocation marker ttl %v is shorter than an admin token", ttl)
+	}
+
+	// An admin token outlives the access TTL; once the marker is gone the
+	// missing session hash must still reject it
+	ctx.Redis.Del(context.Background(), revokedSessionKey("s1"))
+	if err := l.CheckAccess(claims); err != ErrSessionRevoked {
+		t.Errorf("revoked session after marker expiry: got %v", err)
+	}
+}
+
+func TestSessionCreatedMs(t *testing.T) {
+	if got := sessionCreatedMs("1767225600123", "1767225600"); got != 1767225600123 {
+		t.Errorf("created_ms: got %d", got)
+	}
+	if got := sessionCreatedMs("", "1767225600"); got != 1767225600000 {
+		t.Errorf("seconds-only session: got %d", got)
+	}
+}
+
+func TestRevokeUserKeepsLaterSessions(t *testing.T) {
+	ctx := testRedis(t)
+	l := NewSessionLogic(ctx)
+	rctx := context.Background()
+	putSession(t, ctx, "old", "zhangsan")
+
+	if n, err := l.RevokeUser("zhangsan"); err != nil || n != 1 {
+		t.Fatalf("revoke user: %d, %v", n, err)
+	}
+	revokedMs, _ := ctx.Redis.Get(rctx, revokedUserKey("zhangsan")).Int64()
+
+	// A session that raced the revocation within the same second is still
+	// cut off; one created a millisecond later is not
+	ctx.Redis.HSet(rctx, sessionKey("raced"), "uid", "zhangsan", "created_ms", revokedMs)
+	ctx.Redis.HSet(rctx, sessionKey("fresh"), "uid", "zhangsan", "created_ms", revokedMs+1)
+	if err := l.CheckAccess(&Claims{UserID: "zhangsan", SessionID: "raced"}); err != ErrSessionRevoked {
+		t.Errorf("session created at revocation: got %v", err)
+	}
+	if err := l.CheckAccess(&Claims{UserID: "zhangsan", SessionID: "fresh"}); err != nil {
+		t.Errorf("session created after revocation: got %v", err)
+	}
+}
+
+func TestRotateRefreshScript(t *testing.T) {
+	ctx := testRedis(t)
+	rctx := context.Background()
+	key := sessionKey("s1")
+	ctx.Redis.HSet(rctx, key, "uid", "zhangsan", "refresh", "h1")
+	grace := int(refreshGrace.Seconds())
+	rotate := func(presented, next string, now int64) string {
+		t.Helper()
+		res, err := rotateRefreshScript.Run(rctx, ctx.Redis, []string{key}, presented, next, now, grace).Text()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	if res := rotate("h1", "h2", 1000); res != "ok" {
+		t.Fatalf("current token: %s", res)
+	}
+	if cur := ctx.Redis.HGet(rctx, key, "refresh").Val(); cur != "h2" {
+		t.Errorf("refresh not swapped: %s", cur)
+	}
+	if res := rotate("h1", "h3", 1000+int64(grace)); res != "raced" {
+		t.Errorf("previous token within grace: %s", res)
+	}
+	if res := rotate("h1", "h3", 1001+int64(grace)); res != "reuse" {
+		t.Errorf("previous token after grace: %s", res)
+	}
+	if res := rotate("forged", "h3", 1000); res != "reuse" {
+		t.Errorf("unknown token: %s", res)
+	}
+	if cur := ctx.Redis.HGet(rctx, key, "refresh").Val(); cur != "h2" {
+		t.Errorf("failed rotation changed the token: %s", cur)
+	}
+	if res, err := rotateRefreshScript.Run(rctx, ctx.Redis, []string{sessionKey("gone")}, "h1", "h2", 1000, grace).Text(); err != nil || res != "missing" {
+		t.Errorf("missing session: %s, %v", res, err)
+	}
+}
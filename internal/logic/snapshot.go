@@ -0,0 +1,410 @@
+package logic
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SnapshotFormatVersion is written in the header line of every snapshot
+const SnapshotFormatVersion = 1
+
+const defaultSnapshotDir = "snapshots"
+
+var (
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	ErrSnapshotCorrupt  = errors.New("snapshot file does not match its checksum")
+)
+
+// snapshotTables are the tables a snapshot holds. Users and awards are
+// restored in place (scores, chances, stock); the rest are replaced row for
+// row.
+var snapshotTables = []string{"users", "awards", "game_records", "draw_records", "draw_checkpoints", "prize_redemptions", "voided_draws", "balance_adjustments"}
+
+// SnapshotHeader is the first line of a snapshot file
+type SnapshotHeader struct {
+	FormatVersion int       `json:"format_version"`
+	Reason        string    `json:"reason"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// SnapshotLine is every other line: one row of one table
+type SnapshotLine struct {
+	Table string          `json:"table"`
+	Row   json.RawMessage `json:"row"`
+}
+
+// snapshotRow is the writing side of SnapshotLine
+type snapshotRow struct {
+	Table string      `json:"table"`
+	Row   interface{} `json:"row"`
+}
+
+// SnapshotContents is a decoded snapshot
+type SnapshotContents struct {
+	Header      SnapshotHeader
+	Users       []model.User
+	Awards      []model.Award
+	Games       []model.GameRecord
+	Draws       []model.DrawRecord
+	Checkpoints []model.DrawCheckpoint
+	Redemptions []model.PrizeRedemption
+	Voided      []model.VoidedDraw
+	Adjustments []model.BalanceAdjustment
+}
+
+type SnapshotLogic struct {
+	ctx *svc.ServiceContext
+}
+
+func NewSnapshotLogic(ctx *svc.ServiceContext) *SnapshotLogic {
+	return &SnapshotLogic{ctx: ctx}
+}
+
+func (l *SnapshotLogic) dir() string {
+	if d := l.ctx.Config.Reset.SnapshotDir; d != "" {
+		return d
+	}
+	return defaultSnapshotDir
+}
+
+// Create writes a snapshot of every event table and records it. The
+// returned max ids tell a reset which rows the snapshot covers.
+func (l *SnapshotLogic) Create(reason, actor string) (*model.ResetSnapshot, map[string]int64, error) {
+	if err := os.MkdirAll(l.dir(), 0o750); err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	name := fmt.Sprintf("snapshot-%s-%s.jsonl.gz", now.Format("20060102-150405"), randomHex(4))
+	path := filepath.Join(l.dir(), name)
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, nil, err
+	}
+	counts, maxIDs, sum, size, err := l.write(f, SnapshotHeader{FormatVersion: SnapshotFormatVersion, Reason: reason, CreatedAt: now})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, nil, fmt.Errorf("write snapshot: %w", err)
+	}
+
+	rows, _ := json.Marshal(counts)
+	snap := model.ResetSnapshot{
+		Reason:    truncate(reason, 64),
+		File:      name,
+		SHA256:    sum,
+		Size:      size,
+		Rows:      string(rows),
+		CreatedBy: truncate(actor, 128),
+	}
+	if err := l.ctx.DB.Create(&snap).Error; err != nil {
+		return nil, nil, err
+	}
+	return &snap, maxIDs, nil
+}
+
+// write streams the tables to w and returns row counts, max ids, and the
+// checksum and size of the compressed file
+func (l *SnapshotLogic) write(w io.Writer, header SnapshotHeader) (map[string]int, map[string]int64, string, int64, error) {
+	h := sha256.New()
+	cw := &countingWriter{w: io.MultiWriter(w, h)}
+	gz := gzip.NewWriter(cw)
+	enc := json.NewEncoder(gz)
+	if err := enc.Encode(header); err != nil {
+		return nil, nil, "", 0, err
+	}
+
+	counts := map[string]int{}
+	maxIDs := map[string]int64{}
+	// Every table is read from one consistent view, so a draw that commits
+	// mid-dump is either in the snapshot with its stock and chances or not at
+	// all. Rows added meanwhile are above the max ids: the next snapshot's.
+	err := consistentRead(l.ctx.DB, func(conn *gorm.DB) error {
+		for _, table := range snapshotTables {
+			var maxID int64
+			if err := conn.Table(table).Select("COALESCE(MAX(id), 0)").Scan(&maxID).Error; err != nil {
+				return err
+			}
+			n, err := dump(conn, enc, table, maxID)
+			if err != nil {
+				return fmt.Errorf("%s: %w", table, err)
+			}
+			counts[table], maxIDs[table] = n, maxID
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, "", 0, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, nil, "", 0, err
+	}
+	return counts, maxIDs, hex.EncodeToString(h.Sum(nil)), cw.n, nil
+}
+
+// consistentRead runs fn on one connection inside a read-only REPEATABLE
+// READ transaction, so every query in fn sees the same committed state
+func consistentRead(db *gorm.DB, fn func(conn *gorm.DB) error) error {
+	return db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ").Error; err != nil {
+			return err
+		}
+		if err := conn.Exec("START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY").Error; err != nil {
+			return err
+		}
+		defer conn.Exec("COMMIT")
+		return fn(conn)
+	})
+}
+
+func dump(db *gorm.DB, enc *json.Encoder, table string, maxID int64) (int, error) {
+	switch table {
+	case "users":
+		return dumpTable[model.User](db, enc, table, maxID)
+	case "awards":
+		return dumpTable[model.Award](db, enc, table, maxID)
+	case "game_records":
+		return dumpTable[model.GameRecord](db, enc, table, maxID)
+	case "draw_records":
+		return dumpTable[model.DrawRecord](db, enc, table, maxID)
+	case "draw_checkpoints":
+		return dumpTable[model.DrawCheckpoint](db, enc, table, maxID)
+	case "prize_redemptions":
+		return dumpTable[model.PrizeRedemption](db, enc, table, maxID)
+	case "voided_draws":
+		return dumpTable[model.VoidedDraw](db, enc, table, maxID)
+	case "balance_adjustments":
+		return dumpTable[model.BalanceAdjustment](db, enc, table, maxID)
+	}
+	return 0, fmt.Errorf("unknown table %q", table)
+}
+
+// dumpTable encodes every row of table up to maxID as a snapshot line
+func dumpTable[T any](db *gorm.DB, enc *json.Encoder, table string, maxID int64) (int, error) {
+	var batch []T
+	n := 0
+	err := db.Table(table).Where("id <= ?", maxID).Order("id asc").FindInBatches(&batch, 1000, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			if err := enc.Encode(snapshotRow{Table: table, Row: &batch[i]}); err != nil {
+				return err
+			}
+		}
+		n += len(batch)
+		return nil
+	}).Error
+	return n, err
+}
+
+func (l *SnapshotLogic) List() ([]model.ResetSnapshot, error) {
+	var list []model.ResetSnapshot
+	err := l.ctx.DB.Order("id desc").Find(&list).Error
+	return list, err
+}
+
+// Load reads and checks a recorded snapshot
+func (l *SnapshotLogic) Load(id int64) (*model.ResetSnapshot, *SnapshotContents, error) {
+	var snap model.ResetSnapshot
+	if err := l.ctx.DB.First(&snap, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrSnapshotNotFound
+		}
+		return nil, nil, err
+	}
+	f, err := os.Open(filepath.Join(l.dir(), filepath.Base(snap.File)))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	contents, err := ReadSnapshot(io.TeeReader(f, h))
+	if err != nil {
+		return nil, nil, err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != snap.SHA256 {
+		return nil, nil, ErrSnapshotCorrupt
+	}
+	return &snap, contents, nil
+}
+
+// ReadSnapshot decodes a gzipped snapshot stream
+func ReadSnapshot(r io.Reader) (*SnapshotContents, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(gz))
+	c := &SnapshotContents{}
+	if err := dec.Decode(&c.Header); err != nil {
+		return nil, fmt.Errorf("snapshot header: %w", err)
+	}
+	if c.Header.FormatVersion != SnapshotFormatVersion {
+		return nil, fmt.Errorf("unsupported snapshot format %d", c.Header.FormatVersion)
+	}
+	for dec.More() {
+		var line SnapshotLine
+		if err := dec.Decode(&line); err != nil {
+			return nil, err
+		}
+		var err error
+		switch line.Table {
+		case "users":
+			err = appendRow(line.Row, &c.Users)
+		case "awards":
+			err = appendRow(line.Row, &c.Awards)
+		case "game_records":
+			err = appendRow(line.Row, &c.Games)
+		case "draw_records":
+			err = appendRow(line.Row, &c.Draws)
+		case "draw_checkpoints":
+			err = appendRow(line.Row, &c.Checkpoints)
+		case "prize_redemptions":
+			err = appendRow(line.Row, &c.Redemptions)
+		case "voided_draws":
+			err = appendRow(line.Row, &c.Voided)
+		case "balance_adjustments":
+			err = appendRow(line.Row, &c.Adjustments)
+		default:
+			err = fmt.Errorf("unknown table %q", line.Table)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("snapshot %s row: %w", line.Table, err)
+		}
+	}
+	// Drain the gzip trailer so the caller's checksum covers the whole file
+	if _, err := io.Copy(io.Discard, gz); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func appendRow[T any](raw json.RawMessage, rows *[]T) error {
+	var row T
+	if err := json.Unmarshal(raw, &row); err != nil {
+		return err
+	}
+	*rows = append(*rows, row)
+	return nil
+}
+
+// Restore rolls the event back to snapshot id. The current state is
+// snapshotted first, so a restore can itself be undone. Users and awards
+// are not deleted: users keep their profile and get the scores and chances
+// of the snapshot (zero if they joined later), and awards keep their
+// configuration with the stock that was won at the time taken off (full
+// stock if they were added later).
+func (l *SnapshotLogic) Restore(id int64, actor string) (*model.ResetSnapshot, error) {
+	snap, c, err := l.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := l.Create(fmt.Sprintf("restore:%d", id), actor); err != nil {
+		return nil, fmt.Errorf("snapshot before restore: %w", err)
+	}
+
+	err = l.ctx.DB.Transaction(func(tx *gorm.DB) error {
+		// Users
+		if err := tx.Model(&model.User{}).Where("1 = 1").Updates(map[string]interface{}{"total_score": 0, "chances": 0}).Error; err != nil {
+			return err
+		}
+		for _, u := range c.Users {
+			if err := tx.Model(&model.User{}).Where("user_id = ?", u.UserID).Updates(map[string]interface{}{
+				"total_score": u.TotalScore,
+				"chances":     u.Chances,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		// Awards: keep today's total_count, take off what had been won. One
+		// created after the snapshot had nothing won yet: full stock.
+		ids := make([]int, len(c.Awards))
+		for i, a := range c.Awards {
+			ids[i] = a.ID
+		}
+		fresh := tx.Model(&model.Award{})
+		if len(ids) > 0 {
+			fresh = fresh.Where("id NOT IN ?", ids)
+		} else {
+			fresh = fresh.Where("1 = 1")
+		}
+		if err := fresh.Updates(map[string]interface{}{
+			"remaining": gorm.Expr("total_count"),
+			"version":   gorm.Expr("version + 1"),
+		}).Error; err != nil {
+			return err
+		}
+		for _, a := range c.Awards {
+			won := a.TotalCount - a.Remaining
+			if err := tx.Exec("UPDATE awards SET remaining = GREATEST(total_count - ?, 0), version = version + 1 WHERE id = ?", won, a.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		// Everything else is replaced row for row, children first
+		for _, table := range []string{"voided_draws", "prize_redemptions", "draw_checkpoints", "draw_records", "game_records", "balance_adjustments"} {
+			if err := tx.Exec("DELETE FROM " + table).Error; err != nil {
+				return err
+			}
+		}
+		inserts := []struct {
+			n    int
+			rows interface{}
+		}{
+			{len(c.Games), &c.Games},
+			{len(c.Draws), &c.Draws},
+			{len(c.Checkpoints), &c.Checkpoints},
+			{len(c.Redemptions), &c.Redemptions},
+			{len(c.Voided), &c.Voided},
+			{len(c.Adjustments), &c.Adjustments},
+		}
+		for _, ins := range inserts {
+			if ins.n == 0 {
+				continue
+			}
+			if err := tx.CreateInBatches(ins.rows, 500).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		snap.RestoredAt, snap.RestoredBy = &now, truncate(actor, 128)
+		return tx.Model(snap).Updates(map[string]interface{}{"restored_at": now, "restored_by": snap.RestoredBy}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := NewStatsLogic(l.ctx).Clear(); err != nil {
+		log.Printf("Restore: failed to clear dashboard counters: %v", err)
+	}
+	return snap, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,71 @@
+package logic
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"testing"
+	"time"
+)
+
+func TestReadSnapshot(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(gz)
+	enc.Encode(SnapshotHeader{FormatVersion: SnapshotFormatVersion, Reason: "reset:all", CreatedAt: time.Now()})
+	enc.Encode(snapshotRow{Table: "users", Row: &model.User{ID: 1, UserID: "u1", TotalScore: 420, Chances: 2}})
+	enc.Encode(snapshotRow{Table: "awards", Row: &model.Award{ID: 3, TotalCount: 5, Remaining: 4}})
+	enc.Encode(snapshotRow{Table: "draw_records", Row: &model.DrawRecord{ID: 7, UserID: "u1", AwardID: 3, FinalHash: "abc"}})
+	enc.Encode(snapshotRow{Table: "balance_adjustments", Row: &model.BalanceAdjustment{ID: 2, UserID: "u1", Kind: AdjustChances, Delta: 2, Balance: 2}})
+	gz.Close()
+
+	c, err := ReadSnapshot(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadSnapshot: %v", err)
+	}
+	if c.Header.Reason != "reset:all" || len(c.Users) != 1 || len(c.Awards) != 1 || len(c.Draws) != 1 {
+		t.Fatalf("unexpected contents: %+v", c)
+	}
+	if c.Users[0].TotalScore != 420 || c.Draws[0].FinalHash != "abc" {
+		t.Errorf("rows did not round-trip: %+v %+v", c.Users[0], c.Draws[0])
+	}
+	if len(c.Adjustments) != 1 || c.Adjustments[0].Delta != 2 {
+		t.Errorf("adjustment ledger did not round-trip: %+v", c.Adjustments)
+	}
+}
+
+func TestReadSnapshotRejectsUnknownTable(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(gz)
+	enc.Encode(SnapshotHeader{FormatVersion: SnapshotFormatVersion})
+	enc.Encode(snapshotRow{Table: "admin_accounts", Row: map[string]int{"id": 1}})
+	gz.Close()
+
+	if _, err := ReadSnapshot(&buf); err == nil {
+		t.Error("unknown table accepted")
+	}
+}
+
+func TestNormalizeReset(t *testing.T) {
+	ctx := &svc.ServiceContext{}
+	l := NewAdminLogic(ctx)
+
+	req := ResetRequest{}
+	if err := l.NormalizeReset(&req); err != nil || req.Scope != ResetScopeAll {
+		t.Errorf("empty scope: %v, scope %q", err, req.Scope)
+	}
+	for _, scope := range []string{"campaign", "everything", ResetScopeTestUsers} {
+		if err := l.NormalizeReset(&ResetRequest{Scope: scope}); err == nil {
+			t.Errorf("scope %q accepted", scope)
+		}
+	}
+
+	ctx.Config.Reset.TestUserIDs = []string{"qa1", "qa2"}
+	req = ResetRequest{Scope: ResetScopeTestUsers}
+	if err := l.NormalizeReset(&req); err != nil || len(req.UserIDs) != 2 {
+		t.Errorf("test_users default: %v, %v", err, req.UserIDs)
+	}
+}
@@ -0,0 +1,298 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis keys behind the live dashboard. Counters start from zero and a reset
+// or restore clears them; the two balances are seeded from MySQL whenever
+// their key is missing.
+const (
+	statsActiveKey        = "stats:active"         // ZSET user_id -> last seen, unix seconds
+	statsGamesStartedKey  = "stats:games:started"  // Counter
+	statsGamesFinishedKey = "stats:games:finished" // Counter
+	statsDrawsKey         = "stats:draws"          // Counter
+	statsDrawsMinuteKey   = "stats:draws:min:"     // Counter per unix minute, kept two hours
+	statsChancesKey       = "stats:chances"        // Balance: chances not yet drawn
+	statsPointsKey        = "stats:points"         // Balance: points credited, net of adjustments
+	statsRejectionsKey    = "stats:rejections"     // HASH reason -> count
+	statsDepartmentsKey   = "stats:departments"    // ZSET department name -> points from games
+)
+
+// Anti-cheat rejection reasons counted by EndGame
+const (
+	RejectReplay      = "replay"
+	RejectSignature   = "signature"
+	RejectInvalidData = "invalid_data"
+	RejectSpeed       = "speed"
+)
+
+const (
+	statsActiveWindow          = 5 * time.Minute
+	statsDrawMinutes           = 30
+	defaultStatsStreamInterval = 5 * time.Second
+	defaultStatsTopDepartments = 10
+)
+
+// incrIfExistsScript moves a balance only once it has been seeded, so an
+// increment can never create the key and hide the seed.
+var incrIfExistsScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("INCRBY", KEYS[1], ARGV[1])
+end
+return false`)
+
+type MinuteCount struct {
+	Minute time.Time `json:"minute"`
+	Count  int64     `json:"count"`
+}
+
+type AwardStock struct {
+	ID        int             `json:"id"`
+	Name      string          `json:"name"`
+	Type      model.AwardType `json:"type"`
+	Total     int             `json:"total"`
+	Remaining int             `json:"remaining"`
+}
+
+type DepartmentPoints struct {
+	Name   string `json:"name"`
+	Points int64  `json:"points"`
+}
+
+// Stats is one reading of the operations dashboard
+type Stats struct {
+	ActiveUsers        int64              `json:"active_users"` // Seen in the last five minutes
+	GamesStarted       int64              `json:"games_started"`
+	GamesFinished      int64              `json:"games_finished"`
+	Draws              int64              `json:"draws"`
+	DrawsPerMinute     []MinuteCount      `json:"draws_per_minute"` // Last 30 minutes, oldest first; the last one is still running
+	Awards             []AwardStock       `json:"awards"`
+	ChancesOutstanding int64              `json:"chances_outstanding"`
+	PointsMinted       int64              `json:"points_minted"`
+	Rejections         map[string]int64   `json:"rejections"` // Anti-cheat rejections by reason
+	TopDepartments     []DepartmentPoints `json:"top_departments"`
+	GeneratedAt        time.Time          `json:"generated_at"`
+}
+
+type StatsLogic struct {
+	ctx *svc.ServiceContext
+}
+
+func NewStatsLogic(ctx *svc.ServiceContext) *StatsLogic {
+	return &StatsLogic{ctx: ctx}
+}
+
+// StreamInterval is how often the SSE stream sends a reading
+func (l *StatsLogic) StreamInterval() time.Duration {
+	if s := l.ctx.Config.Stats.StreamIntervalSeconds; s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	return defaultStatsStreamInterval
+}
+
+func (l *StatsLogic) topDepartments() int64 {
+	if n := l.ctx.Config.Stats.TopDepartments; n > 0 {
+		return int64(n)
+	}
+	return defaultStatsTopDepartments
+}
+
+// The recorders below run after the transaction has committed. They are best
+// effort: a Redis hiccup costs a dashboard tick, never a player's game.
+
+// GameStarted counts a new game
+func (l *StatsLogic) GameStarted(userID string) {
+	rctx := context.Background()
+	pipe := l.ctx.Redis.Pipeline()
+	l.touch(rctx, pipe, userID)
+	pipe.Incr(rctx, statsGamesStartedKey)
+	pipe.Exec(rctx)
+}
+
+// GameRejected counts an EndGame refused by the anti-cheat checks
+func (l *StatsLogic) GameRejected(reason string) {
+	l.ctx.Redis.HIncrBy(context.Background(), statsRejectionsKey, reason, 1)
+}
+
+// GameFinished counts a scored game and credits the player's departments
+func (l *StatsLogic) GameFinished(userID string, score, chances int) {
+	var departments []string
+	l.ctx.DB.Model(&model.User{}).Where("user_id = ?", userID).Pluck("department", &departments)
+
+	rctx := context.Background()
+	pipe := l.ctx.Redis.Pipeline()
+	l.touch(rctx, pipe, userID)
+	pipe.Incr(rctx, statsGamesFinishedKey)
+	incrIfExistsScript.Eval(rctx, pipe, []string{statsPointsKey}, score)
+	if chances > 0 {
+		incrIfExistsScript.Eval(rctx, pipe, []string{statsChancesKey}, chances)
+	}
+	if score > 0 && len(departments) > 0 {
+		for _, name := range departmentList(departments[0]) {
+			pipe.ZIncrBy(rctx, statsDepartmentsKey, float64(score), name)
+		}
+	}
+	pipe.Exec(rctx)
+}
+
+// Drew counts a draw: one chance spent, plus whatever the award credited
+func (l *StatsLogic) Drew(userID string, award *model.Award) {
+	rctx := context.Background()
+	keys, _ := drawMinuteKeys(time.Now(), 1)
+	minuteKey := keys[0]
+	chances := int64(-1)
+	if award.Type == model.AwardTypeChances {
+		chances += int64(award.Value)
+	}
+
+	pipe := l.ctx.Redis.Pipeline()
+	l.touch(rctx, pipe, userID)
+	pipe.Incr(rctx, statsDrawsKey)
+	pipe.Incr(rctx, minuteKey)
+	pipe.Expire(rctx, minuteKey, 2*time.Hour)
+	incrIfExistsScript.Eval(rctx, pipe, []string{statsChancesKey}, chances)
+	if award.Type == model.AwardTypePoints {
+		incrIfExistsScript.Eval(rctx, pipe, []string{statsPointsKey}, award.Value)
+	}
+	pipe.Exec(rctx)
+}
+
+// Adjusted moves the balances by a manual adjustment
+func (l *StatsLogic) Adjusted(rows []model.BalanceAdjustment) {
+	rctx := context.Background()
+	pipe := l.ctx.Redis.Pipeline()
+	for _, r := range rows {
+		key := statsChancesKey
+		if r.Kind == AdjustPoints {
+			key = statsPointsKey
+		}
+		incrIfExistsScript.Eval(rctx, pipe, []string{key}, r.Delta)
+	}
+	pipe.Exec(rctx)
+}
+
+// Clear drops every counter; the balances reseed on the next read. Resets and
+// restores call it once the data has changed under the counters.
+func (l *StatsLogic) Clear() error {
+	rctx := context.Background()
+	keys, _ := drawMinuteKeys(time.Now(), 120) // Everything still within its expiry
+	keys = append(keys, statsActiveKey, statsGamesStartedKey, statsGamesFinishedKey, statsDrawsKey,
+		statsChancesKey, statsPointsKey, statsRejectionsKey, statsDepartmentsKey)
+	return l.ctx.Redis.Del(rctx, keys...).Err()
+}
+
+func (l *StatsLogic) touch(rctx context.Context, pipe redis.Pipeliner, userID string) {
+	pipe.ZAdd(rctx, statsActiveKey, &redis.Z{Score: float64(time.Now().Unix()), Member: userID})
+}
+
+// Stats reads the dashboard from Redis. Award stock comes from the awards
+// table: a handful of rows, and it stays right across admin edits and resets.
+func (l *StatsLogic) Stats() (*Stats, error) {
+	rctx := context.Background()
+	now := time.Now()
+	minuteKeys, minutes := drawMinuteKeys(now, statsDrawMinutes)
+
+	pipe := l.ctx.Redis.Pipeline()
+	cutoff := strconv.FormatInt(now.Add(-statsActiveWindow).Unix(), 10)
+	pipe.ZRemRangeByScore(rctx, statsActiveKey, "-inf", "("+cutoff)
+	active := pipe.ZCard(rctx, statsActiveKey)
+	started := pipe.Get(rctx, statsGamesStartedKey)
+	finished := pipe.Get(rctx, statsGamesFinishedKey)
+	draws := pipe.Get(rctx, statsDrawsKey)
+	perMinute := pipe.MGet(rctx, minuteKeys...)
+	chances := pipe.Get(rctx, statsChancesKey)
+	points := pipe.Get(rctx, statsPointsKey)
+	rejections := pipe.HGetAll(rctx, statsRejectionsKey)
+	departments := pipe.ZRevRangeWithScores(rctx, statsDepartmentsKey, 0, l.topDepartments()-1)
+	if _, err := pipe.Exec(rctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	s := &Stats{
+		ActiveUsers:    active.Val(),
+		GamesStarted:   counterVal(started),
+		GamesFinished:  counterVal(finished),
+		Draws:          counterVal(draws),
+		Rejections:     map[string]int64{},
+		TopDepartments: []DepartmentPoints{},
+		GeneratedAt:    now,
+	}
+	for i, v := range perMinute.Val() {
+		n, _ := strconv.ParseInt(stringVal(v), 10, 64)
+		s.DrawsPerMinute = append(s.DrawsPerMinute, MinuteCount{Minute: minutes[i], Count: n})
+	}
+	for reason, v := range rejections.Val() {
+		s.Rejections[reason], _ = strconv.ParseInt(v, 10, 64)
+	}
+	for _, z := range departments.Val() {
+		s.TopDepartments = append(s.TopDepartments, DepartmentPoints{Name: stringVal(z.Member), Points: int64(z.Score)})
+	}
+
+	var err error
+	if s.ChancesOutstanding, err = l.balance(chances, statsChancesKey, "chances"); err != nil {
+		return nil, err
+	}
+	if s.PointsMinted, err = l.balance(points, statsPointsKey, "total_score"); err != nil {
+		return nil, err
+	}
+
+	var awards []model.Award
+	if err := l.ctx.DB.Where("retired = ?", false).Order("id asc").Find(&awards).Error; err != nil {
+		return nil, err
+	}
+	for _, a := range awards {
+		s.Awards = append(s.Awards, AwardStock{ID: a.ID, Name: a.Name, Type: a.Type, Total: a.TotalCount, Remaining: a.Remaining})
+	}
+	return s, nil
+}
+
+// balance returns a seeded balance, or seeds it with one SUM over users. A
+// game that commits between the SUM and the SET is missed until the next
+// reset; the dashboard is for watching trends, the tables stay the record.
+func (l *StatsLogic) balance(cmd *redis.StringCmd, key, column string) (int64, error) {
+	if n, err := cmd.Int64(); err == nil {
+		return n, nil
+	}
+	var sum int64
+	if err := l.ctx.DB.Model(&model.User{}).Select("COALESCE(SUM(" + column + "), 0)").Scan(&sum).Error; err != nil {
+		return 0, err
+	}
+	rctx := context.Background()
+	if ok, err := l.ctx.Redis.SetNX(rctx, key, sum, 0).Result(); err == nil && !ok {
+		// Another reader seeded it first
+		return l.ctx.Redis.Get(rctx, key).Int64()
+	}
+	return sum, nil
+}
+
+// drawMinuteKeys returns the per-minute draw counters for the n minutes up
+// to and including now's, oldest first, with the start of each minute
+func drawMinuteKeys(now time.Time, n int) ([]string, []time.Time) {
+	keys := make([]string, n)
+	minutes := make([]time.Time, n)
+	current := now.Unix() / 60
+	for i := 0; i < n; i++ {
+		m := current - int64(n-1-i)
+		keys[i] = statsDrawsMinuteKey + strconv.FormatInt(m, 10)
+		minutes[i] = time.Unix(m*60, 0)
+	}
+	return keys, minutes
+}
+
+func counterVal(cmd *redis.StringCmd) int64 {
+	n, _ := cmd.Int64()
+	return n
+}
+
+func stringVal(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
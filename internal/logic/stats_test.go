@@ -0,0 +1,34 @@
+package logic
+
+import (
+	"happynewyear/internal/svc"
+	"testing"
+	"time"
+)
+
+func TestDrawMinuteKeys(t *testing.T) {
+	now := time.Unix(1769947230, 0) // 30s into minute 29499120
+	keys, minutes := drawMinuteKeys(now, 3)
+	want := []string{"stats:draws:min:29499118", "stats:draws:min:29499119", "stats:draws:min:29499120"}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("keys[%d] = %s, want %s", i, keys[i], want[i])
+		}
+	}
+	if !minutes[2].Equal(time.Unix(1769947200, 0)) || minutes[2].Sub(minutes[0]) != 2*time.Minute {
+		t.Errorf("minutes = %v", minutes)
+	}
+}
+
+func TestStatsSettings(t *testing.T) {
+	ctx := &svc.ServiceContext{}
+	l := NewStatsLogic(ctx)
+	if l.StreamInterval() != defaultStatsStreamInterval || l.topDepartments() != defaultStatsTopDepartments {
+		t.Errorf("defaults: %v, %d", l.StreamInterval(), l.topDepartments())
+	}
+	ctx.Config.Stats.StreamIntervalSeconds = 2
+	ctx.Config.Stats.TopDepartments = 3
+	if l.StreamInterval() != 2*time.Second || l.topDepartments() != 3 {
+		t.Errorf("configured: %v, %d", l.StreamInterval(), l.topDepartments())
+	}
+}
@@ -3,9 +3,15 @@ package logic
 import (
 	"happynewyear/internal/model"
 	"happynewyear/internal/svc"
+	"log"
 	"time"
 )
 
+const (
+	NonMemberPolicyReject = "reject"
+	NonMemberPolicyGuest  = "guest"
+)
+
 type UserLogic struct {
 	ctx *svc.ServiceContext
 }
@@ -14,13 +20,26 @@ func NewUserLogic(ctx *svc.ServiceContext) *UserLogic {
 	return &UserLogic{ctx: ctx}
 }
 
-// Login handles the WeCom OAuth callback
-func (l *UserLogic) Login(code string) (string, *model.User, error) {
+// Login handles the WeCom OAuth callback. The session is bound to userAgent.
+func (l *UserLogic) Login(code, userAgent string) (*Session, *model.User, error) {
 	// 1. Get UserId from WeCom
-	client := NewWeComClient(l.ctx.Config)
-	userID, err := client.GetUserID(code)
+	client := NewWeComClient(l.ctx)
+	identity, err := client.Identify(code)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
+	}
+
+	// 1.1 Non-members (external contacts, WeChat users) are rejected unless
+	// the event explicitly admits them as guests under a separate id space
+	userID := identity.UserID
+	if !identity.IsMember() {
+		if l.ctx.Config.WeCom.NonMemberPolicy != NonMemberPolicyGuest {
+			return nil, nil, &LoginError{Code: LoginErrNotMember, Msg: "only employees can join this event"}
+		}
+		userID = guestUserID(identity)
+		if userID == "" {
+			return nil, nil, &LoginError{Code: LoginErrNotMember, Msg: "unknown wecom identity"}
+		}
 	}
 
 	// 2. Find or Create User in DB
@@ -28,24 +47,46 @@ func (l *UserLogic) Login(code string) (string, *model.User, error) {
 	result := l.ctx.DB.Where("user_id = ?", userID).First(&user)
 	if result.Error != nil {
 		// New User
-		// TODO: In a real app, we might want to fetch name/avatar from WeCom here
 		user = model.User{
 			UserID:  userID,
 			Name:    userID, // Placeholder
 			Chances: 0,
 		}
 		if err := l.ctx.DB.Create(&user).Error; err != nil {
-			return "", nil, err
+			return nil, nil, err
+		}
+	}
+
+	// 2.1 Refresh WeCom profile (name, departments, avatar) when missing or stale.
+	// A disabled account is rechecked right away in case the member came back.
+	if identity.IsMember() && (l.profileStale(&user) || user.Disabled) {
+		if err := l.RefreshProfile(client, &user); err != nil {
+			// Login still works with the old/placeholder profile
+			log.Printf("Profile refresh for %s failed: %v", user.UserID, err)
 		}
 	}
 
-	// 3. Generate JWT
-	token, err := GenerateToken(l.ctx.Config.Game.AppSecret, user.UserID, user.Name, 24*time.Hour)
+	if user.Disabled {
+		return nil, nil, &LoginError{Code: LoginErrNotMember, Msg: "this account has been disabled"}
+	}
+
+	// 2.2 user_ticket (snsapi_privateinfo) carries the avatar user/get no longer returns
+	if identity.UserTicket != "" {
+		if detail, err := client.GetUserDetail(identity.UserTicket); err != nil {
+			log.Printf("User detail for %s failed: %v", user.UserID, err)
+		} else if detail.Avatar != "" && detail.Avatar != user.Avatar {
+			user.Avatar = detail.Avatar
+			l.ctx.DB.Model(&user).Update("avatar", user.Avatar)
+		}
+	}
+
+	// 3. Issue the session
+	session, err := NewSessionLogic(l.ctx).Create(user.UserID, user.Name, userAgent)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
 
-	return token, &user, nil
+	return session, &user, nil
 }
 
 // GetUserInfo fetches user details
@@ -54,3 +95,59 @@ func (l *UserLogic) GetUserInfo(userID string) (*model.User, error) {
 	err := l.ctx.DB.Where("user_id = ?", userID).First(&user).Error
 	return &user, err
 }
+
+func (l *UserLogic) profileStale(user *model.User) bool {
+	if user.ProfileSyncedAt == nil {
+		return true
+	}
+	ttl := time.Duration(l.ctx.Config.WeCom.ProfileTTLHours) * time.Hour
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return time.Since(*user.ProfileSyncedAt) > ttl
+}
+
+// RefreshProfile pulls user/get and resolves department names, then saves the user
+func (l *UserLogic) RefreshProfile(client *WeComClient, user *model.User) error {
+	profile, err := client.GetUser(user.UserID)
+	if err != nil {
+		return err
+	}
+
+	depts := make(model.Departments, 0, len(profile.Department))
+	for _, id := range profile.Department {
+		name, err := client.GetDepartmentName(id)
+		if err != nil {
+			log.Printf("Resolve department %d failed: %v", id, err)
+		}
+		depts = append(depts, model.DepartmentRef{ID: id, Name: name})
+	}
+
+	now := time.Now()
+	if profile.Name != "" {
+		user.Name = profile.Name
+	}
+	user.Department = depts
+	user.Position = profile.Position
+	if profile.Avatar != "" {
+		user.Avatar = profile.Avatar
+	}
+	user.Disabled = profile.Inactive()
+	user.ProfileSyncedAt = &now
+
+	// Struct update so the JSON serializer on Department applies
+	return l.ctx.DB.Model(user).
+		Select("name", "department", "position", "avatar", "disabled", "profile_synced_at").
+		Updates(user).Error
+}
+
+// guestUserID keeps non-members out of the employee id space
+func guestUserID(identity *WeComIdentity) string {
+	if identity.ExternalUserID != "" {
+		return "ext:" + identity.ExternalUserID
+	}
+	if identity.OpenID != "" {
+		return "guest:" + identity.OpenID
+	}
+	return ""
+}
@@ -1,93 +1,335 @@
 package logic
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"happynewyear/internal/config"
+	"happynewyear/internal/svc"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DefaultWeComBaseURL is the real API; point WeCom.BaseURL at cmd/wecommock for local runs
+const DefaultWeComBaseURL = "https://qyapi.weixin.qq.com"
+
+// WeCom errcodes meaning the access_token is invalid or expired
+const (
+	errCodeInvalidToken = 40014
+	errCodeTokenExpired = 42001
 )
 
+var weComHTTPClient = &http.Client{Timeout: 5 * time.Second}
+
 type WeComClient struct {
 	CorpID  string
 	Secret  string
 	AgentID int
+	BaseURL string
+
+	token       *CachedToken
+	jsapiTicket *CachedToken
+	agentTicket *CachedToken
+	rdb         *redis.Client
 }
 
-func NewWeComClient(cfg config.Config) *WeComClient {
-	return &WeComClient{
-		CorpID:  cfg.WeCom.CorpID,
-		Secret:  cfg.WeCom.Secret,
-		AgentID: cfg.WeCom.AgentID,
+func NewWeComClient(ctx *svc.ServiceContext) *WeComClient {
+	c := &WeComClient{
+		CorpID:  ctx.Config.WeCom.CorpID,
+		Secret:  ctx.Config.WeCom.Secret,
+		AgentID: ctx.Config.WeCom.AgentID,
+		BaseURL: strings.TrimRight(ctx.Config.WeCom.BaseURL, "/"),
+		rdb:     ctx.Redis,
 	}
+	if c.BaseURL == "" {
+		c.BaseURL = DefaultWeComBaseURL
+	}
+	// Shared by every replica through Redis
+	key := fmt.Sprintf("wecom:token:%s:%d", c.CorpID, c.AgentID)
+	c.token = NewCachedToken(ctx.Redis, key, c.fetchAccessToken)
+	c.jsapiTicket = NewCachedToken(ctx.Redis, fmt.Sprintf("wecom:jsapi_ticket:%s:%d", c.CorpID, c.AgentID), c.fetchJSAPITicket)
+	c.agentTicket = NewCachedToken(ctx.Redis, fmt.Sprintf("wecom:agent_ticket:%s:%d", c.CorpID, c.AgentID), c.fetchAgentTicket)
+	return c
+}
+
+// WeComError is a non-zero errcode returned by the WeCom API
+type WeComError struct {
+	Code int
+	Msg  string
+}
+
+func (e *WeComError) Error() string {
+	return fmt.Sprintf("wecom error: %d %s", e.Code, e.Msg)
+}
+
+type WeComBaseResp struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+func (r *WeComBaseResp) base() *WeComBaseResp { return r }
+
+type weComResp interface {
+	base() *WeComBaseResp
 }
 
 // WeCom Response Structs
 type AccessTokenResp struct {
-	ErrCode     int    `json:"errcode"`
-	ErrMsg      string `json:"errmsg"`
+	WeComBaseResp
 	AccessToken string `json:"access_token"`
 	ExpiresIn   int    `json:"expires_in"`
 }
 
+// UserInfoResp is auth/getuserinfo (v2). Members get userid + user_ticket,
+// non-members get openid and, for external contacts, external_userid.
 type UserInfoResp struct {
-	ErrCode int    `json:"errcode"`
-	ErrMsg  string `json:"errmsg"`
-	UserID  string `json:"UserId"`
-	OpenID  string `json:"OpenId"` // Non-internal users
+	WeComBaseResp
+	UserID         string `json:"userid"`
+	UserTicket     string `json:"user_ticket"`
+	OpenID         string `json:"openid"`
+	ExternalUserID string `json:"external_userid"`
 }
 
-// GetUserID uses the code to get the UserID
-func (c *WeComClient) GetUserID(code string) (string, error) {
-	// Mock implementation for Dev request if code="mock"
-	if code == "mock" {
-		return "mock_user_001", nil
+type UserDetailResp struct {
+	WeComBaseResp
+	UserID string `json:"userid"`
+	Gender string `json:"gender"`
+	Avatar string `json:"avatar"`
+}
+
+// WeComIdentity is who a login code belongs to
+type WeComIdentity struct {
+	UserID         string // Members only
+	UserTicket     string // Members with snsapi_privateinfo scope
+	OpenID         string // Non-members
+	ExternalUserID string // External contacts
+}
+
+func (i *WeComIdentity) IsMember() bool { return i.UserID != "" }
+
+// Login error codes surfaced to the frontend
+const (
+	LoginErrInvalidCode = "invalid_code"
+	LoginErrNotMember   = "not_member"
+	LoginErrUnavailable = "wecom_unavailable"
+)
+
+// WeCom errcodes for a bad, used or expired OAuth code
+var invalidCodeErrCodes = map[int]bool{40029: true, 40163: true, 42003: true}
+
+type LoginError struct {
+	Code string
+	Msg  string
+}
+
+func (e *LoginError) Error() string { return e.Msg }
+
+// Identify exchanges an OAuth code via auth/getuserinfo
+func (c *WeComClient) Identify(code string) (*WeComIdentity, error) {
+	// Mock codes only mean something to cmd/wecommock; never send them to real WeCom
+	if c.BaseURL == DefaultWeComBaseURL && strings.HasPrefix(code, "mock") {
+		return nil, &LoginError{Code: LoginErrInvalidCode, Msg: "mock login is disabled"}
 	}
 
-	token, err := c.getAccessToken()
-	if err != nil {
-		return "", err
+	var result UserInfoResp
+	if err := c.get("/cgi-bin/auth/getuserinfo", url.Values{"code": {code}}, &result); err != nil {
+		var wecomErr *WeComError
+		if errors.As(err, &wecomErr) && invalidCodeErrCodes[wecomErr.Code] {
+			return nil, &LoginError{Code: LoginErrInvalidCode, Msg: "login code is invalid or expired"}
+		}
+		return nil, &LoginError{Code: LoginErrUnavailable, Msg: err.Error()}
 	}
 
-	url := fmt.Sprintf("https://qyapi.weixin.qq.com/cgi-bin/user/getuserinfo?access_token=%s&code=%s", token, code)
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", err
+	return &WeComIdentity{
+		UserID:         result.UserID,
+		UserTicket:     result.UserTicket,
+		OpenID:         result.OpenID,
+		ExternalUserID: result.ExternalUserID,
+	}, nil
+}
+
+// GetUserDetail reads sensitive profile fields with a user_ticket
+func (c *WeComClient) GetUserDetail(userTicket string) (*UserDetailResp, error) {
+	var result UserDetailResp
+	body := map[string]string{"user_ticket": userTicket}
+	if err := c.post("/cgi-bin/auth/getuserdetail", body, &result); err != nil {
+		return nil, err
 	}
-	defer resp.Body.Close()
+	return &result, nil
+}
 
-	var result UserInfoResp
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+// WeCom member status values
+const (
+	WeComUserActive    = 1
+	WeComUserDisabled  = 2
+	WeComUserNotActive = 4
+	WeComUserResigned  = 5
+)
+
+type WeComUser struct {
+	UserID     string `json:"userid"`
+	Name       string `json:"name"`
+	Department []int  `json:"department"`
+	Position   string `json:"position"`
+	Avatar     string `json:"avatar"`
+	Status     int    `json:"status"`
+}
+
+// Inactive reports whether the member can no longer take part
+func (u *WeComUser) Inactive() bool {
+	return u.Status == WeComUserDisabled || u.Status == WeComUserResigned
+}
+
+type WeComUserResp struct {
+	WeComBaseResp
+	WeComUser
+}
+
+type WeComDepartment struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	ParentID int    `json:"parentid"`
+	Order    int    `json:"order"`
+}
+
+type DepartmentResp struct {
+	WeComBaseResp
+	Department WeComDepartment `json:"department"`
+}
+
+// GetUser calls user/get for the member's profile
+func (c *WeComClient) GetUser(userID string) (*WeComUserResp, error) {
+	var result WeComUserResp
+	if err := c.get("/cgi-bin/user/get", url.Values{"userid": {userID}}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetDepartmentName resolves a department id, cached in Redis for a day
+func (c *WeComClient) GetDepartmentName(id int) (string, error) {
+	ctx := context.Background()
+	key := fmt.Sprintf("wecom:dept:%s:%d", c.CorpID, id)
+	if name, err := c.rdb.Get(ctx, key).Result(); err == nil {
+		return name, nil
+	}
+
+	var result DepartmentResp
+	if err := c.get("/cgi-bin/department/get", url.Values{"id": {strconv.Itoa(id)}}, &result); err != nil {
 		return "", err
 	}
+	c.rdb.Set(ctx, key, result.Department.Name, 24*time.Hour)
+	return result.Department.Name, nil
+}
 
-	if result.ErrCode != 0 {
-		return "", fmt.Errorf("wecom error: %d %s", result.ErrCode, result.ErrMsg)
+// MessageSendResp is message/send. A partial delivery still has errcode 0
+// and lists the recipients WeCom could not reach.
+type MessageSendResp struct {
+	WeComBaseResp
+	InvalidUser  string `json:"invaliduser"`
+	InvalidParty string `json:"invalidparty"`
+	MsgID        string `json:"msgid"`
+}
+
+// SendMessage posts an app message as our agent; body carries touser/toparty,
+// msgtype and the msgtype payload.
+func (c *WeComClient) SendMessage(body map[string]interface{}) (*MessageSendResp, error) {
+	body["agentid"] = c.AgentID
+	var result MessageSendResp
+	if err := c.post("/cgi-bin/message/send", body, &result); err != nil {
+		return nil, err
 	}
+	return &result, nil
+}
+
+func (c *WeComClient) get(path string, query url.Values, out weComResp) error {
+	return c.call(http.MethodGet, path, query, nil, out)
+}
+
+func (c *WeComClient) post(path string, body interface{}, out weComResp) error {
+	return c.call(http.MethodPost, path, nil, body, out)
+}
+
+// call attaches the cached access_token and retries once with a fresh token
+// if WeCom says the cached one is invalid or expired.
+func (c *WeComClient) call(method, path string, query url.Values, body interface{}, out weComResp) error {
+	ctx := context.Background()
+	if query == nil {
+		query = url.Values{}
+	}
+
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		token, err := c.token.Get(ctx)
+		if err != nil {
+			return err
+		}
+		query.Set("access_token", token)
 
-	if result.UserID != "" {
-		return result.UserID, nil
+		*out.base() = WeComBaseResp{}
+		if err := doWeComRequest(method, c.BaseURL+path+"?"+query.Encode(), payload, out); err != nil {
+			return err
+		}
+
+		b := out.base()
+		if (b.ErrCode == errCodeInvalidToken || b.ErrCode == errCodeTokenExpired) && attempt == 0 {
+			c.token.Invalidate(ctx, token)
+			continue
+		}
+		if b.ErrCode != 0 {
+			return &WeComError{Code: b.ErrCode, Msg: b.ErrMsg}
+		}
+		return nil
 	}
-	// External contacts use OpenId
-	return result.OpenID, nil
 }
 
-// TODO: Cache AccessToken (use Redis in production)
-func (c *WeComClient) getAccessToken() (string, error) {
-	url := fmt.Sprintf("https://qyapi.weixin.qq.com/cgi-bin/gettoken?corpid=%s&corpsecret=%s", c.CorpID, c.Secret)
-	resp, err := http.Get(url)
+func doWeComRequest(method, url string, payload []byte, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, url, body)
 	if err != nil {
-		return "", err
+		return err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := weComHTTPClient.Do(req)
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
 
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// fetchAccessToken calls gettoken directly; use c.token.Get for the cached value
+func (c *WeComClient) fetchAccessToken() (string, int, error) {
+	q := url.Values{"corpid": {c.CorpID}, "corpsecret": {c.Secret}}
 	var result AccessTokenResp
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+	if err := doWeComRequest(http.MethodGet, c.BaseURL+"/cgi-bin/gettoken?"+q.Encode(), nil, &result); err != nil {
+		return "", 0, err
 	}
 
 	if result.ErrCode != 0 {
-		return "", fmt.Errorf("token error: %d %s", result.ErrCode, result.ErrMsg)
+		return "", 0, fmt.Errorf("token error: %d %s", result.ErrCode, result.ErrMsg)
 	}
 
-	return result.AccessToken, nil
+	return result.AccessToken, result.ExpiresIn, nil
 }
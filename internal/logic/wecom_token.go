@@ -0,0 +1,100 @@
+package logic
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// Refresh this long before WeCom's expires_in so no request carries a dying token
+	tokenRefreshMargin = 5 * time.Minute
+	tokenLockTTL       = 10 * time.Second
+	tokenLockWait      = 3 * time.Second
+)
+
+// tokenFlight collapses concurrent refreshes within this process.
+// Across replicas a short Redis lock does the same job.
+var tokenFlight singleflight.Group
+
+// compareAndDeleteScript deletes KEYS[1] only if it still holds ARGV[1]. Used to
+// release our own refresh lock, and to drop a rejected token without clobbering
+// a fresh one another replica already wrote.
+var compareAndDeleteScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// CachedToken is a Redis-backed cache for WeCom credentials such as the
+// access_token and jsapi tickets.
+type CachedToken struct {
+	rdb   *redis.Client
+	key   string
+	fetch func() (value string, expiresIn int, err error)
+}
+
+func NewCachedToken(rdb *redis.Client, key string, fetch func() (string, int, error)) *CachedToken {
+	return &CachedToken{rdb: rdb, key: key, fetch: fetch}
+}
+
+func (t *CachedToken) Get(ctx context.Context) (string, error) {
+	if v, err := t.rdb.Get(ctx, t.key).Result(); err == nil && v != "" {
+		return v, nil
+	}
+
+	v, err, _ := tokenFlight.Do(t.key, func() (interface{}, error) {
+		return t.refresh(ctx)
+	})
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+// Invalidate forgets a token WeCom rejected (40014 / 42001)
+func (t *CachedToken) Invalidate(ctx context.Context, stale string) {
+	compareAndDeleteScript.Run(ctx, t.rdb, []string{t.key}, stale)
+}
+
+func (t *CachedToken) refresh(ctx context.Context) (string, error) {
+	lockKey := t.key + ":lock"
+	owner := GenerateNonce()
+
+	locked, err := t.rdb.SetNX(ctx, lockKey, owner, tokenLockTTL).Result()
+	if err == nil && !locked {
+		// Another replica is refreshing; wait for it to publish the token
+		deadline := time.Now().Add(tokenLockWait)
+		for time.Now().Before(deadline) {
+			time.Sleep(100 * time.Millisecond)
+			if v, err := t.rdb.Get(ctx, t.key).Result(); err == nil && v != "" {
+				return v, nil
+			}
+		}
+	}
+	if locked {
+		defer compareAndDeleteScript.Run(ctx, t.rdb, []string{lockKey}, owner)
+	}
+
+	value, expiresIn, err := t.fetch()
+	if err != nil {
+		return "", err
+	}
+
+	ttl := time.Duration(expiresIn)*time.Second - tokenRefreshMargin
+	if ttl <= 0 {
+		ttl = time.Duration(expiresIn) * time.Second / 2
+	}
+	if ttl <= 0 {
+		// Nothing sensible to cache; hand the value out once
+		return value, nil
+	}
+	if err := t.rdb.Set(ctx, t.key, value, ttl).Err(); err != nil {
+		// The token itself is good; without the cache the next caller just fetches again
+		log.Printf("WeCom: failed to cache %s: %v", t.key, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,182 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// downRedis is a client whose server is unreachable, so every command fails fast
+func downRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+// fakeWeCom issues tok-1, tok-2, ... from gettoken and answers /cgi-bin/test
+// with the errcode reject returns for the token it was given
+func fakeWeCom(t *testing.T, reject func(token string) int) (srv *httptest.Server, issued, calls *int32) {
+	t.Helper()
+	issued, calls = new(int32), new(int32)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cgi-bin/gettoken":
+			n := atomic.AddInt32(issued, 1)
+			fmt.Fprintf(w, `{"errcode":0,"access_token":"tok-%d","expires_in":7200}`, n)
+		case "/cgi-bin/test":
+			atomic.AddInt32(calls, 1)
+			fmt.Fprintf(w, `{"errcode":%d,"errmsg":"x"}`, reject(r.URL.Query().Get("access_token")))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, issued, calls
+}
+
+func newTestWeComClient(rdb *redis.Client, baseURL, key string) *WeComClient {
+	c := &WeComClient{CorpID: "corp", Secret: "secret", BaseURL: baseURL, rdb: rdb}
+	c.token = NewCachedToken(rdb, key, c.fetchAccessToken)
+	return c
+}
+
+func TestWeComCallRetriesOnceWithFreshToken(t *testing.T) {
+	for _, code := range []int{errCodeInvalidToken, errCodeTokenExpired} {
+		srv, issued, calls := fakeWeCom(t, func(token string) int {
+			if token == "tok-1" {
+				return code
+			}
+			return 0
+		})
+		c := newTestWeComClient(downRedis(t), srv.URL, fmt.Sprintf("wecom:token:retry:%d", code))
+
+		var resp WeComBaseResp
+		if err := c.get("/cgi-bin/test", nil, &resp); err != nil {
+			t.Fatalf("%d: %v", code, err)
+		}
+		if *calls != 2 || *issued != 2 {
+			t.Errorf("%d: %d calls with %d tokens, want 2 and 2", code, *calls, *issued)
+		}
+	}
+}
+
+func TestWeComCallGivesUpAfterOneRetry(t *testing.T) {
+	srv, issued, calls := fakeWeCom(t, func(string) int { return errCodeTokenExpired })
+	c := newTestWeComClient(downRedis(t), srv.URL, "wecom:token:giveup")
+
+	var resp WeComBaseResp
+	err := c.get("/cgi-bin/test", nil, &resp)
+	var wecomErr *WeComError
+	if !errors.As(err, &wecomErr) || wecomErr.Code != errCodeTokenExpired {
+		t.Fatalf("err = %v", err)
+	}
+	if *calls != 2 || *issued != 2 {
+		t.Errorf("%d calls with %d tokens, want 2 and 2", *calls, *issued)
+	}
+}
+
+func TestCachedTokenServesWithoutRedis(t *testing.T) {
+	// A failing cache write must not cost the caller a good token
+	tok := NewCachedToken(downRedis(t), "wecom:token:nocache", func() (string, int, error) {
+		return "tok", 7200, nil
+	})
+	if v, err := tok.Get(context.Background()); err != nil || v != "tok" {
+		t.Errorf("Get = %q, %v", v, err)
+	}
+}
+
+func TestCachedTokenSingleflight(t *testing.T) {
+	var fetches int32
+	tok := NewCachedToken(downRedis(t), "wecom:token:flight", func() (string, int, error) {
+		atomic.AddInt32(&fetches, 1)
+		time.Sleep(200 * time.Millisecond)
+		return "tok", 7200, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := tok.Get(context.Background()); err != nil || v != "tok" {
+				t.Errorf("Get = %q, %v", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if fetches != 1 {
+		t.Errorf("%d fetches for 20 concurrent callers", fetches)
+	}
+}
+
+func TestCachedTokenWaitsForOtherReplica(t *testing.T) {
+	ctx := testRedis(t)
+	rctx := context.Background()
+	key := "wecom:token:replica"
+
+	// Another replica holds the refresh lock and publishes shortly after
+	if err := ctx.Redis.Set(rctx, key+":lock", "other", tokenLockTTL).Err(); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		ctx.Redis.Set(rctx, key, "from-other", time.Hour)
+	}()
+
+	tok := NewCachedToken(ctx.Redis, key, func() (string, int, error) {
+		t.Error("fetched while another replica held the lock")
+		return "ours", 7200, nil
+	})
+	if v, err := tok.Get(rctx); err != nil || v != "from-other" {
+		t.Errorf("Get = %q, %v", v, err)
+	}
+	if owner, _ := ctx.Redis.Get(rctx, key+":lock").Result(); owner != "other" {
+		t.Errorf("lock owner = %q, another replica's lock was released", owner)
+	}
+}
+
+func TestCachedTokenRefreshCachesAndUnlocks(t *testing.T) {
+	ctx := testRedis(t)
+	rctx := context.Background()
+	key := "wecom:token:refresh"
+
+	var fetches int32
+	tok := NewCachedToken(ctx.Redis, key, func() (string, int, error) {
+		n := atomic.AddInt32(&fetches, 1)
+		return fmt.Sprintf("tok-%d", n), 7200, nil
+	})
+	for i := 0; i < 3; i++ {
+		if v, err := tok.Get(rctx); err != nil || v != "tok-1" {
+			t.Fatalf("Get = %q, %v", v, err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("%d fetches, want the cached token reused", fetches)
+	}
+	if n, _ := ctx.Redis.Exists(rctx, key+":lock").Result(); n != 0 {
+		t.Error("refresh lock left behind")
+	}
+	ttl, _ := ctx.Redis.TTL(rctx, key).Result()
+	if ttl <= 0 || ttl > 7200*time.Second-tokenRefreshMargin {
+		t.Errorf("ttl = %v, want expires_in minus the refresh margin", ttl)
+	}
+
+	// Invalidating a token someone already replaced leaves the new one alone
+	tok.Invalidate(rctx, "tok-0")
+	if v, _ := ctx.Redis.Get(rctx, key).Result(); v != "tok-1" {
+		t.Errorf("stale invalidate removed %q", v)
+	}
+	tok.Invalidate(rctx, "tok-1")
+	if v, err := tok.Get(rctx); err != nil || v != "tok-2" {
+		t.Errorf("after invalidate Get = %q, %v", v, err)
+	}
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"happynewyear/internal/keyring"
+	"happynewyear/internal/logic"
+	"happynewyear/internal/svc"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// dryPool lets dry-run transactions begin and commit without a server
+type dryPool struct{}
+
+var errNoServer = errors.New("no database in tests")
+
+func (*dryPool) PrepareContext(context.Context, string) (*sql.Stmt, error) { return nil, errNoServer }
+func (*dryPool) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, errNoServer
+}
+func (*dryPool) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, errNoServer
+}
+func (*dryPool) QueryRowContext(context.Context, string, ...interface{}) *sql.Row { return nil }
+func (p *dryPool) BeginTx(context.Context, *sql.TxOptions) (gorm.ConnPool, error) { return p, nil }
+func (*dryPool) Commit() error                                                    { return nil }
+func (*dryPool) Rollback() error                                                  { return nil }
+
+// sqlRecorder is a gorm logger that keeps the SQL of every statement
+type sqlRecorder struct {
+	logger.Interface
+	statements []string
+}
+
+func (r *sqlRecorder) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	r.statements = append(r.statements, sql)
+}
+
+func (r *sqlRecorder) audits() []string {
+	var inserts []string
+	for _, s := range r.statements {
+		if strings.HasPrefix(s, "INSERT INTO `admin_audit`") {
+			inserts = append(inserts, s)
+		}
+	}
+	return inserts
+}
+
+func TestAdminAuthAuditsRefusals(t *testing.T) {
+	rec := &sqlRecorder{Interface: logger.Discard}
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: &dryPool{}, SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, Logger: rec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := keyring.New([]keyring.Key{{ID: "k1", Secret: []byte("test-secret")}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &svc.ServiceContext{DB: db, JWTKeys: keys}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/admin/stats", AdminAuth(ctx), func(c *gin.Context) {
+		t.Error("handler ran for a refused request")
+	})
+
+	cases := []struct {
+		name   string
+		cookie string
+		want   string
+	}{
+		{"no session", "", "admin login required"},
+		{"forged session", "not-a-jwt", "Invalid or expired token"},
+	}
+	for _, tc := range cases {
+		rec.statements = nil
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/stats?probe=1", nil)
+		if tc.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: logic.AdminSessionCookie, Value: tc.cookie})
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), tc.want) {
+			t.Errorf("%s: %d %s", tc.name, w.Code, w.Body.String())
+		}
+		inserts := rec.audits()
+		if len(inserts) != 1 {
+			t.Fatalf("%s: %d audit entries, want 1: %v", tc.name, len(inserts), rec.statements)
+		}
+		for _, part := range []string{"'anonymous','admin.auth'", `"path":"/api/admin/stats"`, ",401,'denied','" + tc.want + "'"} {
+			if !strings.Contains(inserts[0], part) {
+				t.Errorf("%s: entry lacks %s: %s", tc.name, part, inserts[0])
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"happynewyear/internal/logic"
+	"happynewyear/internal/model"
+	"happynewyear/internal/svc"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAuditBody is how much of a JSON request body goes into the log
+const maxAuditBody = 16 << 10
+
+// AdminAudit writes one admin_audit entry per request once the handler has
+// run. Put it before RequirePermission so refused attempts are logged too.
+// The actor is the account AdminAuth found, or the "audit_actor" a handler
+// set for requests without one (failed logins).
+func AdminAudit(ctx *svc.ServiceContext, action string) gin.HandlerFunc {
+	audit := logic.NewAdminAuditLogic(ctx)
+	return func(c *gin.Context) {
+		params := map[string]interface{}{}
+		if len(c.Params) > 0 {
+			path := map[string]interface{}{}
+			for _, p := range c.Params {
+				path[p.Key] = p.Value
+			}
+			params["path"] = path
+		}
+		if q := c.Request.URL.Query(); len(q) > 0 {
+			query := map[string]interface{}{}
+			for k, v := range q {
+				query[k] = strings.Join(v, ",")
+			}
+			params["query"] = query
+		}
+		if body := auditBody(c); body != nil {
+			params["body"] = body
+		}
+
+		w := &auditWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		// Handlers can add what the request alone does not show, e.g. a batch id
+		if extra, ok := c.Get("audit_extra"); ok {
+			params["result"] = extra
+		}
+
+		recordAudit(audit, c, action, params, w)
+	}
+}
+
+// recordAudit writes the entry for a request that has been answered
+func recordAudit(audit *logic.AdminAuditLogic, c *gin.Context, action string, params map[string]interface{}, w *auditWriter) {
+	entry := &model.AdminAudit{
+		Actor:     c.GetString("audit_actor"),
+		Action:    action,
+		Params:    logic.AuditParams(params),
+		IP:        c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		Status:    w.Status(),
+		Outcome:   logic.AuditOutcome(w.Status()),
+		Error:     w.errorMessage(),
+	}
+	if v, ok := c.Get("admin"); ok {
+		account := v.(*model.AdminAccount)
+		entry.ActorID, entry.Actor = account.ID, account.Username
+	}
+	if entry.Actor == "" {
+		entry.Actor = "anonymous"
+	}
+	if err := audit.Record(entry); err != nil {
+		log.Printf("Admin audit: failed to record %s by %s: %v", action, entry.Actor, err)
+	}
+}
+
+// auditBody reads a JSON body and puts it back for the handler. Other bodies
+// (image uploads) are only described.
+func auditBody(c *gin.Context) interface{} {
+	if c.Request.Body == nil || c.Request.ContentLength == 0 {
+		return nil
+	}
+	if !strings.HasPrefix(c.ContentType(), "application/json") {
+		return map[string]interface{}{"content_type": c.ContentType(), "size": c.Request.ContentLength}
+	}
+	raw, err := io.ReadAll(io.LimitReader(c.Request.Body, maxAuditBody+1))
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(raw), c.Request.Body))
+	if err != nil || len(raw) > maxAuditBody {
+		return map[string]interface{}{"truncated": true, "size": c.Request.ContentLength}
+	}
+	var body interface{}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return map[string]interface{}{"invalid_json": true, "size": len(raw)}
+	}
+	return body
+}
+
+// auditWriter keeps the start of error responses so the log can say why a
+// request failed
+type auditWriter struct {
+	gin.ResponseWriter
+	errBody []byte
+}
+
+func (w *auditWriter) Write(b []byte) (int, error) {
+	if w.Status() >= 400 && len(w.errBody) < 1024 {
+		w.errBody = append(w.errBody, b...)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *auditWriter) errorMessage() string {
+	if len(w.errBody) == 0 {
+		return ""
+	}
+	var resp struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(w.errBody, &resp) == nil && resp.Error != "" {
+		return resp.Error
+	}
+	return string(w.errBody)
+}
@@ -1,38 +1,90 @@
 package middleware
 
 import (
-	"happynewyear/internal/config"
+	"crypto/subtle"
+	"errors"
 	"happynewyear/internal/logic"
+	"happynewyear/internal/svc"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware(cfg config.Config) gin.HandlerFunc {
+// AuthMiddleware accepts the session cookie, or a Bearer token when
+// Auth.AllowBearer is on for tooling. Either way the token must come from the
+// same User-Agent it was issued to and its session must not be on the
+// revocation list. Cookie sessions must also send the CSRF token on anything
+// but GET/HEAD/OPTIONS.
+func AuthMiddleware(ctx *svc.ServiceContext) gin.HandlerFunc {
+	sessions := logic.NewSessionLogic(ctx)
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+		tokenString, fromCookie := readToken(c, logic.SessionCookie, ctx.Config.Auth.AllowBearer)
+		if tokenString == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "login required"})
 			return
 		}
-
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization format"})
-			return
-		}
-
-		tokenString := parts[1]
-		claims, err := logic.ValidateToken(cfg.Game.AppSecret, tokenString)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		claims, ok := verifySession(c, ctx, sessions, tokenString, fromCookie)
+		if !ok {
 			return
 		}
 
 		// Set user context
 		c.Set("user_id", claims.UserID)
 		c.Set("name", claims.Name)
+		c.Set("session_id", claims.SessionID)
 		c.Next()
 	}
 }
+
+// readToken takes the token from cookie, or from the Authorization header
+// when allowBearer is set
+func readToken(c *gin.Context, cookie string, allowBearer bool) (token string, fromCookie bool) {
+	if v, err := c.Cookie(cookie); err == nil && v != "" {
+		return v, true
+	}
+	if allowBearer {
+		parts := strings.Split(c.GetHeader("Authorization"), " ")
+		if len(parts) == 2 && parts[0] == "Bearer" {
+			return parts[1], false
+		}
+	}
+	return "", false
+}
+
+// verifySession checks signature, device, revocation and CSRF, and aborts
+// the request if any of them fails
+func verifySession(c *gin.Context, ctx *svc.ServiceContext, sessions *logic.SessionLogic, tokenString string, fromCookie bool) (*logic.Claims, bool) {
+	claims, err := logic.ValidateToken(ctx.JWTKeys, tokenString)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		return nil, false
+	}
+
+	if claims.Fingerprint != logic.DeviceFingerprint(c.GetHeader("User-Agent")) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "session belongs to another device"})
+		return nil, false
+	}
+
+	if err := sessions.CheckAccess(claims); err != nil {
+		if errors.Is(err, logic.ErrSessionStore) {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if fromCookie && !safeMethod(c.Request.Method) {
+		sent := c.GetHeader(logic.CSRFHeader)
+		if sent == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(claims.CSRF)) != 1 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "invalid csrf token"})
+			return nil, false
+		}
+	}
+	return claims, true
+}
+
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
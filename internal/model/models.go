@@ -1,35 +1,104 @@
 package model
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 // User maps to the `users` table
 type User struct {
-	ID         int64     `gorm:"primaryKey;autoIncrement" json:"id"`
-	UserID     string    `gorm:"uniqueIndex;type:varchar(64);not null" json:"user_id"`
-	Name       string    `gorm:"type:varchar(64);not null;default:''" json:"name"`
-	Department string    `gorm:"type:varchar(255);not null;default:''" json:"department"`
-	Avatar     string    `gorm:"type:varchar(512);not null;default:''" json:"avatar"`
-	Chances    int       `gorm:"not null;default:0" json:"chances"`
-	TotalScore int64     `gorm:"not null;default:0" json:"total_score"`
-	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID              int64       `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID          string      `gorm:"uniqueIndex;type:varchar(64);not null" json:"user_id"`
+	Name            string      `gorm:"type:varchar(64);not null;default:'';index:idx_name" json:"name"`
+	Department      Departments `gorm:"type:varchar(1024);not null;default:'';serializer:json" json:"department"`
+	Position        string      `gorm:"type:varchar(128);not null;default:''" json:"position"`
+	Avatar          string      `gorm:"type:varchar(512);not null;default:''" json:"avatar"`
+	Chances         int         `gorm:"not null;default:0;index:idx_chances" json:"chances"`
+	TotalScore      int64       `gorm:"not null;default:0;index:idx_total_score" json:"total_score"`
+	ProfileSyncedAt *time.Time  `json:"profile_synced_at"`                      // Last WeCom user/get refresh
+	Disabled        bool        `gorm:"not null;default:false" json:"disabled"` // Left the company or disabled in WeCom
+	CreatedAt       time.Time   `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time   `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
+// DepartmentRef is one WeCom department a user belongs to
+type DepartmentRef struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// Departments is stored as JSON in `users.department`
+type Departments []DepartmentRef
+
+// Names joins the department names for display, e.g. "研发部/产品部"
+func (d Departments) Names() string {
+	names := make([]string, 0, len(d))
+	for _, dep := range d {
+		if dep.Name != "" {
+			names = append(names, dep.Name)
+		}
+	}
+	return strings.Join(names, "/")
+}
+
+// Department maps to the `departments` table (WeCom org chart, kept by orgsync)
+type Department struct {
+	ID          int       `gorm:"primaryKey;autoIncrement:false" json:"id"` // WeCom department id
+	Name        string    `gorm:"type:varchar(64);not null" json:"name"`
+	ParentID    int       `gorm:"index;not null;default:0" json:"parent_id"`
+	SortOrder   int       `gorm:"not null;default:0" json:"sort_order"`
+	MemberCount int       `gorm:"not null;default:0" json:"member_count"` // Direct members at the last sync
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// AwardType selects what happens when an award is won.
+// Values are stored in `awards.type`, so existing numbers must never change.
+type AwardType int
+
+const (
+	AwardTypeGrandPrize   AwardType = 1 // Physical prize, top tier
+	AwardTypePrize        AwardType = 2 // Physical prize
+	AwardTypeBlessing     AwardType = 3 // Sunshine blessing, no-op
+	AwardTypePoints       AwardType = 4 // Credits Value points
+	AwardTypeChances      AwardType = 5 // Credits Value extra draw chances
+	AwardTypeVacationCard AwardType = 6 // Vacation card, once per user
+)
+
 // Award maps to the `awards` table
 type Award struct {
 	ID          int       `gorm:"primaryKey;autoIncrement" json:"id"`
 	Name        string    `gorm:"type:varchar(64);not null" json:"name"`
-	Type        int       `gorm:"not null" json:"type"` // 1=Grand, 2=Regular, 3=Sunshine
+	Type        AwardType `gorm:"not null" json:"type"`
 	TotalCount  int       `gorm:"not null" json:"total_count"`
 	Remaining   int       `gorm:"not null" json:"remaining"`
 	Probability int       `gorm:"not null;default:0" json:"probability"` // Weight / 10000
 	Value       int       `gorm:"not null;default:0" json:"value"`       // Point value for type=4
 	ImageURL    string    `gorm:"type:varchar(255);default:''" json:"image_url"`
-	Version     int       `gorm:"not null;default:0" json:"version"` // Optimistic Lock
+	ThumbURL    string    `gorm:"type:varchar(255);default:''" json:"thumb_url"` // Downscaled ImageURL for lists
+	Version     int       `gorm:"not null;default:0" json:"version"`             // Optimistic Lock
+	Retired     bool      `gorm:"not null;default:false" json:"retired"`
 	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
+// AwardRevision maps to the `award_revisions` table.
+// One row per configuration change, so the odds in effect at any time can be rebuilt.
+type AwardRevision struct {
+	ID          int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	AwardID     int       `gorm:"index;not null" json:"award_id"`
+	Revision    int       `gorm:"not null" json:"revision"`
+	Action      string    `gorm:"type:varchar(16);not null" json:"action"` // create, update, retire, migrate
+	Name        string    `gorm:"type:varchar(64);not null" json:"name"`
+	Type        AwardType `gorm:"not null" json:"type"`
+	TotalCount  int       `gorm:"not null" json:"total_count"`
+	Probability int       `gorm:"not null" json:"probability"`
+	Value       int       `gorm:"not null" json:"value"`
+	ImageURL    string    `gorm:"type:varchar(255);default:''" json:"image_url"`
+	Retired     bool      `gorm:"not null;default:false" json:"retired"`
+	CreatedAt   time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
 // GameRecord maps to the `game_records` table
 type GameRecord struct {
 	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
@@ -45,12 +114,180 @@ type GameRecord struct {
 
 // DrawRecord maps to the `draw_records` table (Audit Chain)
 type DrawRecord struct {
+	ID           int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID       string    `gorm:"index;type:varchar(64);not null" json:"user_id"`
+	AwardID      int       `gorm:"not null;index:idx_award_id" json:"award_id"`
+	AwardName    string    `gorm:"type:varchar(64);not null" json:"award_name"`
+	BlessingID   int       `gorm:"not null;default:0" json:"blessing_id"`
+	Message      string    `gorm:"type:varchar(255);not null;default:''" json:"message"` // Rendered blessing
+	PrevHash     string    `gorm:"type:varchar(64);not null;default:''" json:"prev_hash"`
+	DataHash     string    `gorm:"type:varchar(64);not null" json:"data_hash"`
+	FinalHash    string    `gorm:"type:varchar(64);not null" json:"final_hash"`
+	RedeemSecret string    `gorm:"type:varchar(16);not null;default:'';index:idx_redeem_secret" json:"redeem_secret,omitempty"` // Random half of the redemption code; outside the chain and the audit bundle
+	CreatedAt    time.Time `gorm:"autoCreateTime;index:idx_created_at" json:"created_at"`
+}
+
+// DrawCheckpoint maps to the `draw_checkpoints` table (Hourly Merkle Anchor)
+type DrawCheckpoint struct {
+	ID            int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	PeriodStart   time.Time `gorm:"uniqueIndex;not null" json:"period_start"`
+	PeriodEnd     time.Time `gorm:"not null" json:"period_end"`
+	FirstRecordID int64     `gorm:"not null" json:"first_record_id"`
+	LastRecordID  int64     `gorm:"not null" json:"last_record_id"`
+	LeafCount     int       `gorm:"not null" json:"leaf_count"`
+	MerkleRoot    string    `gorm:"type:varchar(64);not null" json:"merkle_root"`
+	PublishedTo   string    `gorm:"type:varchar(32);not null;default:''" json:"published_to"`
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// Blessing maps to the `blessings` table (Random messages for blessing awards)
+type Blessing struct {
+	ID        int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Template  string    `gorm:"type:varchar(255);not null" json:"template"` // Supports {name} and {department}
+	Weight    int       `gorm:"not null;default:1" json:"weight"`
+	Enabled   bool      `gorm:"not null;default:true" json:"enabled"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// Notification statuses
+const (
+	NotificationPending = "pending"
+	NotificationSending = "sending"
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed"
+)
+
+// Notification maps to the `notifications` table (WeCom app message queue and send log)
+type Notification struct {
+	ID            int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Kind          string     `gorm:"type:varchar(32);index;not null" json:"kind"`             // prize_win, chance_reminder, leaderboard_frozen, broadcast
+	DedupKey      string     `gorm:"type:varchar(128);uniqueIndex;not null" json:"dedup_key"` // Enqueueing the same key twice is a no-op
+	ToUser        string     `gorm:"type:text" json:"to_user"`                                // "|" separated, or "@all"
+	ToParty       string     `gorm:"type:varchar(1024);not null;default:''" json:"to_party"`  // "|" separated department ids
+	MsgType       string     `gorm:"type:varchar(32);not null" json:"msg_type"`
+	Payload       string     `gorm:"type:text" json:"payload"` // JSON body of the msgtype field
+	Status        string     `gorm:"type:varchar(16);index;not null" json:"status"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"index;not null" json:"next_attempt_at"`
+	LastError     string     `gorm:"type:varchar(512);not null;default:''" json:"last_error"`
+	MsgID         string     `gorm:"type:varchar(128);not null;default:''" json:"msg_id"`
+	InvalidUser   string     `gorm:"type:varchar(1024);not null;default:''" json:"invalid_user"` // Recipients WeCom could not reach
+	CreatedBy     string     `gorm:"type:varchar(64);not null;default:''" json:"created_by"`
+	SentAt        *time.Time `json:"sent_at"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// AdminAccount maps to the `admin_accounts` table. An account with a WeCom
+// user id signs in through the normal WeCom login; one with a password hash
+// can also use the local login.
+type AdminAccount struct {
+	ID           int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Username     string     `gorm:"uniqueIndex;type:varchar(64);not null" json:"username"`
+	Name         string     `gorm:"type:varchar(64);not null;default:''" json:"name"`
+	WeComUserID  string     `gorm:"index;type:varchar(64);not null;default:''" json:"wecom_user_id"`
+	PasswordHash string     `gorm:"type:varchar(100);not null;default:''" json:"-"` // bcrypt; empty disables local login
+	Role         string     `gorm:"type:varchar(32);not null" json:"role"`          // viewer, prize-fulfiller, operator, super-admin, auditor
+	Disabled     bool       `gorm:"not null;default:false" json:"disabled"`
+	LastLoginAt  *time.Time `json:"last_login_at"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// PrizeRedemption maps to the `prize_redemptions` table. Draw records are
+// part of the audit chain and never change, so hand-outs are kept here.
+type PrizeRedemption struct {
+	ID           int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	DrawRecordID int64     `gorm:"uniqueIndex;not null" json:"draw_record_id"`
+	UserID       string    `gorm:"index;type:varchar(64);not null" json:"user_id"`
+	AwardName    string    `gorm:"type:varchar(64);not null" json:"award_name"`
+	RedeemedBy   string    `gorm:"type:varchar(64);not null" json:"redeemed_by"` // Admin username
+	Note         string    `gorm:"type:varchar(255);not null;default:''" json:"note"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// AdminAudit maps to the `admin_audit` table, the append-only log of admin
+// actions. Entries are hash-chained like draw records; see logic.AdminAuditLogic.
+type AdminAudit struct {
 	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
-	UserID    string    `gorm:"index;type:varchar(64);not null" json:"user_id"`
-	AwardID   int       `gorm:"not null" json:"award_id"`
-	AwardName string    `gorm:"type:varchar(64);not null" json:"award_name"`
-	PrevHash  string    `gorm:"type:varchar(64);not null;default:''" json:"prev_hash"`
+	ActorID   int64     `gorm:"not null;default:0" json:"actor_id"` // Admin account id, 0 for the CLI
+	Actor     string    `gorm:"index;type:varchar(64);not null" json:"actor"`
+	Action    string    `gorm:"index;type:varchar(64);not null" json:"action"` // e.g. "awards.update"
+	Params    string    `gorm:"type:text;not null" json:"params"`              // JSON: path, query and body, secrets redacted
+	IP        string    `gorm:"type:varchar(45);not null;default:''" json:"ip"`
+	UserAgent string    `gorm:"type:varchar(255);not null;default:''" json:"user_agent"`
+	Status    int       `gorm:"not null" json:"status"`                   // HTTP status of the response, 0 for adminctl and approved operations
+	Outcome   string    `gorm:"type:varchar(16);not null" json:"outcome"` // success, denied or failure
+	Error     string    `gorm:"type:varchar(255);not null;default:''" json:"error"`
+	PrevHash  string    `gorm:"type:varchar(64);not null" json:"prev_hash"`
 	DataHash  string    `gorm:"type:varchar(64);not null" json:"data_hash"`
 	FinalHash string    `gorm:"type:varchar(64);not null" json:"final_hash"`
+	CreatedAt time.Time `gorm:"index;not null" json:"created_at"`
+}
+
+// TableName keeps the singular name used in init.sql
+func (AdminAudit) TableName() string { return "admin_audit" }
+
+// AdminApproval maps to the `admin_approvals` table. A dangerous operation
+// is proposed by one admin and runs only once a second admin approves it
+// before ExpiresAt.
+type AdminApproval struct {
+	ID           int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Operation    string     `gorm:"type:varchar(64);not null" json:"operation"` // data.reset, data.restore, awards.create, awards.update, chances.grant
+	Params       string     `gorm:"type:text;not null" json:"params"`           // JSON the operation runs with
+	Summary      string     `gorm:"type:varchar(255);not null;default:''" json:"summary"`
+	Status       string     `gorm:"index;type:varchar(16);not null" json:"status"` // pending, approved, executed, failed, rejected, expired
+	ProposedByID int64      `gorm:"not null" json:"proposed_by_id"`
+	ProposedBy   string     `gorm:"type:varchar(64);not null" json:"proposed_by"`
+	DecidedByID  int64      `gorm:"not null;default:0" json:"decided_by_id"`
+	DecidedBy    string     `gorm:"type:varchar(64);not null;default:''" json:"decided_by"`
+	Note         string     `gorm:"type:varchar(255);not null;default:''" json:"note"` // Reason given when approving or rejecting
+	Result       string     `gorm:"type:text" json:"result"`                           // JSON result, or the error if it failed
+	ExpiresAt    time.Time  `gorm:"not null" json:"expires_at"`
+	DecidedAt    *time.Time `json:"decided_at"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// VoidedDraw maps to the `voided_draws` table. Draw records stay in the
+// audit chain for good; a reset of test users voids their draws here
+// instead and puts the stock back.
+type VoidedDraw struct {
+	ID           int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	DrawRecordID int64     `gorm:"uniqueIndex;not null" json:"draw_record_id"`
+	UserID       string    `gorm:"index;type:varchar(64);not null" json:"user_id"`
+	AwardID      int       `gorm:"not null" json:"award_id"`
+	Reason       string    `gorm:"type:varchar(255);not null;default:''" json:"reason"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// ResetSnapshot maps to the `reset_snapshots` table: one gzipped JSONL file
+// of the event data, written before every reset and restore
+type ResetSnapshot struct {
+	ID         int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Reason     string     `gorm:"type:varchar(64);not null" json:"reason"` // e.g. "reset:all", "restore:12", "manual"
+	File       string     `gorm:"type:varchar(255);not null" json:"file"`
+	SHA256     string     `gorm:"column:sha256;type:varchar(64);not null" json:"sha256"`
+	Size       int64      `gorm:"not null" json:"size"`
+	Rows       string     `gorm:"type:varchar(1024);not null;default:''" json:"rows"` // JSON row count per table
+	CreatedBy  string     `gorm:"type:varchar(128);not null" json:"created_by"`
+	RestoredAt *time.Time `json:"restored_at"`
+	RestoredBy string     `gorm:"type:varchar(128);not null;default:''" json:"restored_by"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// BalanceAdjustment maps to the `balance_adjustments` table, the ledger of
+// manual chance and points changes. Game and draw credits are not in it;
+// game_records and draw_records already account for those.
+type BalanceAdjustment struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    string    `gorm:"index;type:varchar(64);not null" json:"user_id"`
+	Kind      string    `gorm:"type:varchar(16);not null" json:"kind"` // chances or points
+	Delta     int64     `gorm:"not null" json:"delta"`
+	Balance   int64     `gorm:"not null" json:"balance"` // Chances or total score after the change
+	Reason    string    `gorm:"type:varchar(255);not null" json:"reason"`
+	Actor     string    `gorm:"type:varchar(128);not null" json:"actor"`
+	BatchID   string    `gorm:"index;type:varchar(32);not null;default:''" json:"batch_id"` // Set for CSV uploads
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 }
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStoragePut(t *testing.T) {
+	s := NewLocalStorage(t.TempDir(), "/uploads/")
+
+	url, err := s.Put("awards/a.png", strings.NewReader("png"), "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "/uploads/awards/a.png" {
+		t.Errorf("url = %q", url)
+	}
+	data, err := os.ReadFile(filepath.Join(s.Dir, "awards", "a.png"))
+	if err != nil || string(data) != "png" {
+		t.Fatalf("stored %q, %v", data, err)
+	}
+
+	if err := s.Delete("awards/a.png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("awards/a.png"); err != nil {
+		t.Errorf("deleting a missing file: %v", err)
+	}
+}
+
+func TestLocalStorageRejectsTraversal(t *testing.T) {
+	root := t.TempDir()
+	s := NewLocalStorage(filepath.Join(root, "assets"), "/uploads")
+	outside := filepath.Join(root, "secret")
+	if err := os.WriteFile(outside, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{
+		"",
+		"../secret",
+		"awards/../../secret",
+		"/etc/passwd",
+		"awards//a.png",
+		"awards/./a.png",
+		"awards/",
+	} {
+		if _, err := s.Put(key, strings.NewReader("x"), "image/png"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if err := s.Delete(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Delete(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+
+	if data, err := os.ReadFile(outside); err != nil || string(data) != "keep" {
+		t.Errorf("file outside the storage dir changed: %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "etc")); !os.IsNotExist(err) {
+		t.Errorf("absolute key escaped the storage dir: %v", err)
+	}
+}
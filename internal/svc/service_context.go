@@ -3,7 +3,9 @@ package svc
 import (
 	"fmt"
 	"happynewyear/internal/config"
+	"happynewyear/internal/keyring"
 	"happynewyear/internal/model"
+	"happynewyear/internal/storage"
 	"log"
 	"time"
 
@@ -13,9 +15,12 @@ import (
 )
 
 type ServiceContext struct {
-	Config config.Config
-	DB     *gorm.DB
-	Redis  *redis.Client
+	Config   config.Config
+	DB       *gorm.DB
+	Redis    *redis.Client
+	Storage  storage.Storage
+	JWTKeys  *keyring.Keyring // Session tokens
+	GameKeys *keyring.Keyring // Game result signatures
 }
 func NewServiceContext(c config.Config) *ServiceContext {
 	// 1. Init MySQL with Retry
@@ -35,7 +40,7 @@ func NewServiceContext(c config.Config) *ServiceContext {
 	}
 
 	// Auto Migrate (Safe for MVP, but be careful in Prod)
-	err = db.AutoMigrate(&model.User{}, &model.Award{}, &model.GameRecord{}, &model.DrawRecord{})
+	err = db.AutoMigrate(&model.User{}, &model.Award{}, &model.AwardRevision{}, &model.GameRecord{}, &model.DrawRecord{}, &model.DrawCheckpoint{}, &model.Blessing{}, &model.Notification{}, &model.Department{}, &model.AdminAccount{}, &model.PrizeRedemption{}, &model.AdminAudit{}, &model.AdminApproval{}, &model.VoidedDraw{}, &model.ResetSnapshot{}, &model.BalanceAdjustment{})
 	if err != nil {
 		log.Printf("Warning: AutoMigrate failed: %v", err)
 	}
@@ -47,11 +52,39 @@ func NewServiceContext(c config.Config) *ServiceContext {
 		DB: 0,
 	})
 
+	// 3. Init Asset Storage (local volume; S3/MinIO can implement storage.Storage later)
+	var store storage.Storage
+	switch c.Storage.Driver {
+	case "", "local":
+		dir, baseURL := c.Storage.LocalDir, c.Storage.BaseURL
+		if dir == "" {
+			dir = "uploads"
+		}
+		if baseURL == "" {
+			baseURL = "/uploads"
+		}
+		store = storage.NewLocalStorage(dir, baseURL)
+	default:
+		log.Fatalf("Unsupported storage driver: %s", c.Storage.Driver)
+	}
+
+	// 4. Signing keys
+	jwtKeys, gameKeys, err := keyring.FromConfig(c)
+	if err != nil {
+		log.Fatalf("Invalid signing keys: %v", err)
+	}
+	if len(c.Keys.JWT) == 0 {
+		log.Printf("Warning: Keys.JWT is empty; deriving the session key from Game.AppSecret")
+	}
+
 	fmt.Println("Service Context Initialized: DB & Redis Connected")
 
 	return &ServiceContext{
-		Config: c,
-		DB:     db,
-		Redis:  rdb,
+		Config:   c,
+		DB:       db,
+		Redis:    rdb,
+		Storage:  store,
+		JWTKeys:  jwtKeys,
+		GameKeys: gameKeys,
 	}
 }
@@ -0,0 +1,87 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func readPart(t *testing.T, zr *zip.Reader, name string) string {
+	t.Helper()
+	for _, f := range zr.File {
+		if f.Name == name {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			b, _ := io.ReadAll(rc)
+			return string(b)
+		}
+	}
+	t.Fatalf("%s missing", name)
+	return ""
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "中奖名单/2026")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteRow("姓名", "积分", "已发放")
+	w.WriteRow("张三 <R&D>", int64(420), true)
+	w.WriteRow("bad\x00char", 7, nil)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow("late"); err != ErrClosed {
+		t.Errorf("write after close: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("not a zip: %v", err)
+	}
+	if wb := readPart(t, zr, "xl/workbook.xml"); !strings.Contains(wb, `name="中奖名单_2026"`) {
+		t.Errorf("sheet name not cleaned: %s", wb)
+	}
+	readPart(t, zr, "[Content_Types].xml")
+	readPart(t, zr, "_rels/.rels")
+
+	var sheet struct {
+		Rows []struct {
+			R     int `xml:"r,attr"`
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal([]byte(readPart(t, zr, "xl/worksheets/sheet1.xml")), &sheet); err != nil {
+		t.Fatalf("sheet is not valid XML: %v", err)
+	}
+	if len(sheet.Rows) != 3 || sheet.Rows[2].R != 3 {
+		t.Fatalf("rows = %+v", sheet.Rows)
+	}
+	row := sheet.Rows[1].Cells
+	if row[0].Inline != "张三 <R&D>" || row[1].Ref != "B2" || row[1].Value != "420" || row[2].Type != "b" || row[2].Value != "1" {
+		t.Errorf("row 2 = %+v", row)
+	}
+	if got := sheet.Rows[2].Cells[0].Inline; got != "badchar" {
+		t.Errorf("control character kept: %q", got)
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := ColumnName(i); got != want {
+			t.Errorf("ColumnName(%d) = %s, want %s", i, got, want)
+		}
+	}
+}